@@ -0,0 +1,93 @@
+// Package main writes the patches of a folder of images as PNG crops for annotators to label, and reads their
+// labels back into a manifest for the evaluation commands.
+//
+//	crops export -dir frames -out crops [-config attributes.json]
+//	crops import -crops crops -dir frames -manifest dataset.json
+//
+// Every crop is the patch the model sees, edge patches resized like the prefilter does, with a sidecar JSON
+// naming its frame, grid place, crop offset and the score of the model. Annotators fill in the label of the sidecar.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"go.viam.com/rdk/logging"
+
+	"github.com/viamrobotics/ocean-prefilter/evaluation"
+	"github.com/viamrobotics/ocean-prefilter/export"
+)
+
+const usage = `usage:
+  crops export -dir frames -out crops [-config attributes.json] [-model model.json]
+  crops import -crops crops -dir frames -manifest dataset.json`
+
+func main() {
+	if len(os.Args) < 2 {
+		fmt.Fprintln(os.Stderr, usage)
+		os.Exit(2)
+	}
+	var err error
+	switch os.Args[1] {
+	case "export":
+		err = runExport(os.Args[2:])
+	case "import":
+		err = runImport(os.Args[2:])
+	default:
+		fmt.Fprintln(os.Stderr, usage)
+		os.Exit(2)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "crops:", err)
+		os.Exit(1)
+	}
+}
+
+func runExport(args []string) error {
+	fs := flag.NewFlagSet("export", flag.ExitOnError)
+	dir := fs.String("dir", "", "folder of JPEG and PNG frames, searched recursively")
+	out := fs.String("out", "", "folder to write the crops and their sidecars to")
+	config := fs.String("config", "", "JSON file with the attributes of the service, the defaults if not set")
+	model := fs.String("model", "", "XGBoost model to score the crops with, a JSON dump or a model saved with save_model as JSON or UBJSON, instead of the model_path of the config")
+	_ = fs.Parse(args)
+	if *dir == "" || *out == "" {
+		fmt.Fprintln(os.Stderr, usage)
+		os.Exit(2)
+	}
+	rc, err := evaluation.LoadRunConfig(*config, *model, logging.NewLogger("crops"))
+	if err != nil {
+		return err
+	}
+	images, patches, skipped, err := export.ExportCrops(*dir, *out, rc)
+	if err != nil {
+		return err
+	}
+	for _, s := range skipped {
+		fmt.Printf("skipped %v: %v\n", s.Path, s.Error)
+	}
+	fmt.Printf("wrote %v crops of %v images (%v skipped)\n", patches, images, len(skipped))
+	return nil
+}
+
+func runImport(args []string) error {
+	fs := flag.NewFlagSet("import", flag.ExitOnError)
+	crops := fs.String("crops", "", "folder of labelled crops")
+	dir := fs.String("dir", "", "folder of the frames the crops were exported from")
+	manifest := fs.String("manifest", "", "manifest file to write")
+	_ = fs.Parse(args)
+	if *crops == "" || *dir == "" || *manifest == "" {
+		fmt.Fprintln(os.Stderr, usage)
+		os.Exit(2)
+	}
+	m, err := export.ImportLabels(*crops, *dir, filepath.Dir(*manifest))
+	if err != nil {
+		return err
+	}
+	if err := m.Save(*manifest); err != nil {
+		return err
+	}
+	fmt.Printf("wrote %v labelled frames to %v\n", len(m.Images), *manifest)
+	return nil
+}
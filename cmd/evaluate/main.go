@@ -0,0 +1,59 @@
+// Package main runs the prefilter over a labelled dataset and reports its precision, recall and F1.
+//
+// The dataset is a JSON manifest of images with their expected label, and optionally the boxes of the
+// interesting objects in them. The prefilter is set up from a JSON file of the service attributes.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"go.viam.com/rdk/logging"
+
+	"github.com/viamrobotics/ocean-prefilter/evaluation"
+)
+
+func main() {
+	manifest := flag.String("manifest", "", "JSON manifest of the labelled images")
+	config := flag.String("config", "", "JSON file with the attributes of the service, the defaults if not set")
+	model := flag.String("model", "", "XGBoost model to evaluate, a JSON dump or a model saved with save_model as JSON or UBJSON, instead of the model_path of the config")
+	jsonOut := flag.String("json", "", "file to write the full report to as JSON")
+	csvOut := flag.String("csv", "", "file to write the result of every image to as CSV")
+	flag.Parse()
+	if *manifest == "" {
+		fmt.Fprintln(os.Stderr, "usage: evaluate -manifest dataset.json [-config attributes.json] [-model model.json] [-json report.json] [-csv results.csv]")
+		os.Exit(2)
+	}
+	if err := run(*manifest, *config, *model, *jsonOut, *csvOut); err != nil {
+		fmt.Fprintln(os.Stderr, "evaluate:", err)
+		os.Exit(1)
+	}
+}
+
+func run(manifestPath, configPath, modelPath, jsonOut, csvOut string) error {
+	m, err := evaluation.LoadManifest(manifestPath)
+	if err != nil {
+		return err
+	}
+	rc, err := evaluation.LoadRunConfig(configPath, modelPath, logging.NewLogger("evaluate"))
+	if err != nil {
+		return err
+	}
+	report, err := evaluation.Evaluate(m, rc)
+	if err != nil {
+		return err
+	}
+	if jsonOut != "" {
+		if err := evaluation.WriteFile(jsonOut, report.WriteJSON); err != nil {
+			return err
+		}
+	}
+	if csvOut != "" {
+		if err := evaluation.WriteFile(csvOut, report.WriteCSV); err != nil {
+			return err
+		}
+	}
+	fmt.Print(report)
+	return nil
+}
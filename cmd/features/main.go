@@ -0,0 +1,89 @@
+// Package main writes the feature vector of every patch of a folder of images, as LIBSVM and CSV rows, to retrain
+// the model with exactly the preprocessing of the prefilter: the horizon, the excluded regions, the patches and
+// the average pooling all come from the service attributes.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/pkg/errors"
+	"go.viam.com/rdk/logging"
+
+	"github.com/viamrobotics/ocean-prefilter/evaluation"
+	"github.com/viamrobotics/ocean-prefilter/export"
+)
+
+func main() {
+	dir := flag.String("dir", "", "folder of JPEG and PNG images, searched recursively")
+	config := flag.String("config", "", "JSON file with the attributes of the service, the defaults if not set")
+	label := flag.Int("label", 0, "label of every row, such as 1 for a folder of interesting images and 0 for water")
+	libsvmOut := flag.String("libsvm", "", "file to write the LIBSVM rows to")
+	csvOut := flag.String("csv", "", "file to write the CSV rows to")
+	flag.Parse()
+	if *dir == "" || (*libsvmOut == "" && *csvOut == "") {
+		fmt.Fprintln(os.Stderr, "usage: features -dir images [-config attributes.json] [-label n] [-libsvm patches.libsvm] [-csv patches.csv]")
+		os.Exit(2)
+	}
+	if err := run(*dir, *config, *label, *libsvmOut, *csvOut); err != nil {
+		fmt.Fprintln(os.Stderr, "features:", err)
+		os.Exit(1)
+	}
+}
+
+func run(dir, configPath string, label int, libsvmOut, csvOut string) error {
+	rc, err := evaluation.LoadRunConfig(configPath, "", logging.NewLogger("features"))
+	if err != nil {
+		return err
+	}
+	// the files are closed explicitly, as an error closing them means the rows were not all written
+	var files []*os.File
+	closeFiles := func() error {
+		var closeErr error
+		for _, f := range files {
+			if err := f.Close(); err != nil && closeErr == nil {
+				closeErr = errors.Wrapf(err, "unable to write %q", f.Name())
+			}
+		}
+		files = nil
+		return closeErr
+	}
+	defer closeFiles()
+	create := func(path string) (io.Writer, error) {
+		if path == "" {
+			return nil, nil
+		}
+		f, err := os.Create(path)
+		if err != nil {
+			return nil, errors.Wrapf(err, "unable to create %q", path)
+		}
+		files = append(files, f)
+		return f, nil
+	}
+	libsvm, err := create(libsvmOut)
+	if err != nil {
+		return err
+	}
+	csv, err := create(csvOut)
+	if err != nil {
+		return err
+	}
+	fw, err := export.NewFeatureWriter(libsvm, csv, rc.NumFeatures())
+	if err != nil {
+		return err
+	}
+	images, patches, skipped, err := export.ExportDir(dir, rc, label, fw)
+	if err != nil {
+		return err
+	}
+	if err := closeFiles(); err != nil {
+		return err
+	}
+	for _, s := range skipped {
+		fmt.Printf("skipped %v: %v\n", s.Path, s.Error)
+	}
+	fmt.Printf("wrote %v patches of %v images (%v skipped)\n", patches, images, len(skipped))
+	return nil
+}
@@ -0,0 +1,67 @@
+// Package main sweeps the threshold of the prefilter from 0 to 1 over a labelled dataset, to pick the
+// threshold to deploy.
+//
+// Every image of the manifest is scored once, and the ROC and precision-recall curves are counted from those
+// scores. The recommended threshold is the one with the best recall within the target false positive rate.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"go.viam.com/rdk/logging"
+
+	"github.com/viamrobotics/ocean-prefilter/evaluation"
+)
+
+func main() {
+	manifest := flag.String("manifest", "", "JSON manifest of the labelled images")
+	config := flag.String("config", "", "JSON file with the attributes of the service, the defaults if not set")
+	model := flag.String("model", "", "XGBoost model to evaluate, a JSON dump or a model saved with save_model as JSON or UBJSON, instead of the model_path of the config")
+	steps := flag.Int("steps", evaluation.DefaultSweepSteps, "number of steps to sweep the threshold from 0 to 1 in")
+	targetFPR := flag.Float64("target-fpr", 0.05, "highest false positive rate of the recommended threshold")
+	jsonOut := flag.String("json", "", "file to write the curves, operating point and image scores to as JSON")
+	csvOut := flag.String("csv", "", "file to write the curve points to as CSV")
+	flag.Parse()
+	if *manifest == "" {
+		fmt.Fprintln(os.Stderr, "usage: sweep -manifest dataset.json [-config attributes.json] [-model model.json] "+
+			"[-steps n] [-target-fpr rate] [-json sweep.json] [-csv curves.csv]")
+		os.Exit(2)
+	}
+	if err := run(*manifest, *config, *model, *steps, *targetFPR, *jsonOut, *csvOut); err != nil {
+		fmt.Fprintln(os.Stderr, "sweep:", err)
+		os.Exit(1)
+	}
+}
+
+func run(manifestPath, configPath, modelPath string, steps int, targetFPR float64, jsonOut, csvOut string) error {
+	m, err := evaluation.LoadManifest(manifestPath)
+	if err != nil {
+		return err
+	}
+	rc, err := evaluation.LoadRunConfig(configPath, modelPath, logging.NewLogger("sweep"))
+	if err != nil {
+		return err
+	}
+	scores, err := evaluation.ScoreImages(m, rc)
+	if err != nil {
+		return err
+	}
+	sweep, err := evaluation.NewSweep(scores, steps, targetFPR)
+	if err != nil {
+		return err
+	}
+	if jsonOut != "" {
+		if err := evaluation.WriteFile(jsonOut, sweep.WriteJSON); err != nil {
+			return err
+		}
+	}
+	if csvOut != "" {
+		if err := evaluation.WriteFile(csvOut, sweep.WriteCSV); err != nil {
+			return err
+		}
+	}
+	fmt.Print(sweep)
+	return nil
+}
@@ -0,0 +1,155 @@
+// Package main compiles the trees of an XGBoost JSON dump into Go code, for use with go generate.
+//
+// Every tree becomes a function of nested if/else statements over a dense []float32 feature vector, in which
+// missing features are NaN, and one scoring function adds up the trees of each class in the order of the dump,
+// so the scores come out exactly like the ones of the interpreted model.
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"go/format"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/viamrobotics/ocean-prefilter/internal/xgbdump"
+)
+
+func main() {
+	in := flag.String("in", "", "XGBoost JSON dump to compile")
+	out := flag.String("out", "", "Go file to write")
+	pkg := flag.String("package", os.Getenv("GOPACKAGE"), "package of the generated file")
+	prefix := flag.String("prefix", "compiledModel", "prefix of the names of the generated functions")
+	numClasses := flag.Int("classes", 2, "number of classes of the model")
+	flag.Parse()
+	if *in == "" || *out == "" || *pkg == "" {
+		fmt.Fprintln(os.Stderr, "usage: xgbgen -in dump.json -out model_gen.go [-package name] [-prefix name] [-classes n]")
+		os.Exit(2)
+	}
+	if err := run(*in, *out, *pkg, *prefix, *numClasses); err != nil {
+		fmt.Fprintln(os.Stderr, "xgbgen:", err)
+		os.Exit(1)
+	}
+}
+
+func run(in, out, pkg, prefix string, numClasses int) error {
+	data, err := os.ReadFile(in)
+	if err != nil {
+		return errors.Wrapf(err, "unable to read model file %q", in)
+	}
+	src, err := generate(data, filepath.Base(in), pkg, prefix, numClasses)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(out, src, 0o644)
+}
+
+// generate returns the formatted Go source of the compiled model
+func generate(data []byte, name, pkg, prefix string, numClasses int) ([]byte, error) {
+	var trees []*xgbdump.Node
+	if err := json.Unmarshal(data, &trees); err != nil {
+		return nil, errors.Wrap(err, "model is not a valid XGBoost JSON dump")
+	}
+	if numClasses <= 0 {
+		return nil, errors.Errorf("number of classes must be positive, got %v", numClasses)
+	}
+	if len(trees) == 0 || len(trees)%numClasses != 0 {
+		return nil, errors.Errorf("model has %v trees, which is not a multiple of the %v classes", len(trees), numClasses)
+	}
+
+	var body bytes.Buffer
+	maxFeature := -1
+	for i, tree := range trees {
+		fmt.Fprintf(&body, "\nfunc %vTree%v(f []float32) float32 {\n", prefix, i)
+		treeMax, err := writeNode(&body, tree, 1)
+		if err != nil {
+			return nil, errors.Wrapf(err, "error in tree %v of model", i)
+		}
+		if treeMax > maxFeature {
+			maxFeature = treeMax
+		}
+		body.WriteString("}\n")
+	}
+
+	digest := sha256.Sum256(data)
+	var src bytes.Buffer
+	fmt.Fprintf(&src, "// Code generated by xgbgen from %v. DO NOT EDIT.\n\n", name)
+	fmt.Fprintf(&src, "package %v\n\n", pkg)
+	fmt.Fprintf(&src, "// %vDigest is the SHA-256 of the dump the model was compiled from\n", prefix)
+	fmt.Fprintf(&src, "const %vDigest = %q\n\n", prefix, hex.EncodeToString(digest[:]))
+	fmt.Fprintf(&src, "// %vNumFeatures is the number of features the compiled model reads\n", prefix)
+	fmt.Fprintf(&src, "const %vNumFeatures = %v\n\n", prefix, maxFeature+1)
+	fmt.Fprintf(&src, "// %vScores adds up the scores of the trees of every class.\n", prefix)
+	fmt.Fprintf(&src, "// features must hold at least %vNumFeatures features.\n", prefix)
+	fmt.Fprintf(&src, "func %vScores(features []float32) (scores [%v]float32) {\n", prefix, numClasses)
+	if maxFeature >= 0 {
+		fmt.Fprintf(&src, "_ = features[%v]\n", maxFeature)
+	}
+	for i := range trees {
+		fmt.Fprintf(&src, "scores[%v] += %vTree%v(features)\n", i%numClasses, prefix, i)
+	}
+	src.WriteString("return scores\n}\n")
+	src.Write(body.Bytes())
+
+	formatted, err := format.Source(src.Bytes())
+	if err != nil {
+		return nil, errors.Wrap(err, "generated code doesn't compile")
+	}
+	return formatted, nil
+}
+
+// writeNode writes the statements of a node and returns the largest feature index its subtree splits on.
+// A missing feature is a NaN, which fails every comparison, so the condition is written the way around
+// that sends a NaN down the missing branch.
+func writeNode(buf *bytes.Buffer, node *xgbdump.Node, depth int) (int, error) {
+	indent := strings.Repeat("\t", depth)
+	if node == nil {
+		return 0, errors.New("tree has an empty node")
+	}
+	if len(node.Children) == 0 {
+		fmt.Fprintf(buf, "%vreturn %v\n", indent, formatFloat(node.Leaf))
+		return -1, nil
+	}
+	children := map[int]*xgbdump.Node{}
+	for _, child := range node.Children {
+		if child != nil {
+			children[child.NodeID] = child
+		}
+	}
+	yes, no := children[node.Yes], children[node.No]
+	if yes == nil || no == nil || (node.Missing != node.Yes && node.Missing != node.No) {
+		return 0, errors.Errorf("node %v doesn't point at its own children", node.NodeID)
+	}
+	feature, err := xgbdump.SplitFeature(node.Split)
+	if err != nil {
+		return 0, err
+	}
+	threshold := formatFloat(node.SplitCondition)
+	if node.Missing == node.Yes {
+		fmt.Fprintf(buf, "%vif !(f[%v] >= %v) {\n", indent, feature, threshold)
+	} else {
+		fmt.Fprintf(buf, "%vif f[%v] < %v {\n", indent, feature, threshold)
+	}
+	yesMax, err := writeNode(buf, yes, depth+1)
+	if err != nil {
+		return 0, err
+	}
+	fmt.Fprintf(buf, "%v}\n", indent)
+	noMax, err := writeNode(buf, no, depth)
+	if err != nil {
+		return 0, err
+	}
+	return max(feature, yesMax, noMax), nil
+}
+
+// formatFloat writes the float32 as the shortest constant that converts back to it exactly
+func formatFloat(v float32) string {
+	return strconv.FormatFloat(float64(v), 'g', -1, 32)
+}
@@ -0,0 +1,35 @@
+package evaluation
+
+import (
+	"encoding/json"
+	"os"
+
+	"github.com/pkg/errors"
+	"go.viam.com/rdk/logging"
+
+	"github.com/viamrobotics/ocean-prefilter/oceanprefilter"
+)
+
+// LoadRunConfig sets up the prefilter from a JSON file of the service attributes, or from the defaults
+// if configPath is empty. A modelPath that is not empty replaces the model_path of the attributes.
+// The images are scored as stills, without motion detection or horizon tracking.
+func LoadRunConfig(configPath, modelPath string, logger logging.Logger) (oceanprefilter.RunConfig, error) {
+	cfg := &oceanprefilter.Config{}
+	if configPath != "" {
+		data, err := os.ReadFile(configPath)
+		if err != nil {
+			return oceanprefilter.RunConfig{}, errors.Wrapf(err, "unable to read config %q", configPath)
+		}
+		if err := json.Unmarshal(data, cfg); err != nil {
+			return oceanprefilter.RunConfig{}, errors.Wrapf(err, "config %q is not valid JSON", configPath)
+		}
+	}
+	if modelPath != "" {
+		cfg.ModelPath = modelPath
+	}
+	rc, err := oceanprefilter.NewRunConfig(cfg, logger)
+	if err != nil {
+		return oceanprefilter.RunConfig{}, err
+	}
+	return rc.ForStills(), nil
+}
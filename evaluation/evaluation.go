@@ -0,0 +1,197 @@
+package evaluation
+
+import (
+	"image"
+	// decoders for the images of the dataset
+	_ "image/jpeg"
+	_ "image/png"
+	"os"
+
+	"github.com/pkg/errors"
+
+	"github.com/viamrobotics/ocean-prefilter/oceanprefilter"
+)
+
+// Result is the outcome of the prefilter on one image of the dataset
+type Result struct {
+	Path       string  `json:"path"`
+	Label      string  `json:"label"`
+	Triggered  bool    `json:"triggered"`
+	Correct    bool    `json:"correct"`
+	Confidence float64 `json:"confidence"`
+	// Detections are the boxes of the patches that triggered
+	Detections [][]int `json:"detections,omitempty"`
+	// Boxes is the number of labelled boxes, and BoxesHit how many of them overlap a detection
+	Boxes    int `json:"boxes"`
+	BoxesHit int `json:"boxes_hit"`
+	// Error is set if the image could not be read or scored. An image that was read but could not be scored,
+	// such as one without a visible horizon, doesn't trigger, like the service with such a frame.
+	Error string `json:"error,omitempty"`
+	// Unreadable is set if the image could not be read, the image is then left out of the metrics
+	Unreadable bool `json:"unreadable,omitempty"`
+}
+
+// Summary holds the metrics over the images that were read, with "interesting" as the positive class.
+// Unreadable images are left out of the metrics, and Unscored images are in them as not triggered.
+type Summary struct {
+	Images         int     `json:"images"`
+	Unreadable     int     `json:"unreadable"`
+	Unscored       int     `json:"unscored"`
+	TruePositives  int     `json:"true_positives"`
+	FalsePositives int     `json:"false_positives"`
+	TrueNegatives  int     `json:"true_negatives"`
+	FalseNegatives int     `json:"false_negatives"`
+	Precision      float64 `json:"precision"`
+	Recall         float64 `json:"recall"`
+	F1             float64 `json:"f1"`
+	Accuracy       float64 `json:"accuracy"`
+	// Boxes is the number of labelled boxes over all scored images, and BoxRecall the share of them
+	// that overlap a detection
+	Boxes     int     `json:"boxes"`
+	BoxesHit  int     `json:"boxes_hit"`
+	BoxRecall float64 `json:"box_recall"`
+}
+
+// ConfusionMatrix counts the images by expected label, the rows, and predicted label, the columns
+type ConfusionMatrix struct {
+	Labels []string `json:"labels"`
+	Counts [][]int  `json:"counts"`
+}
+
+// Report is the evaluation of a dataset
+type Report struct {
+	Summary         Summary         `json:"summary"`
+	ConfusionMatrix ConfusionMatrix `json:"confusion_matrix"`
+	Results         []Result        `json:"results"`
+}
+
+// Evaluate runs the prefilter with rc on every image of the manifest and reports how well its triggers
+// match the labels. The images are scored as stills, on their own, so the order of the manifest doesn't matter.
+// An image that can't be scored, such as one without a visible horizon, is reported with its error and counts
+// as not triggered, as the service never triggers on such a frame. Only an image that can't be read is left out of the metrics.
+func Evaluate(m *Manifest, rc oceanprefilter.RunConfig) (*Report, error) {
+	if rc.Model == nil {
+		return nil, errors.New("run config has no model to evaluate")
+	}
+	rc = rc.ForStills()
+	report := &Report{Results: make([]Result, 0, len(m.Images))}
+	for _, e := range m.Images {
+		report.Results = append(report.Results, evaluateImage(m.resolve(e.Path), e, rc))
+	}
+	report.summarize()
+	return report, nil
+}
+
+// evaluateImage scores a single image of the dataset
+func evaluateImage(path string, e Entry, rc oceanprefilter.RunConfig) Result {
+	res := Result{Path: e.Path, Label: e.Label}
+	if err := res.score(path, e, rc); err != nil {
+		res.Error = err.Error()
+		if res.Unreadable {
+			return res
+		}
+	}
+	res.Correct = res.Triggered == (e.Label == LabelInteresting)
+	return res
+}
+
+// score runs the prefilter on the image and fills in what it found
+func (res *Result) score(path string, e Entry, rc oceanprefilter.RunConfig) error {
+	boxes, err := e.boxes()
+	if err != nil {
+		res.Unreadable = true
+		return err
+	}
+	res.Boxes = len(boxes)
+	inf, read, err := scoreImage(path, rc)
+	if err != nil {
+		res.Unreadable = !read
+		return err
+	}
+	res.Triggered = inf.Triggered
+	res.Confidence = inf.Confidence
+	for _, d := range inf.Detections {
+		b := d.BoundingBox()
+		res.Detections = append(res.Detections, []int{b.Min.X, b.Min.Y, b.Max.X, b.Max.Y})
+	}
+	res.BoxesHit = boxesHit(boxes, inf)
+	return nil
+}
+
+// readImage decodes the image at path
+func readImage(path string) (image.Image, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, errors.Wrapf(err, "unable to open image %q", path)
+	}
+	defer f.Close()
+	img, _, err := image.Decode(f)
+	if err != nil {
+		return nil, errors.Wrapf(err, "unable to decode image %q", path)
+	}
+	return img, nil
+}
+
+// boxesHit counts the labelled boxes that overlap any of the detections
+func boxesHit(boxes []image.Rectangle, inf oceanprefilter.Inference) int {
+	hit := 0
+	for _, b := range boxes {
+		for _, d := range inf.Detections {
+			if b.Overlaps(*d.BoundingBox()) {
+				hit++
+				break
+			}
+		}
+	}
+	return hit
+}
+
+// summarize fills in the summary and confusion matrix from the results
+func (r *Report) summarize() {
+	s := Summary{Images: len(r.Results)}
+	for _, res := range r.Results {
+		if res.Unreadable {
+			s.Unreadable++
+			continue
+		}
+		if res.Error != "" {
+			s.Unscored++
+		}
+		interesting := res.Label == LabelInteresting
+		switch {
+		case interesting && res.Triggered:
+			s.TruePositives++
+		case interesting:
+			s.FalseNegatives++
+		case res.Triggered:
+			s.FalsePositives++
+		default:
+			s.TrueNegatives++
+		}
+		s.Boxes += res.Boxes
+		s.BoxesHit += res.BoxesHit
+	}
+	s.Precision = ratio(s.TruePositives, s.TruePositives+s.FalsePositives)
+	s.Recall = ratio(s.TruePositives, s.TruePositives+s.FalseNegatives)
+	if s.Precision+s.Recall > 0 {
+		s.F1 = 2 * s.Precision * s.Recall / (s.Precision + s.Recall)
+	}
+	s.Accuracy = ratio(s.TruePositives+s.TrueNegatives, s.Images-s.Unreadable)
+	s.BoxRecall = ratio(s.BoxesHit, s.Boxes)
+	r.Summary = s
+	r.ConfusionMatrix = ConfusionMatrix{
+		Labels: []string{LabelBoring, LabelInteresting},
+		Counts: [][]int{
+			{s.TrueNegatives, s.FalsePositives},
+			{s.FalseNegatives, s.TruePositives},
+		},
+	}
+}
+
+// ratio is n/d, or 0 if there is nothing to divide by
+func ratio(n, d int) float64 {
+	if d == 0 {
+		return 0
+	}
+	return float64(n) / float64(d)
+}
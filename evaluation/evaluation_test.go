@@ -0,0 +1,308 @@
+package evaluation
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"image"
+	"image/draw"
+	"image/png"
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"go.viam.com/rdk/logging"
+	"go.viam.com/test"
+
+	"github.com/viamrobotics/ocean-prefilter/oceanprefilter"
+)
+
+// writeManifest writes the entries as a manifest in a new directory and returns its path
+func writeManifest(t *testing.T, entries []Entry) string {
+	t.Helper()
+	data, err := json.Marshal(Manifest{Images: entries})
+	test.That(t, err, test.ShouldBeNil)
+	path := filepath.Join(t.TempDir(), "manifest.json")
+	test.That(t, os.WriteFile(path, data, 0o644), test.ShouldBeNil)
+	return path
+}
+
+// writeNoHorizon writes a frame too small to find the horizon in, like a frame in fog, and returns its path
+func writeNoHorizon(t *testing.T) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "fog.png")
+	f, err := os.Create(path)
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, png.Encode(f, image.NewGray(image.Rect(0, 0, 4, 4))), test.ShouldBeNil)
+	test.That(t, f.Close(), test.ShouldBeNil)
+	return path
+}
+
+func TestLoadManifest(t *testing.T) {
+	image, err := filepath.Abs("../oceanprefilter/test_data/2288.jpg")
+	test.That(t, err, test.ShouldBeNil)
+	path := writeManifest(t, []Entry{
+		{Path: image, Label: LabelInteresting, Boxes: [][]int{{0, 0, 10, 10}}},
+		{Path: "relative.jpg", Label: LabelBoring},
+	})
+	m, err := LoadManifest(path)
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, m.Images, test.ShouldHaveLength, 2)
+	test.That(t, m.resolve(m.Images[0].Path), test.ShouldEqual, image)
+	test.That(t, m.resolve(m.Images[1].Path), test.ShouldEqual, filepath.Join(filepath.Dir(path), "relative.jpg"))
+
+	_, err = LoadManifest(filepath.Join(t.TempDir(), "missing.json"))
+	test.That(t, err, test.ShouldNotBeNil)
+	_, err = LoadManifest(writeManifest(t, nil))
+	test.That(t, err.Error(), test.ShouldContainSubstring, "no images")
+	_, err = LoadManifest(writeManifest(t, []Entry{{Path: image, Label: "maybe"}}))
+	test.That(t, err.Error(), test.ShouldContainSubstring, "label \"maybe\"")
+	_, err = LoadManifest(writeManifest(t, []Entry{{Label: LabelBoring}}))
+	test.That(t, err.Error(), test.ShouldContainSubstring, "no path")
+	_, err = LoadManifest(writeManifest(t, []Entry{{Path: image, Label: LabelBoring, Boxes: [][]int{{1, 2, 3}}}}))
+	test.That(t, err.Error(), test.ShouldContainSubstring, "four numbers")
+	_, err = LoadManifest(writeManifest(t, []Entry{{Path: image, Label: LabelBoring, Boxes: [][]int{{5, 5, 5, 9}}}}))
+	test.That(t, err.Error(), test.ShouldContainSubstring, "empty")
+}
+
+func TestEvaluate(t *testing.T) {
+	rc, err := oceanprefilter.NewRunConfig(&oceanprefilter.Config{}, logging.NewTestLogger(t))
+	test.That(t, err, test.ShouldBeNil)
+	fog := writeNoHorizon(t)
+	image, err := filepath.Abs("../oceanprefilter/test_data/2288.jpg")
+	test.That(t, err, test.ShouldBeNil)
+	m, err := LoadManifest(writeManifest(t, []Entry{
+		// the whole frame as one box is hit by any detection, the corner above the horizon by none
+		{Path: image, Label: LabelInteresting, Boxes: [][]int{{0, 0, 100000, 100000}, {0, 0, 1, 1}}},
+		{Path: image, Label: LabelBoring},
+		{Path: "missing.jpg", Label: LabelInteresting},
+		{Path: fog, Label: LabelInteresting},
+	}))
+	test.That(t, err, test.ShouldBeNil)
+
+	// every patch triggers with a threshold of 0
+	rc.Threshold = 0
+	report, err := Evaluate(m, rc)
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, report.Results, test.ShouldHaveLength, 4)
+	hit := report.Results[0]
+	test.That(t, hit.Triggered, test.ShouldBeTrue)
+	test.That(t, hit.Correct, test.ShouldBeTrue)
+	test.That(t, hit.Detections, test.ShouldNotBeEmpty)
+	test.That(t, hit.Boxes, test.ShouldEqual, 2)
+	test.That(t, hit.BoxesHit, test.ShouldEqual, 1)
+	test.That(t, report.Results[1].Correct, test.ShouldBeFalse)
+	test.That(t, report.Results[2].Error, test.ShouldContainSubstring, "missing.jpg")
+	test.That(t, report.Results[2].Unreadable, test.ShouldBeTrue)
+	// the frame without a horizon never triggers, like in the service, so it is a miss even at a threshold of 0
+	test.That(t, report.Results[3].Error, test.ShouldContainSubstring, "fog.png")
+	test.That(t, report.Results[3].Unreadable, test.ShouldBeFalse)
+	test.That(t, report.Results[3].Triggered, test.ShouldBeFalse)
+	test.That(t, report.Results[3].Correct, test.ShouldBeFalse)
+	test.That(t, report.Summary, test.ShouldResemble, Summary{
+		Images: 4, Unreadable: 1, Unscored: 1, TruePositives: 1, FalsePositives: 1, FalseNegatives: 1,
+		Precision: 0.5, Recall: 0.5, F1: 0.5, Accuracy: 1.0 / 3,
+		Boxes: 2, BoxesHit: 1, BoxRecall: 0.5,
+	})
+	test.That(t, report.ConfusionMatrix.Counts, test.ShouldResemble, [][]int{{0, 1}, {1, 1}})
+
+	// and none with a threshold above 1
+	rc.Threshold = 1.1
+	report, err = Evaluate(m, rc)
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, report.Results[0].Detections, test.ShouldBeEmpty)
+	test.That(t, report.Summary.TrueNegatives, test.ShouldEqual, 1)
+	test.That(t, report.Summary.FalseNegatives, test.ShouldEqual, 2)
+	test.That(t, report.Summary.Precision, test.ShouldEqual, 0)
+	test.That(t, report.Summary.F1, test.ShouldEqual, 0)
+	test.That(t, report.ConfusionMatrix.Counts, test.ShouldResemble, [][]int{{1, 0}, {2, 0}})
+
+	rc.Model = nil
+	_, err = Evaluate(m, rc)
+	test.That(t, err, test.ShouldNotBeNil)
+}
+
+func TestWriteReport(t *testing.T) {
+	report := &Report{Results: []Result{
+		{Path: "a.jpg", Label: LabelInteresting, Triggered: true, Correct: true, Confidence: 0.75, Detections: [][]int{{0, 0, 2, 2}}},
+		{Path: "b.jpg", Label: LabelBoring, Error: "unable to decode image", Unreadable: true},
+	}}
+	report.summarize()
+
+	var buf bytes.Buffer
+	test.That(t, report.WriteCSV(&buf), test.ShouldBeNil)
+	rows, err := csv.NewReader(&buf).ReadAll()
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, rows, test.ShouldResemble, [][]string{
+		csvHeader,
+		{"a.jpg", "interesting", "true", "0.7500", "true", "1", "0", "0", ""},
+		{"b.jpg", "boring", "false", "0.0000", "false", "0", "0", "0", "unable to decode image"},
+	})
+
+	buf.Reset()
+	test.That(t, report.WriteJSON(&buf), test.ShouldBeNil)
+	var decoded Report
+	test.That(t, json.Unmarshal(buf.Bytes(), &decoded), test.ShouldBeNil)
+	test.That(t, decoded, test.ShouldResemble, *report)
+
+	test.That(t, report.String(), test.ShouldContainSubstring, "precision: 1.0000")
+	test.That(t, report.String(), test.ShouldContainSubstring, "images:    2 (1 unreadable, 0 not scored)")
+}
+
+func TestSweep(t *testing.T) {
+	scores := []ImageScore{
+		{Label: LabelInteresting, Score: 0.9},
+		{Label: LabelInteresting, Score: 0.6},
+		{Label: LabelInteresting, Score: 0.3},
+		{Label: LabelBoring, Score: 0.7},
+		{Label: LabelBoring, Score: 0.2},
+		{Label: LabelBoring, Score: 0.1},
+		{Label: LabelBoring, Score: 0.6},
+		{Label: LabelInteresting, Error: "unable to decode image", Unreadable: true},
+	}
+	sweep, err := NewSweep(scores, 10, 0.25)
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, sweep.Unreadable, test.ShouldEqual, 1)
+	test.That(t, sweep.Unscored, test.ShouldEqual, 0)
+	test.That(t, sweep.Points, test.ShouldHaveLength, 11)
+	// everything triggers at 0 and nothing at 1
+	test.That(t, sweep.Points[0].TruePositiveRate, test.ShouldEqual, 1)
+	test.That(t, sweep.Points[0].FalsePositiveRate, test.ShouldEqual, 1)
+	test.That(t, sweep.Points[10].TruePositives, test.ShouldEqual, 0)
+	test.That(t, sweep.Points[10].FalsePositives, test.ShouldEqual, 0)
+	half := sweep.Points[5]
+	test.That(t, half.F1, test.ShouldAlmostEqual, 4.0/7)
+	half.F1 = 0
+	test.That(t, half, test.ShouldResemble, CurvePoint{
+		Threshold: 0.5, TruePositives: 2, FalsePositives: 2, TrueNegatives: 2, FalseNegatives: 1,
+		TruePositiveRate: 2.0 / 3, FalsePositiveRate: 0.5, Precision: 0.5,
+	})
+	// a 0.6 negative ties with a 0.6 positive
+	test.That(t, sweep.AUC, test.ShouldAlmostEqual, (4+2.5+2)/12.0)
+	// 0.7 is the lowest threshold with one false positive in four, and 0.8 has the same recall without it
+	test.That(t, sweep.Points[7].FalsePositiveRate, test.ShouldEqual, 0.25)
+	test.That(t, sweep.OperatingPoint, test.ShouldNotBeNil)
+	test.That(t, sweep.OperatingPoint.Threshold, test.ShouldAlmostEqual, 0.8)
+	test.That(t, sweep.OperatingPoint.FalsePositiveRate, test.ShouldEqual, 0)
+	test.That(t, sweep.OperatingPoint.TruePositiveRate, test.ShouldAlmostEqual, 1.0/3)
+
+	// an image without a score never triggers, not even at a threshold of 0
+	sweep, err = NewSweep([]ImageScore{
+		{Label: LabelInteresting, Score: 0.9},
+		{Label: LabelInteresting, Error: "unable to score image"},
+		{Label: LabelBoring, Score: 0.1},
+	}, 2, 1)
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, sweep.Unscored, test.ShouldEqual, 1)
+	test.That(t, sweep.Points[0].TruePositives, test.ShouldEqual, 1)
+	test.That(t, sweep.Points[0].FalseNegatives, test.ShouldEqual, 1)
+	test.That(t, sweep.Points[0].FalsePositives, test.ShouldEqual, 1)
+	test.That(t, sweep.Points[1].FalseNegatives, test.ShouldEqual, 1)
+	test.That(t, sweep.AUC, test.ShouldEqual, 0.5)
+	test.That(t, sweep.String(), test.ShouldContainSubstring, "images:    3 (0 unreadable, 1 not scored)")
+
+	sweep, err = NewSweep(scores[:1], 4, 0)
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, sweep.AUC, test.ShouldEqual, 0)
+	test.That(t, sweep.OperatingPoint.Threshold, test.ShouldEqual, 0)
+
+	_, err = NewSweep(scores, 0, 0.1)
+	test.That(t, err, test.ShouldNotBeNil)
+	_, err = NewSweep(scores, 10, 1.5)
+	test.That(t, err, test.ShouldNotBeNil)
+
+	var buf bytes.Buffer
+	test.That(t, sweep.WriteCSV(&buf), test.ShouldBeNil)
+	rows, err := csv.NewReader(&buf).ReadAll()
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, rows, test.ShouldHaveLength, 6)
+	test.That(t, rows[0], test.ShouldResemble, sweepCSVHeader)
+	test.That(t, rows[2][0], test.ShouldEqual, "0.25")
+}
+
+func TestScoreImages(t *testing.T) {
+	rc, err := oceanprefilter.NewRunConfig(&oceanprefilter.Config{}, logging.NewTestLogger(t))
+	test.That(t, err, test.ShouldBeNil)
+	image, err := filepath.Abs("../oceanprefilter/test_data/2288.jpg")
+	test.That(t, err, test.ShouldBeNil)
+	m, err := LoadManifest(writeManifest(t, []Entry{
+		{Path: image, Label: LabelInteresting},
+		{Path: "missing.jpg", Label: LabelBoring},
+		{Path: writeNoHorizon(t), Label: LabelInteresting},
+	}))
+	test.That(t, err, test.ShouldBeNil)
+
+	scores, err := ScoreImages(m, rc)
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, scores, test.ShouldHaveLength, 3)
+	test.That(t, scores[1].Error, test.ShouldContainSubstring, "missing.jpg")
+	test.That(t, scores[1].Unreadable, test.ShouldBeTrue)
+	test.That(t, scores[2].Error, test.ShouldContainSubstring, "fog.png")
+	test.That(t, scores[2].Unreadable, test.ShouldBeFalse)
+	test.That(t, scores[2].Score, test.ShouldEqual, 0)
+	score := scores[0].Score
+	test.That(t, score, test.ShouldBeGreaterThan, 0)
+
+	// the image triggers live at every threshold up to its score, and not above it
+	rc.Threshold = score
+	report, err := Evaluate(m, rc)
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, report.Results[0].Triggered, test.ShouldBeTrue)
+	test.That(t, report.Results[0].Confidence, test.ShouldEqual, score)
+	rc.Threshold = math.Nextafter(score, 2)
+	report, err = Evaluate(m, rc)
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, report.Results[0].Triggered, test.ShouldBeFalse)
+}
+
+func TestMotionLeftOut(t *testing.T) {
+	// a second frame with a bright boat in the water, which differs from the first wherever the boat is
+	jpg, err := filepath.Abs("../oceanprefilter/test_data/2288.jpg")
+	test.That(t, err, test.ShouldBeNil)
+	frame, err := readImage(jpg)
+	test.That(t, err, test.ShouldBeNil)
+	boat := image.NewRGBA(frame.Bounds())
+	draw.Draw(boat, boat.Bounds(), frame, frame.Bounds().Min, draw.Src)
+	b := frame.Bounds()
+	draw.Draw(boat, image.Rect(b.Min.X, b.Max.Y-300, b.Max.X, b.Max.Y), image.White, image.Point{}, draw.Src)
+	boatPath := filepath.Join(t.TempDir(), "boat.png")
+	f, err := os.Create(boatPath)
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, png.Encode(f, boat), test.ShouldBeNil)
+	test.That(t, f.Close(), test.ShouldBeNil)
+	entries := []Entry{{Path: jpg, Label: LabelBoring}, {Path: boatPath, Label: LabelInteresting}}
+	forward, err := LoadManifest(writeManifest(t, entries))
+	test.That(t, err, test.ShouldBeNil)
+	backward, err := LoadManifest(writeManifest(t, []Entry{entries[1], entries[0]}))
+	test.That(t, err, test.ShouldBeNil)
+
+	// the images of a dataset are unrelated, so neither differs from the one before it
+	for _, mode := range []string{oceanprefilter.MotionModeTrigger, oceanprefilter.MotionModeGate} {
+		cfg := &oceanprefilter.Config{TriggerOnMotion: true, MotionMode: mode}
+		rc, err := oceanprefilter.NewRunConfig(cfg, logging.NewTestLogger(t))
+		test.That(t, err, test.ShouldBeNil)
+		still, err := oceanprefilter.NewRunConfig(&oceanprefilter.Config{}, logging.NewTestLogger(t))
+		test.That(t, err, test.ShouldBeNil)
+
+		want, err := Evaluate(forward, still)
+		test.That(t, err, test.ShouldBeNil)
+		first, err := Evaluate(forward, rc)
+		test.That(t, err, test.ShouldBeNil)
+		second, err := Evaluate(backward, rc)
+		test.That(t, err, test.ShouldBeNil)
+		test.That(t, first.Results, test.ShouldResemble, want.Results)
+		test.That(t, second.Results, test.ShouldResemble, []Result{want.Results[1], want.Results[0]})
+		test.That(t, second.Summary, test.ShouldResemble, first.Summary)
+
+		wantScores, err := ScoreImages(forward, still)
+		test.That(t, err, test.ShouldBeNil)
+		scores, err := ScoreImages(forward, rc)
+		test.That(t, err, test.ShouldBeNil)
+		test.That(t, scores, test.ShouldResemble, wantScores)
+		scores, err = ScoreImages(backward, rc)
+		test.That(t, err, test.ShouldBeNil)
+		test.That(t, scores, test.ShouldResemble, []ImageScore{wantScores[1], wantScores[0]})
+		test.That(t, scores[0].Score, test.ShouldBeLessThan, 1)
+	}
+}
@@ -0,0 +1,109 @@
+// Package evaluation scores a labelled dataset with the prefilter, to compare models and settings before they are deployed
+package evaluation
+
+import (
+	"encoding/json"
+	"image"
+	"os"
+	"path/filepath"
+
+	"github.com/pkg/errors"
+)
+
+// the labels an image of the dataset can have
+const (
+	// LabelInteresting is an image the prefilter should trigger on
+	LabelInteresting = "interesting"
+	// LabelBoring is an image of nothing but water, that the prefilter should not trigger on
+	LabelBoring = "boring"
+)
+
+// Manifest lists the images of a dataset
+type Manifest struct {
+	Images []Entry `json:"images"`
+	// dir is where relative image paths start from, the directory of the manifest file
+	dir string
+}
+
+// Entry is one image of the dataset
+type Entry struct {
+	Path  string `json:"path"`
+	Label string `json:"label"`
+	// Boxes are the interesting objects in the image, as [x_min, y_min, x_max, y_max] in pixels
+	Boxes [][]int `json:"boxes,omitempty"`
+}
+
+// LoadManifest reads a manifest file. Image paths in it are relative to the directory of the manifest.
+func LoadManifest(path string) (*Manifest, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, errors.Wrapf(err, "unable to read manifest %q", path)
+	}
+	var m Manifest
+	if err := json.Unmarshal(data, &m); err != nil {
+		return nil, errors.Wrapf(err, "manifest %q is not valid JSON", path)
+	}
+	m.dir = filepath.Dir(path)
+	if err := m.check(); err != nil {
+		return nil, errors.Wrapf(err, "manifest %q", path)
+	}
+	return &m, nil
+}
+
+// Save writes the manifest to path as indented JSON
+func (m *Manifest) Save(path string) error {
+	if err := m.check(); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(path, append(data, '\n'), 0o644); err != nil {
+		return errors.Wrapf(err, "unable to write manifest %q", path)
+	}
+	return nil
+}
+
+// check makes sure every entry has a path, a known label and well formed boxes
+func (m *Manifest) check() error {
+	if len(m.Images) == 0 {
+		return errors.New("manifest lists no images")
+	}
+	for i, e := range m.Images {
+		if e.Path == "" {
+			return errors.Errorf("image %v has no path", i)
+		}
+		if e.Label != LabelInteresting && e.Label != LabelBoring {
+			return errors.Errorf("image %q has label %q, it must be %q or %q", e.Path, e.Label, LabelInteresting, LabelBoring)
+		}
+		if _, err := e.boxes(); err != nil {
+			return errors.Wrapf(err, "image %q", e.Path)
+		}
+	}
+	return nil
+}
+
+// resolve returns the path of the image, relative to the manifest
+func (m *Manifest) resolve(path string) string {
+	if filepath.IsAbs(path) || m.dir == "" {
+		return path
+	}
+	return filepath.Join(m.dir, path)
+}
+
+// boxes returns the boxes of the entry as rectangles
+func (e Entry) boxes() ([]image.Rectangle, error) {
+	rects := make([]image.Rectangle, 0, len(e.Boxes))
+	for _, b := range e.Boxes {
+		if len(b) != 4 {
+			return nil, errors.Errorf("box %v must be four numbers, [x_min, y_min, x_max, y_max]", b)
+		}
+		r := image.Rect(b[0], b[1], b[2], b[3])
+		if r.Empty() {
+			return nil, errors.Errorf("box %v is empty", b)
+		}
+		rects = append(rects, r)
+	}
+	return rects, nil
+}
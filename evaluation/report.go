@@ -0,0 +1,138 @@
+package evaluation
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// csvHeader are the columns of the per image CSV report
+var csvHeader = []string{"path", "label", "triggered", "confidence", "correct", "detections", "boxes", "boxes_hit", "error"}
+
+// WriteJSON writes the whole report as indented JSON
+func (r *Report) WriteJSON(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(r)
+}
+
+// WriteCSV writes a row for each image, in the order of the manifest
+func (r *Report) WriteCSV(w io.Writer) error {
+	cw := csv.NewWriter(w)
+	if err := cw.Write(csvHeader); err != nil {
+		return err
+	}
+	for _, res := range r.Results {
+		row := []string{
+			res.Path,
+			res.Label,
+			strconv.FormatBool(res.Triggered),
+			strconv.FormatFloat(res.Confidence, 'f', 4, 64),
+			strconv.FormatBool(res.Correct),
+			strconv.Itoa(len(res.Detections)),
+			strconv.Itoa(res.Boxes),
+			strconv.Itoa(res.BoxesHit),
+			res.Error,
+		}
+		if err := cw.Write(row); err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// String summarizes the report in a few lines of text
+func (r *Report) String() string {
+	s := r.Summary
+	var b strings.Builder
+	fmt.Fprintf(&b, "images:    %v (%v unreadable, %v not scored)\n", s.Images, s.Unreadable, s.Unscored)
+	fmt.Fprintf(&b, "precision: %.4f\n", s.Precision)
+	fmt.Fprintf(&b, "recall:    %.4f\n", s.Recall)
+	fmt.Fprintf(&b, "f1:        %.4f\n", s.F1)
+	fmt.Fprintf(&b, "accuracy:  %.4f\n", s.Accuracy)
+	if s.Boxes > 0 {
+		fmt.Fprintf(&b, "boxes hit: %v of %v (%.4f)\n", s.BoxesHit, s.Boxes, s.BoxRecall)
+	}
+	fmt.Fprintf(&b, "%-22v %12v %12v\n", "expected \\ predicted", r.ConfusionMatrix.Labels[0], r.ConfusionMatrix.Labels[1])
+	for i, label := range r.ConfusionMatrix.Labels {
+		fmt.Fprintf(&b, "%-22v %12v %12v\n", label, r.ConfusionMatrix.Counts[i][0], r.ConfusionMatrix.Counts[i][1])
+	}
+	return b.String()
+}
+
+// sweepCSVHeader are the columns of the CSV of the curve points
+var sweepCSVHeader = []string{
+	"threshold", "true_positives", "false_positives", "true_negatives", "false_negatives",
+	"true_positive_rate", "false_positive_rate", "precision", "f1",
+}
+
+// WriteJSON writes the whole sweep as indented JSON
+func (s *Sweep) WriteJSON(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(s)
+}
+
+// WriteCSV writes a row for each threshold, from 0 up
+func (s *Sweep) WriteCSV(w io.Writer) error {
+	cw := csv.NewWriter(w)
+	if err := cw.Write(sweepCSVHeader); err != nil {
+		return err
+	}
+	for _, p := range s.Points {
+		row := []string{
+			strconv.FormatFloat(p.Threshold, 'f', -1, 64),
+			strconv.Itoa(p.TruePositives),
+			strconv.Itoa(p.FalsePositives),
+			strconv.Itoa(p.TrueNegatives),
+			strconv.Itoa(p.FalseNegatives),
+			strconv.FormatFloat(p.TruePositiveRate, 'f', 4, 64),
+			strconv.FormatFloat(p.FalsePositiveRate, 'f', 4, 64),
+			strconv.FormatFloat(p.Precision, 'f', 4, 64),
+			strconv.FormatFloat(p.F1, 'f', 4, 64),
+		}
+		if err := cw.Write(row); err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// String summarizes the sweep with its operating point
+func (s *Sweep) String() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "images:    %v (%v unreadable, %v not scored)\n", len(s.Scores), s.Unreadable, s.Unscored)
+	fmt.Fprintf(&b, "auc:       %.4f\n", s.AUC)
+	p := s.OperatingPoint
+	if p == nil {
+		fmt.Fprintf(&b, "no threshold keeps the false positive rate at or below %.4f\n", s.TargetFalsePositiveRate)
+		return b.String()
+	}
+	fmt.Fprintf(&b, "threshold: %v for a false positive rate of at most %.4f\n", p.Threshold, s.TargetFalsePositiveRate)
+	fmt.Fprintf(&b, "recall:    %.4f\n", p.TruePositiveRate)
+	fmt.Fprintf(&b, "precision: %.4f\n", p.Precision)
+	fmt.Fprintf(&b, "fpr:       %.4f\n", p.FalsePositiveRate)
+	return b.String()
+}
+
+// WriteFile creates the file at path and writes to it with write, such as the WriteJSON or WriteCSV
+// of a Report or Sweep
+func WriteFile(path string, write func(w io.Writer) error) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return errors.Wrapf(err, "unable to create %q", path)
+	}
+	if err := write(f); err != nil {
+		f.Close()
+		return errors.Wrapf(err, "unable to write %q", path)
+	}
+	return f.Close()
+}
@@ -0,0 +1,190 @@
+package evaluation
+
+import (
+	"math"
+	"sort"
+
+	"github.com/pkg/errors"
+
+	"github.com/viamrobotics/ocean-prefilter/oceanprefilter"
+)
+
+// DefaultSweepSteps is how many steps the threshold is swept from 0 to 1 in
+const DefaultSweepSteps = 100
+
+// ImageScore is the score the prefilter gives an image: the best "interesting" probability of its patches.
+// The image triggers at every threshold up to its score.
+type ImageScore struct {
+	Path  string  `json:"path"`
+	Label string  `json:"label"`
+	Score float64 `json:"score"`
+	// Error is set if the image could not be read or scored. An image that was read but could not be scored
+	// has a score of 0 and never triggers, like the service with such a frame, so it counts at every threshold.
+	Error string `json:"error,omitempty"`
+	// Unreadable is set if the image could not be read, the image is then left out of the curves
+	Unreadable bool `json:"unreadable,omitempty"`
+}
+
+// CurvePoint is the outcome of the prefilter at one threshold
+type CurvePoint struct {
+	Threshold         float64 `json:"threshold"`
+	TruePositives     int     `json:"true_positives"`
+	FalsePositives    int     `json:"false_positives"`
+	TrueNegatives     int     `json:"true_negatives"`
+	FalseNegatives    int     `json:"false_negatives"`
+	TruePositiveRate  float64 `json:"true_positive_rate"`
+	FalsePositiveRate float64 `json:"false_positive_rate"`
+	Precision         float64 `json:"precision"`
+	F1                float64 `json:"f1"`
+}
+
+// Sweep is the outcome of the prefilter over a dataset at every threshold from 0 to 1. The true and false
+// positive rates of the points are the ROC curve, and the precision against the true positive rate, which is
+// the recall, is the precision-recall curve.
+type Sweep struct {
+	Points []CurvePoint `json:"points"`
+	// AUC is the area under the ROC curve, over all the scores rather than only the swept thresholds
+	AUC float64 `json:"auc"`
+	// TargetFalsePositiveRate is the highest false positive rate the operating point may have
+	TargetFalsePositiveRate float64 `json:"target_false_positive_rate"`
+	// OperatingPoint is the point with the best recall within the target false positive rate, nil if no point is
+	OperatingPoint *CurvePoint `json:"operating_point,omitempty"`
+	// Unreadable is how many images were left out of the curves, and Unscored how many are in them without a score
+	Unreadable int          `json:"unreadable"`
+	Unscored   int          `json:"unscored"`
+	Scores     []ImageScore `json:"scores"`
+}
+
+// ScoreImages runs the prefilter with rc on every image of the manifest once, with the same patches,
+// horizon and model as the running service, and keeps the best score of each image.
+// The images are scored as stills, like Evaluate does.
+func ScoreImages(m *Manifest, rc oceanprefilter.RunConfig) ([]ImageScore, error) {
+	if rc.Model == nil {
+		return nil, errors.New("run config has no model to evaluate")
+	}
+	rc = rc.ForStills()
+	// no patch reaches this threshold, so every patch is scored and the confidence is the best probability
+	rc.Threshold = math.Inf(1)
+	rc.StopAtFirstTrigger = false
+	scores := make([]ImageScore, 0, len(m.Images))
+	for _, e := range m.Images {
+		s := ImageScore{Path: e.Path, Label: e.Label}
+		inf, read, err := scoreImage(m.resolve(e.Path), rc)
+		if err != nil {
+			s.Error = err.Error()
+			s.Unreadable = !read
+		} else {
+			s.Score = inf.Confidence
+		}
+		scores = append(scores, s)
+	}
+	return scores, nil
+}
+
+// scoreImage runs the prefilter on the image at path, and reports whether the image could be read
+func scoreImage(path string, rc oceanprefilter.RunConfig) (oceanprefilter.Inference, bool, error) {
+	img, err := readImage(path)
+	if err != nil {
+		return oceanprefilter.Inference{}, false, err
+	}
+	inf, err := oceanprefilter.MakeInference(img, rc)
+	if err != nil {
+		return oceanprefilter.Inference{}, true, errors.Wrapf(err, "unable to score image %q", path)
+	}
+	return inf, true, nil
+}
+
+// NewSweep counts the outcome of the scores at the thresholds 0, 1/steps, ..., 1 and picks the
+// threshold with the best recall that keeps the false positive rate at or below targetFPR.
+// Unreadable images are left out, and images without a score don't trigger at any threshold, not even 0.
+func NewSweep(scores []ImageScore, steps int, targetFPR float64) (*Sweep, error) {
+	if steps <= 0 {
+		return nil, errors.Errorf("number of steps must be positive, got %v", steps)
+	}
+	if targetFPR < 0 || targetFPR > 1 {
+		return nil, errors.Errorf("target false positive rate must be between 0 and 1, got %v", targetFPR)
+	}
+	var positives, negatives []float64
+	unreadable, unscored := 0, 0
+	for _, s := range scores {
+		score := s.Score
+		switch {
+		case s.Unreadable:
+			unreadable++
+			continue
+		case s.Error != "":
+			unscored++
+			// below every threshold that is swept
+			score = -1
+		}
+		if s.Label == LabelInteresting {
+			positives = append(positives, score)
+		} else {
+			negatives = append(negatives, score)
+		}
+	}
+	sweep := &Sweep{
+		Unreadable:              unreadable,
+		Unscored:                unscored,
+		Points:                  make([]CurvePoint, 0, steps+1),
+		AUC:                     rocAUC(positives, negatives),
+		TargetFalsePositiveRate: targetFPR,
+		Scores:                  scores,
+	}
+	for i := 0; i <= steps; i++ {
+		p := curvePoint(float64(i)/float64(steps), positives, negatives)
+		sweep.Points = append(sweep.Points, p)
+		if p.FalsePositiveRate > targetFPR {
+			continue
+		}
+		// of the points with the same recall, the one with the fewest false positives wins, then the lowest threshold
+		if best := sweep.OperatingPoint; best == nil || p.TruePositiveRate > best.TruePositiveRate ||
+			(p.TruePositiveRate == best.TruePositiveRate && p.FalsePositiveRate < best.FalsePositiveRate) {
+			sweep.OperatingPoint = &sweep.Points[len(sweep.Points)-1]
+		}
+	}
+	return sweep, nil
+}
+
+// curvePoint counts the outcome of the scores at the threshold
+func curvePoint(threshold float64, positives, negatives []float64) CurvePoint {
+	p := CurvePoint{Threshold: threshold}
+	for _, s := range positives {
+		if s >= threshold {
+			p.TruePositives++
+		} else {
+			p.FalseNegatives++
+		}
+	}
+	for _, s := range negatives {
+		if s >= threshold {
+			p.FalsePositives++
+		} else {
+			p.TrueNegatives++
+		}
+	}
+	p.TruePositiveRate = ratio(p.TruePositives, len(positives))
+	p.FalsePositiveRate = ratio(p.FalsePositives, len(negatives))
+	p.Precision = ratio(p.TruePositives, p.TruePositives+p.FalsePositives)
+	if p.Precision+p.TruePositiveRate > 0 {
+		p.F1 = 2 * p.Precision * p.TruePositiveRate / (p.Precision + p.TruePositiveRate)
+	}
+	return p
+}
+
+// rocAUC is the chance that a random positive scores higher than a random negative, counting ties as half,
+// which is the area under the ROC curve. It is 0 without both positives and negatives.
+func rocAUC(positives, negatives []float64) float64 {
+	if len(positives) == 0 || len(negatives) == 0 {
+		return 0
+	}
+	neg := append([]float64(nil), negatives...)
+	sort.Float64s(neg)
+	wins := 0.0
+	for _, s := range positives {
+		below := sort.SearchFloat64s(neg, s)
+		ties := sort.Search(len(neg), func(i int) bool { return neg[i] > s }) - below
+		wins += float64(below) + float64(ties)/2
+	}
+	return wins / float64(len(positives)*len(negatives))
+}
@@ -7,8 +7,6 @@ import (
 	"os"
 	"path/filepath"
 
-	xgb "github.com/Elvenson/xgboost-go"
-	"github.com/Elvenson/xgboost-go/activation"
 	"github.com/viamrobotics/ocean-prefilter/oceanprefilter"
 )
 
@@ -21,8 +19,7 @@ func main() {
 	files, _ := os.ReadDir(dir)
 
 	rc := oceanprefilter.RunConfig{}
-	ensemble, err := xgb.LoadXGBoostFromJSONBytes(modelbytes,
-		"", 2, 8, &activation.Softmax{})
+	ensemble, err := oceanprefilter.LoadXGBoostModel(modelbytes)
 
 	if err != nil {
 		fmt.Println(err)
@@ -35,7 +32,7 @@ func main() {
 		Max: image.Point{X: 580, Y: 480},
 	}
 
-	rc.ExcludedZone = &rect
+	rc.Mask = oceanprefilter.NewRegionMask([]oceanprefilter.Region{oceanprefilter.RectRegion(rect)}, nil, 0)
 	for _, file := range files {
 		fp := filepath.Join(dir, file.Name())
 		f, _ := os.Open(fp)
@@ -47,7 +44,7 @@ func main() {
 		if err != nil {
 			fmt.Println("error making inference: ", err)
 		} else {
-			fmt.Printf("output is %t: ", res)
+			fmt.Printf("output is %t (confidence %.3f): ", res.Triggered, res.Confidence)
 		}
 	}
 }
@@ -0,0 +1,175 @@
+package export
+
+import (
+	"encoding/json"
+	"fmt"
+	"image"
+	"image/png"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/pkg/errors"
+
+	"github.com/viamrobotics/ocean-prefilter/evaluation"
+	"github.com/viamrobotics/ocean-prefilter/oceanprefilter"
+)
+
+// Crop describes a patch written out as an image, it is the sidecar JSON next to the PNG of the patch.
+// Annotators set Label to "interesting" or "boring", and leave it empty to skip the patch.
+type Crop struct {
+	// Frame is the image the patch was cut from, relative to the folder that was exported
+	Frame string `json:"frame"`
+	// Row and Column are the place of the patch in the grid the water is split into
+	Row    int `json:"row"`
+	Column int `json:"column"`
+	// HorizonY is the y the column of the patch is cropped at
+	HorizonY int `json:"horizon_y"`
+	// Offset is where the patch was cropped from the frame, and Box the whole area, as [x_min, y_min, x_max, y_max]
+	Offset []int `json:"offset"`
+	Box    []int `json:"box"`
+	// Resized is true if the patch was cut short by the edge of the frame and resized to the patch size
+	Resized bool `json:"resized"`
+	// Score is the "interesting" probability the model gave the patch
+	Score float64 `json:"score"`
+	Label string  `json:"label"`
+}
+
+// ExportCrops walks dir for JPEG and PNG images, in lexical order, and writes every patch of every image to outDir
+// as a PNG of the patch size, with a sidecar JSON describing it. The crops of an image go in the same folder
+// under outDir as the image is in under dir, named after the image and the grid place of the patch,
+// such as 2288.jpg_r0_c1.png and 2288.jpg_r0_c1.json.
+// It returns the number of images and patches written, and the images that were left out with their error.
+func ExportCrops(dir, outDir string, rc oceanprefilter.RunConfig) (int, int, []SkippedImage, error) {
+	patches := 0
+	skipped := []SkippedImage{}
+	images, err := walkImages(dir, func(rel string, img image.Image, readErr error) error {
+		if readErr != nil {
+			skipped = append(skipped, SkippedImage{Path: rel, Error: readErr.Error()})
+			return nil
+		}
+		_, crops, err := oceanprefilter.SplitPatches(img, rc)
+		if err != nil {
+			skipped = append(skipped, SkippedImage{Path: rel, Error: errors.Wrap(err, "unable to split up the image").Error()})
+			return nil
+		}
+		for _, p := range crops {
+			if err := writeCrop(outDir, rel, p); err != nil {
+				return err
+			}
+		}
+		patches += len(crops)
+		return nil
+	})
+	return images - len(skipped), patches, skipped, err
+}
+
+// writeCrop writes the PNG and sidecar JSON of a patch of the frame
+func writeCrop(outDir, frame string, p oceanprefilter.Patch) error {
+	// the extension stays in the name, so a.jpg and a.png next to each other don't write the same crops
+	name := fmt.Sprintf("%v_r%v_c%v", frame, p.Row, p.Column)
+	base := filepath.Join(outDir, filepath.FromSlash(name))
+	if err := os.MkdirAll(filepath.Dir(base), 0o755); err != nil {
+		return err
+	}
+	f, err := os.Create(base + ".png")
+	if err != nil {
+		return errors.Wrapf(err, "unable to create crop %q", base+".png")
+	}
+	if err := png.Encode(f, p.Image); err != nil {
+		f.Close()
+		return errors.Wrapf(err, "unable to write crop %q", base+".png")
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	crop := Crop{
+		Frame:    frame,
+		Row:      p.Row,
+		Column:   p.Column,
+		HorizonY: p.HorizonY,
+		Offset:   []int{p.Box.Min.X, p.Box.Min.Y},
+		Box:      []int{p.Box.Min.X, p.Box.Min.Y, p.Box.Max.X, p.Box.Max.Y},
+		Resized:  p.Resized,
+		Score:    p.Score,
+	}
+	data, err := json.MarshalIndent(crop, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(base+".json", append(data, '\n'), 0o644)
+}
+
+// ImportLabels reads the labelled sidecars under cropDir back into a manifest of the frames they were cut from.
+// A frame is interesting if any of its patches is, with the boxes of those patches, and boring if all of its
+// labelled patches are. Frames without labelled patches are left out. The paths of the frames are made relative
+// to manifestDir, where the manifest is going to be saved, from frameDir, the folder that was exported.
+func ImportLabels(cropDir, frameDir, manifestDir string) (*evaluation.Manifest, error) {
+	frameDir, err := filepath.Abs(frameDir)
+	if err != nil {
+		return nil, err
+	}
+	manifestDir, err = filepath.Abs(manifestDir)
+	if err != nil {
+		return nil, err
+	}
+	frames := map[string]*evaluation.Entry{}
+	err = filepath.WalkDir(cropDir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() || filepath.Ext(p) != ".json" {
+			return nil
+		}
+		data, err := os.ReadFile(p)
+		if err != nil {
+			return err
+		}
+		var crop Crop
+		if err := json.Unmarshal(data, &crop); err != nil {
+			return errors.Wrapf(err, "crop %q is not valid JSON", p)
+		}
+		switch crop.Label {
+		case "":
+			return nil
+		case evaluation.LabelInteresting, evaluation.LabelBoring:
+		default:
+			return errors.Errorf("crop %q has label %q, it must be %q, %q or empty",
+				p, crop.Label, evaluation.LabelInteresting, evaluation.LabelBoring)
+		}
+		if crop.Frame == "" || len(crop.Box) != 4 {
+			return errors.Errorf("crop %q has no frame or box", p)
+		}
+		e, ok := frames[crop.Frame]
+		if !ok {
+			framePath, err := filepath.Rel(manifestDir, filepath.Join(frameDir, filepath.FromSlash(crop.Frame)))
+			if err != nil {
+				return err
+			}
+			e = &evaluation.Entry{Path: filepath.ToSlash(framePath), Label: evaluation.LabelBoring}
+			frames[crop.Frame] = e
+		}
+		if crop.Label == evaluation.LabelInteresting {
+			e.Label = evaluation.LabelInteresting
+			e.Boxes = append(e.Boxes, crop.Box)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(frames) == 0 {
+		return nil, errors.Errorf("no labelled crops found in %q", cropDir)
+	}
+	names := make([]string, 0, len(frames))
+	for name := range frames {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	m := &evaluation.Manifest{}
+	for _, name := range names {
+		m.Images = append(m.Images, *frames[name])
+	}
+	return m, nil
+}
@@ -0,0 +1,263 @@
+package export
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"image"
+	"image/png"
+	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	"go.viam.com/rdk/logging"
+	"go.viam.com/test"
+
+	"github.com/viamrobotics/ocean-prefilter/evaluation"
+	"github.com/viamrobotics/ocean-prefilter/oceanprefilter"
+)
+
+func TestFeatureWriter(t *testing.T) {
+	nan := float32(math.NaN())
+	patches := []oceanprefilter.PatchFeatures{
+		{Box: image.Rect(0, 10, 4, 12), Row: 0, Column: 0, HorizonY: 10, Features: []float32{0.5, nan, 1.0 / 3}},
+		{Box: image.Rect(4, 14, 8, 16), Row: 1, Column: 1, HorizonY: 12, Features: []float32{nan, nan, nan}},
+	}
+	var libsvm, csvOut bytes.Buffer
+	fw, err := NewFeatureWriter(&libsvm, &csvOut, 3)
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, fw.Write("a b.jpg", 1, patches), test.ShouldBeNil)
+	test.That(t, fw.Flush(), test.ShouldBeNil)
+
+	test.That(t, libsvm.String(), test.ShouldEqual,
+		"1 0:0.5 2:0.33333334 # image=\"a b.jpg\" row=0 column=0 horizon_y=10\n"+
+			"1 # image=\"a b.jpg\" row=1 column=1 horizon_y=12\n")
+	rows, err := csv.NewReader(&csvOut).ReadAll()
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, rows, test.ShouldResemble, [][]string{
+		{"image", "label", "row", "column", "horizon_y", "x_min", "y_min", "x_max", "y_max", "f0", "f1", "f2"},
+		{"a b.jpg", "1", "0", "0", "10", "0", "10", "4", "12", "0.5", "", "0.33333334"},
+		{"a b.jpg", "1", "1", "1", "12", "4", "14", "8", "16", "", "", ""},
+	})
+
+	// either output may be left out
+	fw, err = NewFeatureWriter(nil, nil, 3)
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, fw.Write("a.jpg", 0, patches), test.ShouldBeNil)
+	test.That(t, fw.Flush(), test.ShouldBeNil)
+
+	fw, err = NewFeatureWriter(&libsvm, nil, 4)
+	test.That(t, err, test.ShouldBeNil)
+	err = fw.Write("a.jpg", 0, patches)
+	test.That(t, err.Error(), test.ShouldContainSubstring, "expected 4")
+}
+
+func TestExportDir(t *testing.T) {
+	dir := t.TempDir()
+	jpg, err := os.ReadFile("../oceanprefilter/test_data/2288.jpg")
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, os.WriteFile(filepath.Join(dir, "2288.jpg"), jpg, 0o644), test.ShouldBeNil)
+	img, err := readImage(filepath.Join(dir, "2288.jpg"))
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, os.Mkdir(filepath.Join(dir, "more"), 0o755), test.ShouldBeNil)
+	f, err := os.Create(filepath.Join(dir, "more", "2288.png"))
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, png.Encode(f, img), test.ShouldBeNil)
+	test.That(t, f.Close(), test.ShouldBeNil)
+	test.That(t, os.WriteFile(filepath.Join(dir, "notes.txt"), []byte("not an image"), 0o644), test.ShouldBeNil)
+
+	rc := oceanprefilter.RunConfig{}
+	_, want, err := oceanprefilter.ExtractFeatures(img, rc)
+	test.That(t, err, test.ShouldBeNil)
+	// the PNG holds the JPEG converted to RGB, which is a little off from the converted pixels the JPEG is read with
+	pngImg, err := readImage(filepath.Join(dir, "more", "2288.png"))
+	test.That(t, err, test.ShouldBeNil)
+	_, wantPNG, err := oceanprefilter.ExtractFeatures(pngImg, rc)
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, wantPNG, test.ShouldHaveLength, len(want))
+	want = append(want, wantPNG...)
+
+	var libsvm, csvOut bytes.Buffer
+	fw, err := NewFeatureWriter(&libsvm, &csvOut, rc.NumFeatures())
+	test.That(t, err, test.ShouldBeNil)
+	images, patches, skipped, err := ExportDir(dir, rc, 0, fw)
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, images, test.ShouldEqual, 2)
+	test.That(t, skipped, test.ShouldBeEmpty)
+	test.That(t, patches, test.ShouldEqual, len(want))
+	test.That(t, strings.Count(libsvm.String(), "\n"), test.ShouldEqual, patches)
+
+	rows, err := csv.NewReader(&csvOut).ReadAll()
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, rows, test.ShouldHaveLength, patches+1)
+	// the rows read back as exactly the features of the patches, first of the JPEG and then of the PNG
+	for i, row := range rows[1:] {
+		p := want[i]
+		name := "2288.jpg"
+		if i >= len(wantPNG) {
+			name = "more/2288.png"
+		}
+		test.That(t, row[:5], test.ShouldResemble, []string{name, "0", strconv.Itoa(p.Row), strconv.Itoa(p.Column), strconv.Itoa(p.HorizonY)})
+		for k, cell := range row[9:] {
+			if math.IsNaN(float64(p.Features[k])) {
+				test.That(t, cell, test.ShouldEqual, "")
+				continue
+			}
+			v, err := strconv.ParseFloat(cell, 32)
+			test.That(t, err, test.ShouldBeNil)
+			test.That(t, float32(v), test.ShouldEqual, p.Features[k])
+		}
+	}
+
+	// images that can't be read, or have no horizon to find, are skipped and the others still written
+	test.That(t, os.WriteFile(filepath.Join(dir, "broken.png"), []byte("not a png"), 0o644), test.ShouldBeNil)
+	f, err = os.Create(filepath.Join(dir, "tiny.png"))
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, png.Encode(f, image.NewGray(image.Rect(0, 0, 4, 4))), test.ShouldBeNil)
+	test.That(t, f.Close(), test.ShouldBeNil)
+	libsvm.Reset()
+	fw, err = NewFeatureWriter(&libsvm, nil, rc.NumFeatures())
+	test.That(t, err, test.ShouldBeNil)
+	images, patches, skipped, err = ExportDir(dir, rc, 0, fw)
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, images, test.ShouldEqual, 2)
+	test.That(t, patches, test.ShouldEqual, len(want))
+	test.That(t, strings.Count(libsvm.String(), "\n"), test.ShouldEqual, patches)
+	test.That(t, skipped, test.ShouldHaveLength, 2)
+	test.That(t, skipped[0].Path, test.ShouldEqual, "broken.png")
+	test.That(t, skipped[0].Error, test.ShouldContainSubstring, "unable to decode image")
+	test.That(t, skipped[1].Path, test.ShouldEqual, "tiny.png")
+	test.That(t, skipped[1].Error, test.ShouldContainSubstring, "unable to extract the features")
+}
+
+func TestCrops(t *testing.T) {
+	frames := t.TempDir()
+	jpg, err := os.ReadFile("../oceanprefilter/test_data/2288.jpg")
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, os.Mkdir(filepath.Join(frames, "day1"), 0o755), test.ShouldBeNil)
+	test.That(t, os.WriteFile(filepath.Join(frames, "day1", "2288.jpg"), jpg, 0o644), test.ShouldBeNil)
+	test.That(t, os.WriteFile(filepath.Join(frames, "2289.jpg"), jpg, 0o644), test.ShouldBeNil)
+	img, err := readImage(filepath.Join(frames, "2289.jpg"))
+	test.That(t, err, test.ShouldBeNil)
+
+	rc, err := oceanprefilter.NewRunConfig(&oceanprefilter.Config{}, logging.NewTestLogger(t))
+	test.That(t, err, test.ShouldBeNil)
+	_, want, err := oceanprefilter.SplitPatches(img, rc)
+	test.That(t, err, test.ShouldBeNil)
+
+	crops := t.TempDir()
+	images, patches, skipped, err := ExportCrops(frames, crops, rc)
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, images, test.ShouldEqual, 2)
+	test.That(t, skipped, test.ShouldBeEmpty)
+	test.That(t, patches, test.ShouldEqual, 2*len(want))
+
+	readCrop := func(name string) Crop {
+		data, err := os.ReadFile(filepath.Join(crops, name+".json"))
+		test.That(t, err, test.ShouldBeNil)
+		var c Crop
+		test.That(t, json.Unmarshal(data, &c), test.ShouldBeNil)
+		return c
+	}
+	writeLabel := func(name, label string) {
+		c := readCrop(name)
+		c.Label = label
+		data, err := json.Marshal(c)
+		test.That(t, err, test.ShouldBeNil)
+		test.That(t, os.WriteFile(filepath.Join(crops, name+".json"), data, 0o644), test.ShouldBeNil)
+	}
+	for _, p := range want {
+		name := fmt.Sprintf("2289.jpg_r%v_c%v", p.Row, p.Column)
+		test.That(t, readCrop(name), test.ShouldResemble, Crop{
+			Frame: "2289.jpg", Row: p.Row, Column: p.Column, HorizonY: p.HorizonY,
+			Offset:  []int{p.Box.Min.X, p.Box.Min.Y},
+			Box:     []int{p.Box.Min.X, p.Box.Min.Y, p.Box.Max.X, p.Box.Max.Y},
+			Resized: p.Resized, Score: p.Score,
+		})
+		// the crops of frames in folders go in the same folders
+		test.That(t, readCrop(fmt.Sprintf("day1/2288.jpg_r%v_c%v", p.Row, p.Column)).Frame, test.ShouldEqual, "day1/2288.jpg")
+		// and every crop is the patch the model sees
+		f, err := os.Open(filepath.Join(crops, name+".png"))
+		test.That(t, err, test.ShouldBeNil)
+		crop, err := png.Decode(f)
+		test.That(t, f.Close(), test.ShouldBeNil)
+		test.That(t, err, test.ShouldBeNil)
+		test.That(t, crop.Bounds().Size(), test.ShouldResemble, image.Pt(200, 80))
+		r, g, b, a := crop.At(10, 10).RGBA()
+		wr, wg, wb, wa := p.Image.At(p.Image.Bounds().Min.X+10, p.Image.Bounds().Min.Y+10).RGBA()
+		test.That(t, []uint32{r >> 8, g >> 8, b >> 8, a >> 8}, test.ShouldResemble, []uint32{wr >> 8, wg >> 8, wb >> 8, wa >> 8})
+	}
+
+	// frames that only differ in their extension get crops of their own
+	png2289, err := os.Create(filepath.Join(frames, "2289.png"))
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, png.Encode(png2289, img), test.ShouldBeNil)
+	test.That(t, png2289.Close(), test.ShouldBeNil)
+	both := t.TempDir()
+	images, patches, _, err = ExportCrops(frames, both, rc)
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, images, test.ShouldEqual, 3)
+	test.That(t, patches, test.ShouldEqual, 3*len(want))
+	written, err := filepath.Glob(filepath.Join(both, "2289.*_r*_c*.json"))
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, written, test.ShouldHaveLength, 2*len(want))
+	test.That(t, os.Remove(filepath.Join(frames, "2289.png")), test.ShouldBeNil)
+
+	// frames that can't be read, or have no horizon to find, are skipped and the others still exported
+	test.That(t, os.WriteFile(filepath.Join(frames, "broken.png"), []byte("not a png"), 0o644), test.ShouldBeNil)
+	tiny, err := os.Create(filepath.Join(frames, "tiny.png"))
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, png.Encode(tiny, image.NewGray(image.Rect(0, 0, 4, 4))), test.ShouldBeNil)
+	test.That(t, tiny.Close(), test.ShouldBeNil)
+	partial := t.TempDir()
+	images, patches, skipped, err = ExportCrops(frames, partial, rc)
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, images, test.ShouldEqual, 2)
+	test.That(t, patches, test.ShouldEqual, 2*len(want))
+	test.That(t, skipped, test.ShouldHaveLength, 2)
+	test.That(t, skipped[0].Path, test.ShouldEqual, "broken.png")
+	test.That(t, skipped[0].Error, test.ShouldContainSubstring, "unable to decode image")
+	test.That(t, skipped[1].Path, test.ShouldEqual, "tiny.png")
+	test.That(t, skipped[1].Error, test.ShouldContainSubstring, "unable to split up the image")
+	written, err = filepath.Glob(filepath.Join(partial, "*_r*_c*.json"))
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, written, test.ShouldHaveLength, len(want))
+	test.That(t, os.Remove(filepath.Join(frames, "broken.png")), test.ShouldBeNil)
+	test.That(t, os.Remove(filepath.Join(frames, "tiny.png")), test.ShouldBeNil)
+
+	// nothing is labelled yet
+	manifestDir := t.TempDir()
+	_, err = ImportLabels(crops, frames, manifestDir)
+	test.That(t, err.Error(), test.ShouldContainSubstring, "no labelled crops")
+
+	first, last := want[0], want[len(want)-1]
+	writeLabel(fmt.Sprintf("2289.jpg_r%v_c%v", first.Row, first.Column), "boring")
+	writeLabel(fmt.Sprintf("2289.jpg_r%v_c%v", last.Row, last.Column), "interesting")
+	writeLabel(fmt.Sprintf("day1/2288.jpg_r%v_c%v", first.Row, first.Column), "boring")
+	m, err := ImportLabels(crops, frames, manifestDir)
+	test.That(t, err, test.ShouldBeNil)
+	rel, err := filepath.Rel(manifestDir, frames)
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, m.Images, test.ShouldResemble, []evaluation.Entry{
+		{Path: filepath.ToSlash(filepath.Join(rel, "2289.jpg")), Label: "interesting", Boxes: [][]int{readCrop(fmt.Sprintf("2289.jpg_r%v_c%v", last.Row, last.Column)).Box}},
+		{Path: filepath.ToSlash(filepath.Join(rel, "day1", "2288.jpg")), Label: "boring"},
+	})
+
+	// the manifest is saved where it resolves the frames, and the evaluation reads it back
+	manifestPath := filepath.Join(manifestDir, "dataset.json")
+	test.That(t, m.Save(manifestPath), test.ShouldBeNil)
+	loaded, err := evaluation.LoadManifest(manifestPath)
+	test.That(t, err, test.ShouldBeNil)
+	report, err := evaluation.Evaluate(loaded, rc)
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, report.Summary.Unreadable, test.ShouldEqual, 0)
+	test.That(t, report.Summary.Boxes, test.ShouldEqual, 1)
+
+	writeLabel(fmt.Sprintf("2289.jpg_r%v_c%v", first.Row, first.Column), "boat")
+	_, err = ImportLabels(crops, frames, manifestDir)
+	test.That(t, err.Error(), test.ShouldContainSubstring, "label \"boat\"")
+}
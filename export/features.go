@@ -0,0 +1,194 @@
+// Package export writes out what the prefilter sees, to retrain its model with the same preprocessing
+package export
+
+import (
+	"bufio"
+	"encoding/csv"
+	"fmt"
+	"image"
+	// decoders for the images that are exported
+	_ "image/jpeg"
+	_ "image/png"
+	"io"
+	"io/fs"
+	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	"github.com/viamrobotics/ocean-prefilter/oceanprefilter"
+)
+
+// imageExtensions are the files that are read as images
+var imageExtensions = map[string]bool{".jpg": true, ".jpeg": true, ".png": true}
+
+// FeatureWriter writes the features of patches as LIBSVM rows, as CSV rows, or both.
+// Feature indices start at 0, like the f<index> split features of the model.
+type FeatureWriter struct {
+	libsvm      *bufio.Writer
+	csv         *csv.Writer
+	numFeatures int
+}
+
+// NewFeatureWriter returns a writer of patches with numFeatures features, to libsvm and to csv.
+// Either of them may be nil. The header of the CSV is written right away.
+func NewFeatureWriter(libsvm, csvOut io.Writer, numFeatures int) (*FeatureWriter, error) {
+	fw := &FeatureWriter{numFeatures: numFeatures}
+	if libsvm != nil {
+		fw.libsvm = bufio.NewWriter(libsvm)
+	}
+	if csvOut != nil {
+		fw.csv = csv.NewWriter(csvOut)
+		header := []string{"image", "label", "row", "column", "horizon_y", "x_min", "y_min", "x_max", "y_max"}
+		for k := 0; k < numFeatures; k++ {
+			header = append(header, "f"+strconv.Itoa(k))
+		}
+		if err := fw.csv.Write(header); err != nil {
+			return nil, err
+		}
+	}
+	return fw, nil
+}
+
+// Write writes a row for each patch of the image. A LIBSVM row leaves out missing features, and ends with a
+// comment holding the image, grid place and horizon y of the patch. A CSV row has an empty cell for them.
+func (fw *FeatureWriter) Write(imagePath string, label int, patches []oceanprefilter.PatchFeatures) error {
+	for _, p := range patches {
+		if len(p.Features) != fw.numFeatures {
+			return errors.Errorf("patch of %q has %v features, expected %v", imagePath, len(p.Features), fw.numFeatures)
+		}
+		if fw.libsvm != nil {
+			if err := fw.writeLIBSVM(imagePath, label, p); err != nil {
+				return err
+			}
+		}
+		if fw.csv != nil {
+			row := []string{
+				imagePath, strconv.Itoa(label), strconv.Itoa(p.Row), strconv.Itoa(p.Column), strconv.Itoa(p.HorizonY),
+				strconv.Itoa(p.Box.Min.X), strconv.Itoa(p.Box.Min.Y), strconv.Itoa(p.Box.Max.X), strconv.Itoa(p.Box.Max.Y),
+			}
+			for _, v := range p.Features {
+				row = append(row, formatFeature(v))
+			}
+			if err := fw.csv.Write(row); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// writeLIBSVM writes the row of one patch
+func (fw *FeatureWriter) writeLIBSVM(imagePath string, label int, p oceanprefilter.PatchFeatures) error {
+	var b strings.Builder
+	b.WriteString(strconv.Itoa(label))
+	for k, v := range p.Features {
+		if math.IsNaN(float64(v)) {
+			continue
+		}
+		fmt.Fprintf(&b, " %v:%v", k, formatFeature(v))
+	}
+	// the image path is quoted, as it may hold spaces
+	fmt.Fprintf(&b, " # image=%q row=%v column=%v horizon_y=%v\n", imagePath, p.Row, p.Column, p.HorizonY)
+	_, err := fw.libsvm.WriteString(b.String())
+	return err
+}
+
+// Flush writes out everything that is buffered
+func (fw *FeatureWriter) Flush() error {
+	if fw.libsvm != nil {
+		if err := fw.libsvm.Flush(); err != nil {
+			return err
+		}
+	}
+	if fw.csv != nil {
+		fw.csv.Flush()
+		return fw.csv.Error()
+	}
+	return nil
+}
+
+// formatFeature writes the feature as the shortest number that reads back as the same float32,
+// and a missing feature as an empty string
+func formatFeature(v float32) string {
+	if math.IsNaN(float64(v)) {
+		return ""
+	}
+	return strconv.FormatFloat(float64(v), 'g', -1, 32)
+}
+
+// SkippedImage is an image that was left out of an export, because it could not be read or its patches
+// could not be found, such as a frame without a visible horizon
+type SkippedImage struct {
+	Path  string `json:"path"`
+	Error string `json:"error"`
+}
+
+// ExportDir walks dir for JPEG and PNG images, in lexical order, and writes the features of every patch
+// of every image to fw with the label. Image paths in the rows are relative to dir.
+// It returns the number of images and patches written, and the images that were left out with their error.
+func ExportDir(dir string, rc oceanprefilter.RunConfig, label int, fw *FeatureWriter) (int, int, []SkippedImage, error) {
+	patches := 0
+	skipped := []SkippedImage{}
+	images, err := walkImages(dir, func(rel string, img image.Image, readErr error) error {
+		if readErr != nil {
+			skipped = append(skipped, SkippedImage{Path: rel, Error: readErr.Error()})
+			return nil
+		}
+		_, features, err := oceanprefilter.ExtractFeatures(img, rc)
+		if err != nil {
+			skipped = append(skipped, SkippedImage{Path: rel, Error: errors.Wrap(err, "unable to extract the features").Error()})
+			return nil
+		}
+		patches += len(features)
+		return fw.Write(rel, label, features)
+	})
+	images -= len(skipped)
+	if err != nil {
+		return images, patches, skipped, err
+	}
+	return images, patches, skipped, fw.Flush()
+}
+
+// walkImages calls fn with every JPEG and PNG image under dir, in lexical order, and the path of the image
+// relative to dir with forward slashes. If the image can't be read, fn is called with the error instead.
+// It returns the number of images fn was called with.
+func walkImages(dir string, fn func(rel string, img image.Image, readErr error) error) (int, error) {
+	images := 0
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() || !imageExtensions[strings.ToLower(filepath.Ext(path))] {
+			return nil
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		img, readErr := readImage(path)
+		if err := fn(filepath.ToSlash(rel), img, readErr); err != nil {
+			return err
+		}
+		images++
+		return nil
+	})
+	return images, err
+}
+
+// readImage decodes the image at path
+func readImage(path string) (image.Image, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, errors.Wrapf(err, "unable to open image %q", path)
+	}
+	defer f.Close()
+	img, _, err := image.Decode(f)
+	if err != nil {
+		return nil, errors.Wrapf(err, "unable to decode image %q", path)
+	}
+	return img, nil
+}
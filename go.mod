@@ -4,6 +4,7 @@ go 1.21.13
 
 require (
 	github.com/Elvenson/xgboost-go v0.1.4
+	github.com/chewxy/math32 v1.10.1
 	github.com/disintegration/imaging v1.6.2
 	github.com/pkg/errors v0.9.1
 	go.viam.com/rdk v0.28.0
@@ -31,7 +32,6 @@ require (
 	github.com/campoy/embedmd v1.0.0 // indirect
 	github.com/cenkalti/backoff v2.2.1+incompatible // indirect
 	github.com/cenkalti/backoff/v4 v4.2.1 // indirect
-	github.com/chewxy/math32 v1.10.1 // indirect
 	github.com/davecgh/go-spew v1.1.1 // indirect
 	github.com/decred/dcrd/dcrec/secp256k1/v4 v4.2.0 // indirect
 	github.com/desertbit/timer v0.0.0-20180107155436-c41aec40b27f // indirect
@@ -0,0 +1,34 @@
+// Package xgbdump reads the trees of an XGBoost JSON dump, as written by dump_model with dump_format="json".
+// It is shared by the prefilter, which scores the trees, and by xgbgen, which compiles them to Go.
+package xgbdump
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// Node is a node of an XGBoost JSON dump
+type Node struct {
+	NodeID         int     `json:"nodeid"`
+	Split          string  `json:"split"`
+	SplitCondition float32 `json:"split_condition"`
+	Yes            int     `json:"yes"`
+	No             int     `json:"no"`
+	Missing        int     `json:"missing"`
+	Leaf           float32 `json:"leaf"`
+	Children       []*Node `json:"children"`
+}
+
+// SplitFeature returns the index of a split feature named f<index>
+func SplitFeature(split string) (int, error) {
+	if !strings.HasPrefix(split, "f") {
+		return 0, errors.Errorf("split feature %q is not of the form f<index>", split)
+	}
+	feature, err := strconv.Atoi(split[1:])
+	if err != nil || feature < 0 {
+		return 0, errors.Errorf("split feature %q is not of the form f<index>", split)
+	}
+	return feature, nil
+}
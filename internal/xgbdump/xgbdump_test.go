@@ -0,0 +1,17 @@
+package xgbdump
+
+import (
+	"testing"
+
+	"go.viam.com/test"
+)
+
+func TestSplitFeature(t *testing.T) {
+	feature, err := SplitFeature("f797")
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, feature, test.ShouldEqual, 797)
+	for _, bad := range []string{"", "f", "797", "x797", "f-1", "f7.5"} {
+		_, err = SplitFeature(bad)
+		test.That(t, err, test.ShouldNotBeNil)
+	}
+}
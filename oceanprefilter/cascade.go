@@ -0,0 +1,86 @@
+package oceanprefilter
+
+import (
+	"context"
+	"image"
+	"image/draw"
+
+	"github.com/pkg/errors"
+	objdet "go.viam.com/rdk/vision/objectdetection"
+)
+
+// infer runs the XGBoost prefilter on the image, and if a second stage detector is configured,
+// confirms the trigger with the detector. The detector only ever sees frames the prefilter triggered on.
+// If a movement sensor is configured, its orientation gives the horizon the prefilter starts from.
+func infer(ctx context.Context, img image.Image, rc RunConfig) (Inference, error) {
+	if rc.horizonSensor != nil {
+		predicted, err := rc.horizonSensor.predict(ctx, img.Bounds())
+		switch {
+		case err == nil:
+			rc.predictedHorizon = &predicted
+		case rc.horizonSensor.mode == SensorHorizonPrimary:
+			return Inference{}, err
+		case rc.debug:
+			rc.logger.Debugf("finding the horizon in the image alone: %v", err)
+		}
+	}
+	result, err := MakeInference(img, rc)
+	if err != nil {
+		return Inference{}, err
+	}
+	if rc.detector == nil || !result.Triggered {
+		return result, nil
+	}
+	return runDetector(ctx, img, rc, result)
+}
+
+// runDetector sends a frame that the prefilter triggered on to the second stage detector, and only keeps
+// the detections whose label is in chosenLabels with at least that label's confidence.
+// The frame stays triggered only if at least one such detection is found.
+func runDetector(ctx context.Context, img image.Image, rc RunConfig, result Inference) (Inference, error) {
+	var dets []objdet.Detection
+	if rc.detectOnPatches {
+		for _, d := range result.Detections {
+			patchDets, err := detectInPatch(ctx, img, *d.BoundingBox(), rc)
+			if err != nil {
+				return Inference{}, err
+			}
+			dets = append(dets, patchDets...)
+		}
+	} else {
+		var err error
+		dets, err = rc.detector.Detections(ctx, img, nil)
+		if err != nil {
+			return Inference{}, errors.Wrapf(err, "second stage detector %q failed", rc.detectorName)
+		}
+	}
+	dets = objdet.NewLabelConfidenceFilter(rc.chosenLabels)(dets)
+
+	cascaded := Inference{Detections: dets, Horizon: result.Horizon}
+	for _, d := range dets {
+		cascaded.Triggered = true
+		if d.Score() > cascaded.Confidence {
+			cascaded.Confidence = d.Score()
+		}
+	}
+	if rc.debug {
+		rc.logger.Debugf("second stage detector %q kept %v of the detections", rc.detectorName, len(dets))
+	}
+	return cascaded, nil
+}
+
+// detectInPatch runs the detector on just the area of one triggering patch,
+// and moves the resulting boxes back into the coordinates of the full image
+func detectInPatch(ctx context.Context, img image.Image, box image.Rectangle, rc RunConfig) ([]objdet.Detection, error) {
+	crop := image.NewRGBA(image.Rect(0, 0, box.Dx(), box.Dy()))
+	draw.Draw(crop, crop.Bounds(), img, box.Min, draw.Src)
+	dets, err := rc.detector.Detections(ctx, crop, nil)
+	if err != nil {
+		return nil, errors.Wrapf(err, "second stage detector %q failed", rc.detectorName)
+	}
+	moved := make([]objdet.Detection, 0, len(dets))
+	for _, d := range dets {
+		moved = append(moved, objdet.NewDetection(d.BoundingBox().Add(box.Min), d.Score(), d.Label()))
+	}
+	return moved, nil
+}
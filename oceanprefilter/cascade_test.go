@@ -0,0 +1,86 @@
+package oceanprefilter
+
+import (
+	"context"
+	"errors"
+	"image"
+	"testing"
+
+	"go.viam.com/rdk/services/vision"
+	"go.viam.com/rdk/vision/classification"
+	objdet "go.viam.com/rdk/vision/objectdetection"
+	"go.viam.com/test"
+)
+
+// fakeDetector is a vision service that only implements Detections
+type fakeDetector struct {
+	vision.Service
+	DetectionsFunc func(ctx context.Context, img image.Image, extra map[string]interface{}) ([]objdet.Detection, error)
+}
+
+func (fd *fakeDetector) Detections(ctx context.Context, img image.Image, extra map[string]interface{}) ([]objdet.Detection, error) {
+	return fd.DetectionsFunc(ctx, img, extra)
+}
+
+func TestDetectorCascade(t *testing.T) {
+	img := MockImage(640, 480)
+	var detectorInput image.Image
+	detector := &fakeDetector{}
+	detector.DetectionsFunc = func(ctx context.Context, img image.Image, extra map[string]interface{}) ([]objdet.Detection, error) {
+		detectorInput = img
+		return []objdet.Detection{
+			objdet.NewDetection(image.Rect(10, 10, 20, 20), 0.8, "boat"),
+			objdet.NewDetection(image.Rect(30, 30, 40, 40), 0.3, "boat"),
+			objdet.NewDetection(image.Rect(50, 50, 60, 60), 0.9, "bird"),
+		}, nil
+	}
+	rc := RunConfig{
+		detector:     detector,
+		detectorName: "detector",
+		chosenLabels: map[string]float64{"boat": 0.5},
+	}
+	patchBox := image.Rect(200, 300, 400, 380)
+	prefiltered := Inference{
+		Triggered:  true,
+		Confidence: 0.6,
+		Detections: []objdet.Detection{objdet.NewDetection(patchBox, 0.6, triggerClassName)},
+	}
+
+	// the whole frame goes to the detector, and only boats above 0.5 are kept
+	result, err := runDetector(context.Background(), img, rc, prefiltered)
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, detectorInput.Bounds(), test.ShouldResemble, img.Bounds())
+	test.That(t, result.Triggered, test.ShouldBeTrue)
+	test.That(t, result.Confidence, test.ShouldEqual, 0.8)
+	test.That(t, len(result.Detections), test.ShouldEqual, 1)
+	test.That(t, result.Detections[0].Label(), test.ShouldEqual, "boat")
+	test.That(t, *result.Detections[0].BoundingBox(), test.ShouldResemble, image.Rect(10, 10, 20, 20))
+	test.That(t, result.classifications(), test.ShouldResemble, classification.Classifications{
+		classification.NewClassification(0.8, triggerClassName),
+		classification.NewClassification(0.8, "boat"),
+	})
+
+	// only the triggering patch goes to the detector, and the boxes are moved back into the frame
+	rc.detectOnPatches = true
+	result, err = runDetector(context.Background(), img, rc, prefiltered)
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, detectorInput.Bounds(), test.ShouldResemble, image.Rect(0, 0, 200, 80))
+	test.That(t, len(result.Detections), test.ShouldEqual, 1)
+	test.That(t, *result.Detections[0].BoundingBox(), test.ShouldResemble, image.Rect(210, 310, 220, 320))
+
+	// nothing of the chosen labels clears its confidence, so the frame is no longer triggered
+	rc.chosenLabels = map[string]float64{"boat": 0.95}
+	result, err = runDetector(context.Background(), img, rc, prefiltered)
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, result.Triggered, test.ShouldBeFalse)
+	test.That(t, result.Detections, test.ShouldBeEmpty)
+	test.That(t, result.classifications(), test.ShouldBeEmpty)
+
+	// detector errors are passed on
+	detector.DetectionsFunc = func(ctx context.Context, img image.Image, extra map[string]interface{}) ([]objdet.Detection, error) {
+		return nil, errors.New("no model")
+	}
+	_, err = runDetector(context.Background(), img, rc, prefiltered)
+	test.That(t, err, test.ShouldNotBeNil)
+	test.That(t, err.Error(), test.ShouldContainSubstring, "no model")
+}
@@ -0,0 +1,208 @@
+package oceanprefilter
+
+import (
+	"encoding/json"
+	"image"
+	"sync/atomic"
+
+	"github.com/pkg/errors"
+)
+
+// the verbs DoCommand understands, given as the "command" field of the request
+const (
+	cmdGetStats          = "get_stats"
+	cmdResetStats        = "reset_stats"
+	cmdSetThreshold      = "set_threshold"
+	cmdSetExcludedRegion = "set_excluded_region"
+)
+
+// parseExcludedRegion turns the four numbers of an excluded_region into the rectangle it describes.
+// An empty region means nothing is excluded.
+func parseExcludedRegion(er []int) (*image.Rectangle, error) {
+	if len(er) == 0 {
+		return nil, nil
+	}
+	if len(er) != 4 {
+		return nil, errors.Errorf("excluded_region must have four numbers that represent upper left and lower right corner of the excluded region in pixels. Instead got a list of %v elements", len(er))
+	}
+	theZone := image.Rectangle{image.Point{er[0], er[1]}, image.Point{er[2], er[3]}}
+	return &theZone, nil
+}
+
+// updateRunConfig applies a change to a copy of the current settings and hands the copy to the
+// background streams, which pick it up on the next frame without restarting the cameras.
+// If a camera is given, only the settings of that camera change. The update is told which camera
+// it changes, nil for the settings of the service.
+func (pf *prefilter) updateRunConfig(w *cameraWorker, update func(w *cameraWorker, rc *RunConfig) error) error {
+	pf.rcMu.Lock()
+	defer pf.rcMu.Unlock()
+	if pf.rc.Load() == nil {
+		return errors.New("prefilter is not configured yet")
+	}
+	targets := []*atomic.Pointer[RunConfig]{}
+	cameras := []*cameraWorker{}
+	if w != nil {
+		targets = append(targets, &w.rc)
+		cameras = append(cameras, w)
+	} else {
+		targets = append(targets, &pf.rc)
+		cameras = append(cameras, nil)
+		for _, w := range pf.cameras().byName {
+			targets = append(targets, &w.rc)
+			cameras = append(cameras, w)
+		}
+	}
+	// make every copy first, so a failed update changes nothing
+	updated := make([]*RunConfig, len(targets))
+	for i, target := range targets {
+		current := target.Load()
+		if current == nil {
+			continue
+		}
+		rc := *current
+		if err := update(cameras[i], &rc); err != nil {
+			return err
+		}
+		updated[i] = &rc
+	}
+	for i, target := range targets {
+		if updated[i] != nil {
+			target.Store(updated[i])
+		}
+	}
+	return nil
+}
+
+// cameraFromCommand returns the camera named by the optional "camera_name" field of a command, or nil if it has none
+func (pf *prefilter) cameraFromCommand(cmd map[string]interface{}) (*cameraWorker, error) {
+	value, ok := cmd["camera_name"]
+	if !ok {
+		return nil, nil
+	}
+	name, ok := value.(string)
+	if !ok {
+		return nil, errors.Errorf("camera_name must be a string, got %v", value)
+	}
+	return pf.worker(name)
+}
+
+// getStats returns the stats of the camera given as "camera_name". Without one, the stats of the only camera are returned,
+// or if there are several cameras, the stats of each under "cameras".
+func (pf *prefilter) getStats(cmd map[string]interface{}) (map[string]interface{}, error) {
+	w, err := pf.cameraFromCommand(cmd)
+	if err != nil {
+		return nil, err
+	}
+	if w != nil {
+		return w.stats.toMap(), nil
+	}
+	cw := pf.cameras()
+	switch len(cw.names) {
+	case 0:
+		return nil, errors.New("there is no camera to get stats for")
+	case 1:
+		return cw.byName[cw.names[0]].stats.toMap(), nil
+	}
+	cameras := map[string]interface{}{}
+	for name, w := range cw.byName {
+		cameras[name] = w.stats.toMap()
+	}
+	return map[string]interface{}{"cameras": cameras}, nil
+}
+
+// resetStats resets the stats of the camera given as "camera_name", or of every camera
+func (pf *prefilter) resetStats(cmd map[string]interface{}) (map[string]interface{}, error) {
+	w, err := pf.cameraFromCommand(cmd)
+	if err != nil {
+		return nil, err
+	}
+	if w != nil {
+		w.stats.reset()
+		return map[string]interface{}{}, nil
+	}
+	for _, w := range pf.cameras().byName {
+		w.stats.reset()
+	}
+	return map[string]interface{}{}, nil
+}
+
+func (pf *prefilter) setThreshold(cmd map[string]interface{}) (map[string]interface{}, error) {
+	threshold, ok := cmd["threshold"].(float64)
+	if !ok {
+		return nil, errors.Errorf("%s needs a number between 0 and 1 as \"threshold\", got %v", cmdSetThreshold, cmd["threshold"])
+	}
+	if threshold > 1.0 || threshold < 0 {
+		return nil, errors.New("threshold must be a number between 0 and 1")
+	}
+	err := pf.updateRunConfig(nil, func(_ *cameraWorker, rc *RunConfig) error {
+		rc.Threshold = threshold
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return map[string]interface{}{"threshold": threshold}, nil
+}
+
+// setExcludedRegion replaces the excluded regions, either with the single rectangle given as "excluded_region",
+// or with the list of regions given as "excluded_regions", written the same way as in the config.
+// The included regions stay as they are. With "camera_name", only the regions of that camera change.
+// Without it, the regions of the service change, and with them those of every camera that has no camera_regions of its own.
+func (pf *prefilter) setExcludedRegion(cmd map[string]interface{}) (map[string]interface{}, error) {
+	w, err := pf.cameraFromCommand(cmd)
+	if err != nil {
+		return nil, err
+	}
+	var cfg Config
+	// round trip through JSON so the command is parsed exactly like the config attributes
+	b, err := json.Marshal(map[string]interface{}{
+		"excluded_region":  cmd["excluded_region"],
+		"excluded_regions": cmd["excluded_regions"],
+	})
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(b, &cfg); err != nil {
+		return nil, errors.Wrapf(err, "%s needs a list of four numbers as \"excluded_region\", "+
+			"or a list of regions as \"excluded_regions\"", cmdSetExcludedRegion)
+	}
+	_, hasOne := cmd["excluded_region"]
+	_, hasMany := cmd["excluded_regions"]
+	if !hasOne && !hasMany {
+		return nil, errors.Errorf("%s needs a list of four numbers as \"excluded_region\", "+
+			"or a list of regions as \"excluded_regions\". An empty list clears them", cmdSetExcludedRegion)
+	}
+	excludedOnly, err := cfg.regionMask()
+	if err != nil {
+		return nil, err
+	}
+	var excluded []Region
+	if excludedOnly != nil {
+		excluded = excludedOnly.Excluded
+	}
+	err = pf.updateRunConfig(w, func(target *cameraWorker, rc *RunConfig) error {
+		if w == nil && target != nil && target.ownRegions {
+			return nil
+		}
+		if rc.Mask == nil {
+			rc.Mask = NewRegionMask(excluded, nil, 0)
+		} else {
+			rc.Mask = NewRegionMask(excluded, rc.Mask.Included, rc.Mask.MaxMaskedFraction)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	resp := map[string]interface{}{}
+	if w != nil {
+		resp["camera_name"] = w.name
+	}
+	if hasOne {
+		resp["excluded_region"] = cmd["excluded_region"]
+	}
+	if hasMany {
+		resp["excluded_regions"] = cmd["excluded_regions"]
+	}
+	return resp, nil
+}
@@ -0,0 +1,86 @@
+package oceanprefilter
+
+import (
+	"image"
+)
+
+// PatchFeatures are the features of one patch of an image, exactly as the model gets them
+type PatchFeatures struct {
+	// Box is the area of the image the patch was taken from
+	Box image.Rectangle
+	// Row and Column are the place of the patch in the grid the water is split into.
+	// Columns are patch_width wide from the left of the image, and rows count down from the horizon.
+	Row, Column int
+	// HorizonY is the y the column of the patch is cropped at, the lowest point of the horizon over the column
+	HorizonY int
+	// Features are the average pooled brightness of the patch, row by row, with NaN for missing features
+	Features []float32
+}
+
+// NumFeatures is the length of the feature vector of a patch
+func (rc RunConfig) NumFeatures() int {
+	return numFeatures(rc.patchSize(), rc.poolWindow())
+}
+
+// ExtractFeatures finds the horizon of the image, splits the water below it into patches while leaving out
+// the excluded regions, and pools every patch into its features, the same way MakeInference does before it
+// scores them. The model of rc is not used.
+func ExtractFeatures(input image.Image, rc RunConfig) (Horizon, []PatchFeatures, error) {
+	horizon, imgs, err := rc.patches(input)
+	if err != nil {
+		return Horizon{}, nil, err
+	}
+	poolWindow := rc.poolWindow()
+	patches := make([]PatchFeatures, 0, len(imgs))
+	for _, p := range imgs {
+		features := make([]float32, rc.NumFeatures())
+		avgPool(p.img, poolWindow, features)
+		patches = append(patches, PatchFeatures{Box: p.box, Row: p.row, Column: p.col, HorizonY: p.top, Features: features})
+	}
+	return horizon, patches, nil
+}
+
+// Patch is one patch of an image, as the model sees it
+type Patch struct {
+	// Image is the patch, resized to the patch size with Lanczos resampling if it was cut short by the right
+	// or bottom edge of the image. It may share its pixels with the input image, so it must not be changed.
+	Image image.Image
+	// Box is the area of the image the patch was taken from, so Box.Min is where it was cropped
+	Box image.Rectangle
+	// Resized is true if the patch was cut short by the edge of the image and resized
+	Resized bool
+	// Row, Column and HorizonY are the same as the ones of PatchFeatures
+	Row, Column, HorizonY int
+	// Score is the "interesting" probability the model of rc gives the patch, 0 without a model
+	Score float64
+}
+
+// SplitPatches splits the water below the horizon into the patches MakeInference scores, and scores them with
+// the model of rc if it has one. Every patch is scored, and motion is not taken into account.
+func SplitPatches(input image.Image, rc RunConfig) (Horizon, []Patch, error) {
+	horizon, imgs, err := rc.patches(input)
+	if err != nil {
+		return Horizon{}, nil, err
+	}
+	var scores []patchScore
+	if rc.Model != nil {
+		rc.StopAtFirstTrigger = false
+		scores, _ = rc.scorePatches(imgs, nil)
+	}
+	patchSize := rc.patchSize()
+	patches := make([]Patch, 0, len(imgs))
+	for i, p := range imgs {
+		patch := Patch{
+			Image: p.img, Box: p.box, Resized: p.box.Size() != patchSize,
+			Row: p.row, Column: p.col, HorizonY: p.top,
+		}
+		if scores != nil {
+			if scores[i].err != nil {
+				return Horizon{}, nil, scores[i].err
+			}
+			patch.Score = scores[i].prob
+		}
+		patches = append(patches, patch)
+	}
+	return horizon, patches, nil
+}
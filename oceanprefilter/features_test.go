@@ -0,0 +1,69 @@
+package oceanprefilter
+
+import (
+	"image"
+	"math"
+	"testing"
+
+	"go.viam.com/test"
+)
+
+func TestExtractFeatures(t *testing.T) {
+	ensemble, err := loadModel("", numFeatures(defaultPatchSize, defaultPoolWindow))
+	test.That(t, err, test.ShouldBeNil)
+	frame := loadFrame(t, 1280, 720)
+	excluded := image.Rect(0, 600, 400, 720)
+	rc := RunConfig{Model: ensemble, Threshold: 1.1, Mask: NewRegionMask([]Region{RectRegion(excluded)}, nil, 0)}
+
+	horizon, patches, err := ExtractFeatures(frame, rc)
+	test.That(t, err, test.ShouldBeNil)
+	_, imgs, err := rc.patches(frame)
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, patches, test.ShouldHaveLength, len(imgs))
+	test.That(t, len(patches), test.ShouldBeGreaterThan, 0)
+	scores, scored := rc.scorePatches(imgs, nil)
+	test.That(t, scored, test.ShouldEqual, len(imgs))
+
+	inference, err := MakeInference(frame, rc)
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, horizon, test.ShouldResemble, inference.Horizon)
+	best := 0.0
+	for i, p := range patches {
+		test.That(t, p.Features, test.ShouldHaveLength, rc.NumFeatures())
+		test.That(t, p.Box.Overlaps(excluded), test.ShouldBeFalse)
+		// the grid place and horizon give back the box of the patch
+		test.That(t, p.Box.Min, test.ShouldResemble, image.Pt(p.Column*defaultPatchSize.X, p.HorizonY+p.Row*defaultPatchSize.Y))
+		test.That(t, float64(p.HorizonY), test.ShouldBeGreaterThanOrEqualTo, math.Floor(horizon.YAt(float64(p.Box.Min.X))))
+		// and the model scores the features the same as the patches it scores live
+		prob, err := interestingProbability(ensemble, p.Features)
+		test.That(t, err, test.ShouldBeNil)
+		test.That(t, prob, test.ShouldEqual, scores[i].prob)
+		best = math.Max(best, prob)
+	}
+	test.That(t, best, test.ShouldEqual, inference.Confidence)
+	test.That(t, RunConfig{PatchSize: image.Pt(100, 40), PoolWindow: image.Pt(5, 4)}.NumFeatures(), test.ShouldEqual, 200)
+
+	// the patch images are the ones the features come from, all of the patch size, and carry the same scores
+	rc.StopAtFirstTrigger = true
+	rc.Threshold = 0
+	_, crops, err := SplitPatches(frame, rc)
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, crops, test.ShouldHaveLength, len(patches))
+	resized := 0
+	for i, c := range crops {
+		test.That(t, c.Image.Bounds().Size(), test.ShouldResemble, defaultPatchSize)
+		test.That(t, c.Box, test.ShouldResemble, patches[i].Box)
+		test.That(t, []int{c.Row, c.Column, c.HorizonY}, test.ShouldResemble, []int{patches[i].Row, patches[i].Column, patches[i].HorizonY})
+		test.That(t, c.Score, test.ShouldEqual, scores[i].prob)
+		test.That(t, pooled(c.Image, defaultPoolWindow), test.ShouldResemble, patches[i].Features)
+		if c.Resized {
+			resized++
+		}
+	}
+	// 1280 isn't a multiple of 200, so the right column is resized
+	test.That(t, resized, test.ShouldBeGreaterThan, 0)
+	rc.Model = nil
+	_, crops, err = SplitPatches(frame, rc)
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, crops[0].Score, test.ShouldEqual, 0)
+}
@@ -0,0 +1,293 @@
+package oceanprefilter
+
+import (
+	"image"
+	"math"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	// horizonColumns is how many columns across the frame are searched for the edge of the sky
+	horizonColumns = 64
+	// maxHorizonTilt is the steepest horizon, in degrees, that is still believed to be the horizon
+	maxHorizonTilt = 30.0
+)
+
+// Horizon is the line between the sky and the water
+type Horizon struct {
+	// X0, Y0 and X1, Y1 are where the line crosses the left and right edge of the image
+	X0, Y0, X1, Y1 float64
+	// Confidence is the fraction of the searched columns whose edge of the sky lies on the line.
+	// It is 0 for a horizon that was only predicted.
+	Confidence float64
+	// Predicted is true if the line comes from the orientation of a movement sensor instead of the image
+	Predicted bool
+}
+
+// YAt returns the height of the horizon in column x
+func (h Horizon) YAt(x float64) float64 {
+	if h.X1 == h.X0 {
+		return h.Y0
+	}
+	return h.Y0 + (x-h.X0)*(h.Y1-h.Y0)/(h.X1-h.X0)
+}
+
+// Angle returns the tilt of the horizon in degrees, positive if the right side is lower
+func (h Horizon) Angle() float64 {
+	return math.Atan2(h.Y1-h.Y0, h.X1-h.X0) * 180 / math.Pi
+}
+
+// top returns the first row that is below the horizon everywhere from column x0 up to, not including, x1
+func (h Horizon) top(x0, x1 int) int {
+	y := math.Max(h.YAt(float64(x0)), h.YAt(float64(x1-1)))
+	return int(math.Ceil(y))
+}
+
+// fitHorizon finds the horizon in the thresholded image, where the sky is white
+func fitHorizon(mask *image.Gray) (Horizon, error) {
+	return fitHorizonNear(mask, nil, 0)
+}
+
+// fitHorizonNear finds the horizon in the thresholded image, where the sky is white. In each of the searched columns,
+// the bottom of the first white run is taken as the edge of the sky. Every pair of edges is tried as a line, the one
+// the most edges lie close to is kept, and it is refit by least squares through those edges, so that glare on the water
+// or a railing in a few columns doesn't move the horizon. With at most horizonColumns edges, trying every pair is cheap
+// and, unlike sampling pairs at random, always finds the same line.
+// Columns that are white all the way down have no edge. If a prior is given,
+// only edges at most maxDistance pixels away from it are used.
+func fitHorizonNear(mask *image.Gray, prior *Horizon, maxDistance float64) (Horizon, error) {
+	bounds := mask.Bounds()
+	if bounds.Dx() < 2 || bounds.Dy() < 2 {
+		return Horizon{}, errors.Errorf("image of %vx%v is too small to find the horizon in", bounds.Dx(), bounds.Dy())
+	}
+	nCols := horizonColumns
+	if bounds.Dx() < nCols {
+		nCols = bounds.Dx()
+	}
+	var xs, ys []float64
+	for i := 0; i < nCols; i++ {
+		x := bounds.Min.X + i*(bounds.Dx()-1)/(nCols-1)
+		// the sky is the first white run from the top, glare further down is not
+		inSky := false
+		for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+			white := mask.GrayAt(x, y).Y == 255
+			if inSky && !white {
+				if prior != nil && math.Abs(float64(y-1)-prior.YAt(float64(x))) > maxDistance {
+					break
+				}
+				xs = append(xs, float64(x))
+				ys = append(ys, float64(y-1))
+				break
+			}
+			inSky = inSky || white
+		}
+	}
+	if len(xs) < 2 {
+		return Horizon{}, errors.New("could not find horizon in image, there is no edge of the sky in it")
+	}
+
+	// every pair of edges is a candidate line, the one most other edges agree with wins
+	tolerance := math.Max(2, float64(bounds.Dy())/100)
+	maxSlope := math.Tan(maxHorizonTilt * math.Pi / 180)
+	bestCount := 0
+	var bestSlope, bestIntercept float64
+	for i := 0; i < len(xs); i++ {
+		for j := i + 1; j < len(xs); j++ {
+			slope := (ys[j] - ys[i]) / (xs[j] - xs[i])
+			if math.Abs(slope) > maxSlope {
+				continue
+			}
+			intercept := ys[i] - slope*xs[i]
+			count := 0
+			for k := range xs {
+				if math.Abs(slope*xs[k]+intercept-ys[k]) <= tolerance {
+					count++
+				}
+			}
+			if count > bestCount {
+				bestCount, bestSlope, bestIntercept = count, slope, intercept
+			}
+		}
+	}
+	if bestCount == 0 {
+		return Horizon{}, errors.Errorf("could not find horizon in image, no line is flatter than %v degrees", maxHorizonTilt)
+	}
+
+	// least squares over the edges that agree gives the final line
+	var sx, sy, sxx, sxy, n float64
+	for k := range xs {
+		if math.Abs(bestSlope*xs[k]+bestIntercept-ys[k]) <= tolerance {
+			sx += xs[k]
+			sy += ys[k]
+			sxx += xs[k] * xs[k]
+			sxy += xs[k] * ys[k]
+			n++
+		}
+	}
+	if d := n*sxx - sx*sx; d > 0 {
+		bestSlope = (n*sxy - sx*sy) / d
+		bestIntercept = (sy - bestSlope*sx) / n
+	}
+
+	x0, x1 := float64(bounds.Min.X), float64(bounds.Max.X-1)
+	return Horizon{
+		X0:         x0,
+		Y0:         bestSlope*x0 + bestIntercept,
+		X1:         x1,
+		Y1:         bestSlope*x1 + bestIntercept,
+		Confidence: float64(bestCount) / float64(nCols),
+	}, nil
+}
+
+// checkHorizonInFrame returns an error if the horizon leaves no water, or no sky, in the image
+func checkHorizonInFrame(horizon Horizon, bounds image.Rectangle) error {
+	if highest := math.Min(horizon.Y0, horizon.Y1); highest >= float64(bounds.Max.Y-1) {
+		return errors.Errorf("could not find horizon in image. Got a horizon value of y = %.0f", highest)
+	}
+	if lowest := math.Max(horizon.Y0, horizon.Y1); lowest <= float64(bounds.Min.Y+1) {
+		return errors.Errorf("could not find horizon in image. Got a horizon value of y = %.0f", lowest)
+	}
+	return nil
+}
+
+// the horizon strategies that can be chosen with horizon_strategy
+const (
+	// HorizonOtsuEdges finds the horizon in every image, as the edge of the bright sky
+	HorizonOtsuEdges = "otsu_edges"
+	// HorizonFixed uses a configured horizon, for cameras that are rigidly mounted
+	HorizonFixed = "fixed"
+	// HorizonNone looks at the whole image
+	HorizonNone = "none"
+)
+
+// HorizonStrategy decides where the water starts in an image
+type HorizonStrategy interface {
+	FindHorizon(img image.Image) (Horizon, error)
+}
+
+// horizonSearcher is a strategy that can narrow its search down to the area around a predicted horizon
+type horizonSearcher interface {
+	findHorizonNear(img image.Image, prior Horizon, maxDistance float64) (Horizon, error)
+}
+
+// OtsuEdgesHorizon thresholds the image with Otsu's method and fits a line to the edge of the sky
+type OtsuEdgesHorizon struct{}
+
+// FindHorizon finds the horizon in the image
+func (OtsuEdgesHorizon) FindHorizon(img image.Image) (Horizon, error) {
+	horizon, err := findHorizonLine(img)
+	if err != nil {
+		return Horizon{}, err
+	}
+	return horizon, checkHorizonInFrame(horizon, img.Bounds())
+}
+
+func (OtsuEdgesHorizon) findHorizonNear(img image.Image, prior Horizon, maxDistance float64) (Horizon, error) {
+	mask, err := horizonMask(img)
+	if err != nil {
+		return Horizon{}, err
+	}
+	horizon, err := fitHorizonNear(mask, &prior, maxDistance)
+	if err != nil {
+		return Horizon{}, err
+	}
+	return horizon, checkHorizonInFrame(horizon, img.Bounds())
+}
+
+// FixedHorizon is a horizon that never moves, given by its height at the left and right edge of the image
+type FixedHorizon struct {
+	Left, Right float64
+	// Normalized means the heights are fractions of the image height, instead of pixels
+	Normalized bool
+}
+
+// FindHorizon returns the fixed horizon in the coordinates of the image
+func (fh FixedHorizon) FindHorizon(img image.Image) (Horizon, error) {
+	bounds := img.Bounds()
+	y0, y1 := fh.Left, fh.Right
+	if fh.Normalized {
+		y0 = float64(bounds.Min.Y) + y0*float64(bounds.Dy())
+		y1 = float64(bounds.Min.Y) + y1*float64(bounds.Dy())
+	}
+	horizon := Horizon{X0: float64(bounds.Min.X), Y0: y0, X1: float64(bounds.Max.X - 1), Y1: y1, Confidence: 1}
+	if err := checkHorizonInFrame(horizon, bounds); err != nil {
+		return Horizon{}, errors.Wrap(err, "the fixed horizon doesn't fit this image")
+	}
+	return horizon, nil
+}
+
+// NoHorizon treats the whole image as water
+type NoHorizon struct{}
+
+// FindHorizon returns a horizon along the top edge of the image
+func (NoHorizon) FindHorizon(img image.Image) (Horizon, error) {
+	bounds := img.Bounds()
+	top := float64(bounds.Min.Y)
+	return Horizon{X0: float64(bounds.Min.X), Y0: top, X1: float64(bounds.Max.X - 1), Y1: top, Confidence: 1}, nil
+}
+
+// FixedHorizonConfig is how the fixed horizon is written in the config
+type FixedHorizonConfig struct {
+	// Left and Right are the height of the horizon at the left and right edge of the image
+	Left  float64 `json:"left"`
+	Right float64 `json:"right"`
+	// Normalized means the heights are fractions between 0 and 1 of the image height, instead of pixels
+	Normalized bool `json:"normalized,omitempty"`
+}
+
+// horizonStrategy builds the strategy from the horizon_strategy and fixed_horizon attributes
+func (cfg *Config) horizonStrategy() (HorizonStrategy, error) {
+	if cfg.FixedHorizon != nil && cfg.HorizonStrategy != HorizonFixed {
+		return nil, errors.Errorf("fixed_horizon is only used with horizon_strategy %q", HorizonFixed)
+	}
+	switch cfg.HorizonStrategy {
+	case "", HorizonOtsuEdges:
+		return OtsuEdgesHorizon{}, nil
+	case HorizonFixed:
+		fh := cfg.FixedHorizon
+		if fh == nil {
+			return nil, errors.Errorf("horizon_strategy %q needs the line as fixed_horizon", HorizonFixed)
+		}
+		if fh.Normalized && (fh.Left < 0 || fh.Left > 1 || fh.Right < 0 || fh.Right > 1) {
+			return nil, errors.New("a normalized fixed_horizon must be between 0 and 1")
+		}
+		if !fh.Normalized && (fh.Left < 0 || fh.Right < 0) {
+			return nil, errors.New("fixed_horizon can't be above the image")
+		}
+		return FixedHorizon{Left: fh.Left, Right: fh.Right, Normalized: fh.Normalized}, nil
+	case HorizonNone:
+		return NoHorizon{}, nil
+	default:
+		return nil, errors.Errorf("horizon_strategy must be %q, %q or %q, got %q",
+			HorizonOtsuEdges, HorizonFixed, HorizonNone, cfg.HorizonStrategy)
+	}
+}
+
+// findHorizon finds the horizon in the image with the configured strategy. If the horizon was predicted from
+// a movement sensor, the prediction is either used as is, or as a prior for the search, depending on the sensor horizon mode.
+func (rc RunConfig) findHorizon(input image.Image) (Horizon, error) {
+	strategy := rc.HorizonStrategy
+	if strategy == nil {
+		strategy = OtsuEdgesHorizon{}
+	}
+	predicted := rc.predictedHorizon
+	if predicted == nil {
+		return strategy.FindHorizon(input)
+	}
+	if rc.horizonSensor.mode == SensorHorizonPrimary {
+		return *predicted, checkHorizonInFrame(*predicted, input.Bounds())
+	}
+	searcher, ok := strategy.(horizonSearcher)
+	if !ok {
+		return strategy.FindHorizon(input)
+	}
+	horizon, err := searcher.findHorizonNear(input, *predicted, rc.horizonSensor.tolerance*float64(input.Bounds().Dy()))
+	if err != nil {
+		if rc.debug {
+			rc.logger.Debugf("using the horizon predicted by movement sensor %q: %v", rc.horizonSensor.name, err)
+		}
+		return *predicted, checkHorizonInFrame(*predicted, input.Bounds())
+	}
+	return horizon, nil
+}
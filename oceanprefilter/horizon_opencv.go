@@ -0,0 +1,38 @@
+//go:build !purego
+
+package oceanprefilter
+
+import (
+	"image"
+
+	"gocv.io/x/gocv"
+)
+
+// horizonMask separates the bright sky from the darker water, the sky is white in the returned image
+func horizonMask(pic image.Image) (*image.Gray, error) {
+	// make gray
+	gray := toGray(pic)
+	grayMat, err := gocv.ImageGrayToMatGray(gray)
+	if err != nil {
+		return nil, err
+	}
+	defer grayMat.Close()
+	gocv.GaussianBlur(grayMat, &grayMat, image.Pt(3, 3), 0, 0, gocv.BorderDefault)
+	// threshold to turn it into a binary image according to Otsu's method
+	_ = gocv.Threshold(grayMat, &grayMat, 0, 255, gocv.ThresholdOtsu)
+	oneScalar := gocv.NewScalar(255, 0, 0, 0)
+	kernelMorph := gocv.NewMatWithSize(9, 9, gocv.MatTypeCV8U)
+	defer kernelMorph.Close()
+	kernelMorph.SetTo(oneScalar)
+	// smooth out holes with morphology transform
+	gocv.MorphologyEx(grayMat, &grayMat, gocv.MorphClose, kernelMorph)
+
+	maskImg, err := grayMat.ToImage()
+	if err != nil {
+		return nil, err
+	}
+	mask := toGray(maskImg)
+	// the mat starts at 0, 0, keep the coordinates of the input
+	mask.Rect = mask.Rect.Add(pic.Bounds().Min)
+	return mask, nil
+}
@@ -0,0 +1,142 @@
+//go:build purego
+
+package oceanprefilter
+
+import (
+	"image"
+)
+
+// horizonMorphRadius is the radius of the 9x9 square the mask is closed with
+const horizonMorphRadius = 4
+
+// horizonMask separates the bright sky from the darker water, the sky is white in the returned image.
+// It is the same pipeline as the OpenCV build, written in Go: a 3x3 Gaussian blur, a threshold with
+// Otsu's method and a morphological close with a 9x9 square, each with the borders OpenCV uses.
+func horizonMask(pic image.Image) (*image.Gray, error) {
+	bounds := pic.Bounds()
+	gray := toGray(pic)
+	w, h := bounds.Dx(), bounds.Dy()
+	pix := make([]uint8, w*h)
+	for y := 0; y < h; y++ {
+		copy(pix[y*w:(y+1)*w], gray.Pix[gray.PixOffset(bounds.Min.X, bounds.Min.Y+y):])
+	}
+	pix = gaussianBlur3(pix, w, h)
+	threshold := otsuThreshold(pix)
+	for i, v := range pix {
+		if int(v) > threshold {
+			pix[i] = 255
+		} else {
+			pix[i] = 0
+		}
+	}
+	// smooth out holes with a close, which is a dilate followed by an erode
+	pix = morph(pix, w, h, horizonMorphRadius, true)
+	pix = morph(pix, w, h, horizonMorphRadius, false)
+	return &image.Gray{Pix: pix, Stride: w, Rect: bounds}, nil
+}
+
+// reflect101 maps a coordinate outside of 0..n-1 back into it, mirrored at the edge pixel like
+// OpenCV's default border: -1 is 1, and n is n-2
+func reflect101(i, n int) int {
+	if n == 1 {
+		return 0
+	}
+	for i < 0 || i >= n {
+		if i < 0 {
+			i = -i
+		}
+		if i >= n {
+			i = 2*n - 2 - i
+		}
+	}
+	return i
+}
+
+// gaussianBlur3 blurs with the 3x3 kernel [1 2 1] x [1 2 1] / 16, rounded to the nearest value
+func gaussianBlur3(src []uint8, w, h int) []uint8 {
+	rows := make([]uint16, w*h)
+	for y := 0; y < h; y++ {
+		row := src[y*w : (y+1)*w]
+		for x := 0; x < w; x++ {
+			rows[y*w+x] = uint16(row[reflect101(x-1, w)]) + 2*uint16(row[x]) + uint16(row[reflect101(x+1, w)])
+		}
+	}
+	out := make([]uint8, w*h)
+	for y := 0; y < h; y++ {
+		above, below := reflect101(y-1, h)*w, reflect101(y+1, h)*w
+		for x := 0; x < w; x++ {
+			v := uint32(rows[above+x]) + 2*uint32(rows[y*w+x]) + uint32(rows[below+x])
+			out[y*w+x] = uint8((v + 8) >> 4)
+		}
+	}
+	return out
+}
+
+// otsuThreshold returns the threshold that best separates the values into two classes, by maximizing
+// the variance between the classes. Values above the threshold are in the bright class.
+// The arithmetic follows OpenCV's, so both give the same threshold.
+func otsuThreshold(pix []uint8) int {
+	const fltEpsilon = 1.1920929e-07
+	var hist [256]int
+	for _, v := range pix {
+		hist[v]++
+	}
+	scale := 1 / float64(len(pix))
+	mu := 0.0
+	for i, n := range hist {
+		mu += float64(i) * float64(n)
+	}
+	mu *= scale
+	var mu1, q1, maxSigma float64
+	threshold := 0
+	for i, n := range hist {
+		p := float64(n) * scale
+		mu1 *= q1
+		q1 += p
+		q2 := 1 - q1
+		if min(q1, q2) < fltEpsilon || max(q1, q2) > 1-fltEpsilon {
+			continue
+		}
+		mu1 = (mu1 + float64(i)*p) / q1
+		mu2 := (mu - q1*mu1) / q2
+		sigma := q1 * q2 * (mu1 - mu2) * (mu1 - mu2)
+		if sigma > maxSigma {
+			maxSigma = sigma
+			threshold = i
+		}
+	}
+	return threshold
+}
+
+// morph dilates, or erodes, with a square of the given radius. Pixels outside of the image are left out,
+// like OpenCV does by default.
+func morph(src []uint8, w, h, radius int, dilate bool) []uint8 {
+	pick := func(a, b uint8) uint8 {
+		if dilate == (b > a) {
+			return b
+		}
+		return a
+	}
+	// the square is separable, so go along the rows and then along the columns
+	rows := make([]uint8, w*h)
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			v := src[y*w+x]
+			for xx := max(x-radius, 0); xx <= min(x+radius, w-1); xx++ {
+				v = pick(v, src[y*w+xx])
+			}
+			rows[y*w+x] = v
+		}
+	}
+	out := make([]uint8, w*h)
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			v := rows[y*w+x]
+			for yy := max(y-radius, 0); yy <= min(y+radius, h-1); yy++ {
+				v = pick(v, rows[yy*w+x])
+			}
+			out[y*w+x] = v
+		}
+	}
+	return out
+}
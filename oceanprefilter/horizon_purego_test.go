@@ -0,0 +1,80 @@
+//go:build purego
+
+package oceanprefilter
+
+import (
+	"image"
+	"testing"
+
+	"go.viam.com/test"
+)
+
+func TestPureGoHorizonMask(t *testing.T) {
+	// the border is mirrored at the edge pixel
+	test.That(t, reflect101(-1, 5), test.ShouldEqual, 1)
+	test.That(t, reflect101(5, 5), test.ShouldEqual, 3)
+	test.That(t, reflect101(2, 5), test.ShouldEqual, 2)
+	test.That(t, reflect101(-1, 1), test.ShouldEqual, 0)
+
+	// a single bright pixel spreads out as the kernel
+	impulse := make([]uint8, 25)
+	impulse[12] = 160
+	test.That(t, gaussianBlur3(impulse, 5, 5), test.ShouldResemble, []uint8{
+		0, 0, 0, 0, 0,
+		0, 10, 20, 10, 0,
+		0, 20, 40, 20, 0,
+		0, 10, 20, 10, 0,
+		0, 0, 0, 0, 0,
+	})
+	// and a flat image stays flat, also at the borders
+	flat := []uint8{7, 7, 7, 7, 7, 7}
+	test.That(t, gaussianBlur3(flat, 3, 2), test.ShouldResemble, flat)
+
+	// the threshold is the first value of the dark class
+	twoTone := make([]uint8, 100)
+	for i := range twoTone {
+		twoTone[i] = 50
+		if i >= 60 {
+			twoTone[i] = 200
+		}
+	}
+	test.That(t, otsuThreshold(twoTone), test.ShouldEqual, 50)
+	// a flat image has no second class
+	test.That(t, otsuThreshold(flat), test.ShouldEqual, 0)
+
+	// closing fills holes smaller than the square, and keeps the wide dark stripe
+	w, h := 30, 30
+	pix := make([]uint8, w*h)
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			if y < 15 {
+				pix[y*w+x] = 255
+			}
+		}
+	}
+	for y := 5; y < 8; y++ {
+		for x := 10; x < 13; x++ {
+			pix[y*w+x] = 0
+		}
+	}
+	closed := morph(morph(pix, w, h, horizonMorphRadius, true), w, h, horizonMorphRadius, false)
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			want := uint8(0)
+			if y < 15 {
+				want = 255
+			}
+			test.That(t, closed[y*w+x], test.ShouldEqual, want)
+		}
+	}
+
+	// the mask keeps the coordinates of a cropped image
+	frame := loadFrame(t, 640, 480)
+	crop := frame.(*image.RGBA).SubImage(image.Rect(100, 50, 500, 400))
+	mask, err := horizonMask(crop)
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, mask.Bounds(), test.ShouldResemble, crop.Bounds())
+	full, err := horizonMask(toGray(crop))
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, full.Pix, test.ShouldResemble, mask.Pix)
+}
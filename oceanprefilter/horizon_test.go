@@ -0,0 +1,183 @@
+package oceanprefilter
+
+import (
+	"image"
+	"image/color"
+	"math"
+	"os"
+	"testing"
+
+	"github.com/disintegration/imaging"
+	"go.viam.com/test"
+)
+
+// horizonTestMask draws white sky above the line from (0, y0) to (w-1, y1)
+func horizonTestMask(w, h int, y0, y1 float64) *image.Gray {
+	mask := image.NewGray(image.Rect(0, 0, w, h))
+	for x := 0; x < w; x++ {
+		edge := y0 + float64(x)*(y1-y0)/float64(w-1)
+		for y := 0; y < h && float64(y) <= edge; y++ {
+			mask.SetGray(x, y, color.Gray{Y: 255})
+		}
+	}
+	return mask
+}
+
+func TestFitHorizon(t *testing.T) {
+	// a level horizon
+	horizon, err := fitHorizon(horizonTestMask(640, 480, 200, 200))
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, horizon.Y0, test.ShouldAlmostEqual, 200, 0.5)
+	test.That(t, horizon.Y1, test.ShouldAlmostEqual, 200, 0.5)
+	test.That(t, horizon.Angle(), test.ShouldAlmostEqual, 0, 0.1)
+	test.That(t, horizon.Confidence, test.ShouldEqual, 1.0)
+
+	// a tilted horizon, with glare on the water and a railing along the left edge
+	mask := horizonTestMask(640, 480, 150, 300)
+	for y := 380; y < 400; y++ {
+		for x := 300; x < 360; x++ {
+			mask.SetGray(x, y, color.Gray{Y: 255})
+		}
+	}
+	for y := 0; y < 480; y++ {
+		for x := 0; x < 15; x++ {
+			mask.SetGray(x, y, color.Gray{Y: 255})
+		}
+	}
+	horizon, err = fitHorizon(mask)
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, horizon.Y0, test.ShouldAlmostEqual, 150, 1)
+	test.That(t, horizon.Y1, test.ShouldAlmostEqual, 300, 1)
+	test.That(t, horizon.Angle(), test.ShouldAlmostEqual, math.Atan2(150, 639)*180/math.Pi, 0.2)
+	test.That(t, horizon.YAt(319.5), test.ShouldAlmostEqual, 225, 1)
+	test.That(t, horizon.Confidence, test.ShouldBeLessThan, 1.0)
+	test.That(t, horizon.Confidence, test.ShouldBeGreaterThan, 0.8)
+
+	// no sky, or a line too steep to be the horizon
+	_, err = fitHorizon(image.NewGray(image.Rect(0, 0, 640, 480)))
+	test.That(t, err, test.ShouldNotBeNil)
+	_, err = fitHorizon(horizonTestMask(100, 480, 0, 479))
+	test.That(t, err, test.ShouldNotBeNil)
+}
+
+func TestSplitUpImageBelowTilted(t *testing.T) {
+	img := MockImage(640, 480)
+	horizon := Horizon{X0: 0, Y0: 100, X1: 639, Y1: 260}
+	patches, err := splitUpImageBelow(img, nil, horizon, 80, 200)
+	test.That(t, err, test.ShouldBeNil)
+	tops := map[int]int{}
+	for _, p := range patches {
+		// no patch reaches above the horizon
+		test.That(t, float64(p.box.Min.Y), test.ShouldBeGreaterThanOrEqualTo, horizon.YAt(float64(p.box.Min.X)))
+		test.That(t, float64(p.box.Min.Y), test.ShouldBeGreaterThanOrEqualTo, horizon.YAt(float64(p.box.Max.X-1)))
+		test.That(t, p.img.Bounds().Dx(), test.ShouldEqual, 200)
+		test.That(t, p.img.Bounds().Dy(), test.ShouldEqual, 80)
+		if top, ok := tops[p.box.Min.X]; !ok || p.box.Min.Y < top {
+			tops[p.box.Min.X] = p.box.Min.Y
+		}
+	}
+	// each column follows the line instead of starting at its lowest point
+	test.That(t, tops[0], test.ShouldEqual, 150)
+	test.That(t, tops[600], test.ShouldEqual, 260)
+	// the columns on the left have more rows of water
+	test.That(t, len(patches), test.ShouldEqual, 5+4+3+3)
+
+	// a level horizon splits like a constant crop
+	level, err := splitUpImageBelow(img, nil, Horizon{X0: 0, Y0: 100, X1: 639, Y1: 100}, 80, 200)
+	test.That(t, err, test.ShouldBeNil)
+	constant, err := splitUpImageConst(img, nil, 100, 80, 200)
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, len(level), test.ShouldEqual, len(constant))
+	for i := range level {
+		test.That(t, level[i].box, test.ShouldResemble, constant[i].box)
+	}
+}
+
+func TestHorizonStrategies(t *testing.T) {
+	img := MockImage(640, 480)
+
+	strategy, err := (&Config{}).horizonStrategy()
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, strategy, test.ShouldResemble, OtsuEdgesHorizon{})
+
+	// a fixed horizon in pixels, or as fractions of the image height
+	strategy, err = (&Config{HorizonStrategy: HorizonFixed, FixedHorizon: &FixedHorizonConfig{Left: 100, Right: 140}}).horizonStrategy()
+	test.That(t, err, test.ShouldBeNil)
+	horizon, err := strategy.FindHorizon(img)
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, horizon.Y0, test.ShouldEqual, 100)
+	test.That(t, horizon.Y1, test.ShouldEqual, 140)
+	strategy, err = (&Config{HorizonStrategy: HorizonFixed, FixedHorizon: &FixedHorizonConfig{Left: 0.5, Right: 0.5, Normalized: true}}).horizonStrategy()
+	test.That(t, err, test.ShouldBeNil)
+	horizon, err = strategy.FindHorizon(MockImage(1280, 720))
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, horizon.Y0, test.ShouldEqual, 360)
+	// a fixed horizon below a smaller image leaves no water
+	_, err = FixedHorizon{Left: 500, Right: 500}.FindHorizon(img)
+	test.That(t, err, test.ShouldNotBeNil)
+
+	// the patches start at the configured horizon, or at the top of the image without one
+	ensemble, err := loadModel("", numFeatures(defaultPatchSize, defaultPoolWindow))
+	test.That(t, err, test.ShouldBeNil)
+	rc := RunConfig{Model: ensemble, Threshold: 0, HorizonStrategy: FixedHorizon{Left: 100, Right: 100}}
+	res, err := MakeInference(img, rc)
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, res.Horizon.Y0, test.ShouldEqual, 100)
+	test.That(t, len(res.Detections), test.ShouldEqual, 20)
+	for _, d := range res.Detections {
+		test.That(t, d.BoundingBox().Min.Y, test.ShouldBeGreaterThanOrEqualTo, 100)
+	}
+	rc.HorizonStrategy = NoHorizon{}
+	res, err = MakeInference(img, rc)
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, len(res.Detections), test.ShouldEqual, 24)
+	test.That(t, res.Detections[0].BoundingBox().Min, test.ShouldResemble, image.Point{0, 0})
+
+	for _, bad := range []*Config{
+		{HorizonStrategy: "sometimes"},
+		{HorizonStrategy: HorizonFixed},
+		{HorizonStrategy: HorizonNone, FixedHorizon: &FixedHorizonConfig{Left: 1, Right: 1}},
+		{HorizonStrategy: HorizonFixed, FixedHorizon: &FixedHorizonConfig{Left: 0.5, Right: 1.5, Normalized: true}},
+		{HorizonStrategy: HorizonFixed, FixedHorizon: &FixedHorizonConfig{Left: -10, Right: 10}},
+	} {
+		_, err = bad.horizonStrategy()
+		test.That(t, err, test.ShouldNotBeNil)
+	}
+}
+
+// horizonTolerance is how many pixels the horizon of the OpenCV and the pure Go build may differ by at the edges
+// of a frame, as their masks can differ by a pixel where blurring rounds differently
+const horizonTolerance = 3.0
+
+func TestFindHorizonLine(t *testing.T) {
+	// this test has no build tag, so both builds find the same horizons in the same frames
+	f, err := os.Open("test_data/2288.jpg")
+	test.That(t, err, test.ShouldBeNil)
+	frame, _, err := image.Decode(f)
+	f.Close()
+	test.That(t, err, test.ShouldBeNil)
+	lower := imaging.Crop(frame, image.Rect(0, 100, frame.Bounds().Dx(), frame.Bounds().Dy()))
+
+	for _, tc := range []struct {
+		name   string
+		frame  image.Image
+		y0, y1 float64
+	}{
+		{"frame", frame, 216.04, 227.48},
+		{"mirrored", imaging.FlipH(frame), 227.69, 215.58},
+		// black corners from the rotation, which are dark like the water
+		{"tilted", imaging.Rotate(frame, 4, image.Black), 278.23, 226.12},
+		// less sky gives Otsu's method another threshold, and the horizon is relative to the crop
+		{"lower", lower, 114.39, 127.87},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			horizon, err := findHorizonLine(tc.frame)
+			test.That(t, err, test.ShouldBeNil)
+			test.That(t, horizon.X0, test.ShouldEqual, 0)
+			test.That(t, horizon.X1, test.ShouldEqual, tc.frame.Bounds().Dx()-1)
+			test.That(t, horizon.Y0, test.ShouldAlmostEqual, tc.y0, horizonTolerance)
+			test.That(t, horizon.Y1, test.ShouldAlmostEqual, tc.y1, horizonTolerance)
+			test.That(t, horizon.Confidence, test.ShouldBeGreaterThan, 0.85)
+		})
+	}
+}
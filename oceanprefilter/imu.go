@@ -0,0 +1,81 @@
+package oceanprefilter
+
+import (
+	"context"
+	"image"
+	"math"
+
+	"github.com/pkg/errors"
+	"go.viam.com/rdk/components/movementsensor"
+)
+
+const (
+	// SensorHorizonPrior only lets the image based search find a horizon near the one predicted from the
+	// movement sensor, and uses the prediction when the image doesn't show a horizon at all
+	SensorHorizonPrior = "prior"
+	// SensorHorizonPrimary uses the horizon predicted from the movement sensor and skips the image based search
+	SensorHorizonPrimary = "primary"
+	// DefaultSensorHorizonTolerance is how far, as a fraction of the image height, the edge of the sky
+	// may be from the predicted horizon and still be used in the image based search
+	DefaultSensorHorizonTolerance = 0.1
+)
+
+// checkSensorHorizonMode returns the sensor horizon mode to use, defaulting to SensorHorizonPrior
+func checkSensorHorizonMode(mode string) (string, error) {
+	switch mode {
+	case "":
+		return SensorHorizonPrior, nil
+	case SensorHorizonPrior, SensorHorizonPrimary:
+		return mode, nil
+	default:
+		return "", errors.Errorf("sensor_horizon_mode must be %q or %q, got %q", SensorHorizonPrior, SensorHorizonPrimary, mode)
+	}
+}
+
+// horizonSensor predicts where the horizon is in the camera image from the orientation of a movement sensor.
+// The sensor is expected to be mounted with its x axis pointing where the camera looks and its z axis up,
+// so that a positive pitch points the camera down and a positive roll lowers the right side of the image.
+// The offsets are added to the angles of the sensor, for a camera that is mounted pointing somewhat down, or a sensor that isn't level.
+type horizonSensor struct {
+	sensor      movementsensor.MovementSensor
+	name        string
+	mode        string
+	verticalFOV float64 // radians
+	pitchOffset float64 // radians
+	rollOffset  float64 // radians
+	tolerance   float64
+}
+
+// predict returns the horizon the orientation of the sensor gives for a frame with the given bounds
+func (hs *horizonSensor) predict(ctx context.Context, bounds image.Rectangle) (Horizon, error) {
+	orientation, err := hs.sensor.Orientation(ctx, nil)
+	if err != nil {
+		return Horizon{}, errors.Wrapf(err, "unable to get orientation from movement sensor %q", hs.name)
+	}
+	angles := orientation.EulerAngles()
+	return predictHorizon(bounds, hs.verticalFOV, angles.Pitch+hs.pitchOffset, angles.Roll+hs.rollOffset)
+}
+
+// predictHorizon projects the level horizon into the image of a pinhole camera with the given vertical field of view,
+// pitched down by pitch and rolled to the right by roll, all in radians
+func predictHorizon(bounds image.Rectangle, verticalFOV, pitch, roll float64) (Horizon, error) {
+	if verticalFOV <= 0 || verticalFOV >= math.Pi {
+		return Horizon{}, errors.Errorf("vertical field of view must be between 0 and 180 degrees, got %v", verticalFOV*180/math.Pi)
+	}
+	focal := float64(bounds.Dy()) / 2 / math.Tan(verticalFOV/2)
+	cx := float64(bounds.Min.X) + float64(bounds.Dx())/2
+	cy := float64(bounds.Min.Y) + float64(bounds.Dy())/2
+	// straight up, in the coordinates of the camera: x to the right, y down and z where the camera looks
+	ux := -math.Sin(roll) * math.Cos(pitch)
+	uy := -math.Cos(roll) * math.Cos(pitch)
+	uz := -math.Sin(pitch)
+	if math.Abs(uy) < 1e-6 {
+		return Horizon{}, errors.New("camera is pointing straight up or down, or is on its side, so there is no horizon to predict")
+	}
+	// the horizon is every direction that is perpendicular to up
+	yAt := func(x float64) float64 {
+		return cy - (ux*(x-cx)+uz*focal)/uy
+	}
+	x0, x1 := float64(bounds.Min.X), float64(bounds.Max.X-1)
+	return Horizon{X0: x0, Y0: yAt(x0), X1: x1, Y1: yAt(x1), Predicted: true}, nil
+}
@@ -0,0 +1,127 @@
+package oceanprefilter
+
+import (
+	"context"
+	"errors"
+	"image"
+	"image/color"
+	"image/draw"
+	"math"
+	"os"
+	"testing"
+
+	"go.viam.com/rdk/components/movementsensor"
+	"go.viam.com/rdk/spatialmath"
+	"go.viam.com/test"
+)
+
+// fakeMovementSensor is a movement sensor that only implements Orientation
+type fakeMovementSensor struct {
+	movementsensor.MovementSensor
+	angles spatialmath.EulerAngles
+	err    error
+}
+
+func (fs *fakeMovementSensor) Orientation(ctx context.Context, extra map[string]interface{}) (spatialmath.Orientation, error) {
+	if fs.err != nil {
+		return nil, fs.err
+	}
+	angles := fs.angles
+	return &angles, nil
+}
+
+func TestPredictHorizon(t *testing.T) {
+	bounds := image.Rect(0, 0, 640, 480)
+	fov := 60 * math.Pi / 180
+	focal := 240 / math.Tan(fov/2)
+	deg := math.Pi / 180
+
+	// a level camera sees the horizon through the middle of the image
+	horizon, err := predictHorizon(bounds, fov, 0, 0)
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, horizon.Y0, test.ShouldAlmostEqual, 240, 1e-9)
+	test.That(t, horizon.Y1, test.ShouldAlmostEqual, 240, 1e-9)
+	test.That(t, horizon.Predicted, test.ShouldBeTrue)
+
+	// pointing down moves the horizon up
+	horizon, err = predictHorizon(bounds, fov, 10*deg, 0)
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, horizon.YAt(320), test.ShouldAlmostEqual, 240-focal*math.Tan(10*deg), 1e-9)
+	// and half the field of view down puts it at the top edge
+	horizon, err = predictHorizon(bounds, fov, 30*deg, 0)
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, horizon.YAt(320), test.ShouldAlmostEqual, 0, 1e-9)
+
+	// rolling the right side down raises the right side of the horizon
+	horizon, err = predictHorizon(bounds, fov, 0, 5*deg)
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, horizon.YAt(320), test.ShouldAlmostEqual, 240, 1e-9)
+	test.That(t, horizon.Angle(), test.ShouldAlmostEqual, -5, 1e-9)
+
+	_, err = predictHorizon(bounds, fov, 90*deg, 0)
+	test.That(t, err, test.ShouldNotBeNil)
+	_, err = predictHorizon(bounds, 0, 0, 0)
+	test.That(t, err, test.ShouldNotBeNil)
+}
+
+func TestSensorHorizon(t *testing.T) {
+	ctx := context.Background()
+	f, err := os.Open("test_data/2288.jpg")
+	test.That(t, err, test.ShouldBeNil)
+	defer f.Close()
+	img, _, err := image.Decode(f)
+	test.That(t, err, test.ShouldBeNil)
+	ensemble, err := loadModel("", numFeatures(defaultPatchSize, defaultPoolWindow))
+	test.That(t, err, test.ShouldBeNil)
+	deg := math.Pi / 180
+
+	// the horizon of the test image is about 20 pixels above the middle, which a camera pitched down 4 degrees sees
+	sensor := &fakeMovementSensor{angles: spatialmath.EulerAngles{Pitch: 4 * deg}}
+	hs := &horizonSensor{sensor: sensor, name: "imu", mode: SensorHorizonPrior, verticalFOV: 60 * deg, tolerance: 0.1}
+	rc := RunConfig{Model: ensemble, Threshold: 0.25, horizonSensor: hs}
+	res, err := infer(ctx, img, rc)
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, res.Horizon.Predicted, test.ShouldBeFalse)
+	test.That(t, res.Horizon.YAt(427), test.ShouldAlmostEqual, 222, 6)
+
+	// as the primary horizon, the image isn't looked at
+	hs.mode = SensorHorizonPrimary
+	res, err = infer(ctx, img, rc)
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, res.Horizon.Predicted, test.ShouldBeTrue)
+	test.That(t, res.Horizon.YAt(427), test.ShouldAlmostEqual, 240-240/math.Tan(30*deg)*math.Tan(4*deg), 1e-6)
+
+	// fog hides the horizon, so the image alone can't find one, but the prediction can be used instead
+	fog := image.NewUniform(color.Gray{Y: 128})
+	foggy := image.NewRGBA(image.Rect(0, 0, 640, 480))
+	draw.Draw(foggy, foggy.Bounds(), fog, image.Point{}, draw.Src)
+	_, err = infer(ctx, foggy, RunConfig{Model: ensemble, Threshold: 0.25})
+	test.That(t, err, test.ShouldNotBeNil)
+	hs.mode = SensorHorizonPrior
+	res, err = infer(ctx, foggy, rc)
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, res.Horizon.Predicted, test.ShouldBeTrue)
+
+	// a prior far from the real horizon keeps the search from finding it
+	sensor.angles.Pitch = -10 * deg
+	res, err = infer(ctx, img, rc)
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, res.Horizon.Predicted, test.ShouldBeTrue)
+
+	// without orientation the image is searched on its own, unless the sensor is the primary horizon
+	sensor.err = errors.New("no orientation")
+	res, err = infer(ctx, img, rc)
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, res.Horizon.Predicted, test.ShouldBeFalse)
+	hs.mode = SensorHorizonPrimary
+	_, err = infer(ctx, img, rc)
+	test.That(t, err, test.ShouldNotBeNil)
+
+	// a still isn't cropped with the orientation of the mount, even with the sensor as the primary horizon
+	sensor.err = nil
+	sensor.angles.Pitch = 4 * deg
+	res, err = infer(ctx, img, rc.ForStills())
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, res.Horizon.Predicted, test.ShouldBeFalse)
+	test.That(t, res.Horizon.YAt(427), test.ShouldAlmostEqual, 222, 6)
+}
@@ -0,0 +1,137 @@
+package oceanprefilter
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"image"
+	"os"
+
+	"github.com/pkg/errors"
+	"github.com/viamrobotics/ocean-prefilter/internal/xgbdump"
+)
+
+//go:generate go run ../cmd/xgbgen -in xg_boost_dump.json -out model_gen.go -prefix embeddedModel
+
+const (
+	// modelNumClasses is the number of classes MakeInference expects: 0 is boring water, 1 is interesting
+	modelNumClasses = 2
+	// interestingClass is the index of the class that makes the prefilter trigger
+	interestingClass = 1
+)
+
+var (
+	// defaultPatchSize is the width and height of the patches the water is split into
+	defaultPatchSize = image.Point{X: 200, Y: 80}
+	// defaultPoolWindow is the width and height of the window each patch is average pooled with.
+	// 200x80 patches pooled with a 10x2 window give 40 rows of 20 features, the 800 features the embedded model uses.
+	defaultPoolWindow = image.Point{X: 10, Y: 2}
+)
+
+// numFeatures is the length of the feature vector of one patch
+func numFeatures(patchSize, poolWindow image.Point) int {
+	return (patchSize.Y / poolWindow.Y) * (patchSize.X / poolWindow.X)
+}
+
+// checkPatchGeometry makes sure the patches can be evenly average pooled with the window
+func checkPatchGeometry(patchSize, poolWindow image.Point) error {
+	if patchSize.X <= 0 || patchSize.Y <= 0 {
+		return errors.Errorf("patch_width and patch_height must be positive, got %vx%v", patchSize.X, patchSize.Y)
+	}
+	if poolWindow.X <= 0 || poolWindow.Y <= 0 {
+		return errors.Errorf("pool_window must be a positive width and height, got %vx%v", poolWindow.X, poolWindow.Y)
+	}
+	if patchSize.X%poolWindow.X != 0 || patchSize.Y%poolWindow.Y != 0 {
+		return errors.Errorf("patches of %vx%v can not be evenly split up by a pool_window of %vx%v",
+			patchSize.X, patchSize.Y, poolWindow.X, poolWindow.Y)
+	}
+	return nil
+}
+
+// loadModel loads the XGBoost model found at modelPath, a JSON dump or a model saved as JSON or UBJSON.
+// If modelPath is empty, the model embedded in the module is used instead. The model may only use the first nFeatures features.
+func loadModel(modelPath string, nFeatures int) (*XGBoostModel, error) {
+	data := modelbytes
+	if modelPath != "" {
+		var err error
+		data, err = os.ReadFile(modelPath)
+		if err != nil {
+			return nil, errors.Wrapf(err, "unable to read model file %q", modelPath)
+		}
+	}
+	return loadModelFromBytes(data, nFeatures)
+}
+
+// LoadXGBoostModel loads an XGBoost model for the default patch size and pool window. The model is either
+// a JSON dump from dump_model, or a model saved with save_model as JSON or UBJSON.
+func LoadXGBoostModel(data []byte) (*XGBoostModel, error) {
+	return loadModelFromBytes(data, numFeatures(defaultPatchSize, defaultPoolWindow))
+}
+
+// loadModelFromBytes checks that the XGBoost model is one that MakeInference can use, and then loads it
+func loadModelFromBytes(data []byte, nFeatures int) (*XGBoostModel, error) {
+	if isNativeModel(data) {
+		return loadNativeModel(data, nFeatures)
+	}
+	var trees []*xgbdump.Node
+	if err := json.Unmarshal(data, &trees); err != nil {
+		return nil, errors.Wrap(err, "model is not a valid XGBoost JSON dump")
+	}
+	if len(trees) == 0 {
+		return nil, errors.New("model does not contain any trees")
+	}
+	if len(trees)%modelNumClasses != 0 {
+		return nil, errors.Errorf("model has %v trees, which is not a multiple of the %v classes the prefilter expects. "+
+			"Make sure the model was trained as a binary multi:softprob or multi:softmax classifier", len(trees), modelNumClasses)
+	}
+	for i, tree := range trees {
+		maxFeature, err := checkDumpTree(tree)
+		if err != nil {
+			return nil, errors.Wrapf(err, "error in tree %v of model", i)
+		}
+		if maxFeature >= nFeatures {
+			return nil, errors.Errorf("tree %v of model splits on feature f%v, but each patch only has %v features. "+
+				"Check that patch_width, patch_height and pool_window match the ones the model was trained with",
+				i, maxFeature, nFeatures)
+		}
+	}
+	model, err := buildXGBoostModel(trees, modelNumClasses, nFeatures)
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to properly load XGBoost model")
+	}
+	// the embedded model, or a copy of it, is scored with the code generated from it
+	if digest := sha256.Sum256(data); hex.EncodeToString(digest[:]) == embeddedModelDigest {
+		// it was trained on the default patches, other patches put the features it reads somewhere else
+		model.trainedFeatures = numFeatures(defaultPatchSize, defaultPoolWindow)
+		if nFeatures != model.trainedFeatures {
+			return nil, errors.Errorf("the embedded model was trained on %v features, but each patch has %v features. "+
+				"Use patch_width, patch_height and pool_window that give %v features, or a model trained on them",
+				model.trainedFeatures, nFeatures, model.trainedFeatures)
+		}
+		model.compiled = embeddedModelScores
+		model.compiledFeatures = embeddedModelNumFeatures
+	}
+	return model, nil
+}
+
+// checkDumpTree walks one tree of the dump and returns the largest feature index it splits on
+func checkDumpTree(root *xgbdump.Node) (int, error) {
+	maxFeature := -1
+	stack := []*xgbdump.Node{root}
+	for len(stack) > 0 {
+		node := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		if node == nil || len(node.Children) == 0 {
+			continue
+		}
+		feature, err := xgbdump.SplitFeature(node.Split)
+		if err != nil {
+			return 0, err
+		}
+		if feature > maxFeature {
+			maxFeature = feature
+		}
+		stack = append(stack, node.Children...)
+	}
+	return maxFeature, nil
+}
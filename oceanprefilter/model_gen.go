@@ -0,0 +1,518 @@
+// Code generated by xgbgen from xg_boost_dump.json. DO NOT EDIT.
+
+package oceanprefilter
+
+// embeddedModelDigest is the SHA-256 of the dump the model was compiled from
+const embeddedModelDigest = "6f0cd13c3265de36f1684895d37925b99562ebe9a154a98e15af5d4eddb5031e"
+
+// embeddedModelNumFeatures is the number of features the compiled model reads
+const embeddedModelNumFeatures = 798
+
+// embeddedModelScores adds up the scores of the trees of every class.
+// features must hold at least embeddedModelNumFeatures features.
+func embeddedModelScores(features []float32) (scores [2]float32) {
+	_ = features[797]
+	scores[0] += embeddedModelTree0(features)
+	scores[1] += embeddedModelTree1(features)
+	scores[0] += embeddedModelTree2(features)
+	scores[1] += embeddedModelTree3(features)
+	scores[0] += embeddedModelTree4(features)
+	scores[1] += embeddedModelTree5(features)
+	scores[0] += embeddedModelTree6(features)
+	scores[1] += embeddedModelTree7(features)
+	scores[0] += embeddedModelTree8(features)
+	scores[1] += embeddedModelTree9(features)
+	scores[0] += embeddedModelTree10(features)
+	scores[1] += embeddedModelTree11(features)
+	scores[0] += embeddedModelTree12(features)
+	scores[1] += embeddedModelTree13(features)
+	scores[0] += embeddedModelTree14(features)
+	scores[1] += embeddedModelTree15(features)
+	scores[0] += embeddedModelTree16(features)
+	scores[1] += embeddedModelTree17(features)
+	scores[0] += embeddedModelTree18(features)
+	scores[1] += embeddedModelTree19(features)
+	return scores
+}
+
+func embeddedModelTree0(f []float32) float32 {
+	if f[754] < 86.03333 {
+		if f[88] < 111.2 {
+			if f[4] < 117.36667 {
+				return 0.9870968
+			}
+			return -0.5
+		}
+		if f[0] < 84.96667 {
+			return -0.6
+		}
+		return -0
+	}
+	if f[468] < 115.1 {
+		if f[372] < 106.63333 {
+			if f[472] < 96.433334 {
+				return 0.23076923
+			}
+			return -0.8148148
+		}
+		if f[304] < 122.8 {
+			return 0.86206895
+		}
+		return -0.5555556
+	}
+	if f[516] < 106.1 {
+		if f[8] < 115.1 {
+			return -0.5
+		}
+		return 0.5
+	}
+	return -0.96153843
+}
+
+func embeddedModelTree1(f []float32) float32 {
+	if f[754] < 86.03333 {
+		if f[88] < 111.2 {
+			if f[4] < 117.36667 {
+				return -0.9870968
+			}
+			return 0.5
+		}
+		if f[0] < 84.96667 {
+			return 0.6
+		}
+		return -0
+	}
+	if f[468] < 115.1 {
+		if f[372] < 106.63333 {
+			if f[472] < 96.433334 {
+				return -0.23076923
+			}
+			return 0.8148148
+		}
+		if f[304] < 122.8 {
+			return -0.86206895
+		}
+		return 0.5555556
+	}
+	if f[516] < 106.1 {
+		if f[8] < 115.1 {
+			return 0.5
+		}
+		return -0.5
+	}
+	return 0.96153843
+}
+
+func embeddedModelTree2(f []float32) float32 {
+	if f[93] < 99.7 {
+		if f[14] < 112.96667 {
+			if f[96] < 101.833336 {
+				if f[40] < 109.71667 {
+					return 0.61104035
+				}
+				return 0.15201078
+			}
+			return 0.11584127
+		}
+		if f[34] < 112.76667 {
+			return -0.6309773
+		}
+		return 0.09938704
+	}
+	if f[683] < 117.6 {
+		if f[201] < 96.166664 {
+			if f[755] < 82.26667 {
+				return 0.03249746
+			}
+			return -0.7140578
+		}
+		if f[468] < 112.98333 {
+			return 0.2148396
+		}
+		return -0.5146037
+	}
+	return 0.8381691
+}
+
+func embeddedModelTree3(f []float32) float32 {
+	if f[93] < 99.7 {
+		if f[14] < 112.96667 {
+			if f[96] < 101.833336 {
+				if f[40] < 109.71667 {
+					return -0.6110404
+				}
+				return -0.15201089
+			}
+			return -0.11584137
+		}
+		if f[34] < 112.76667 {
+			return 0.6309772
+		}
+		return -0.099387094
+	}
+	if f[683] < 117.6 {
+		if f[201] < 96.166664 {
+			if f[755] < 82.26667 {
+				return -0.03249758
+			}
+			return 0.7140578
+		}
+		if f[468] < 112.98333 {
+			return -0.21483967
+		}
+		return 0.5146037
+	}
+	return -0.8381692
+}
+
+func embeddedModelTree4(f []float32) float32 {
+	if f[96] < 105.9 {
+		if f[20] < 114.86667 {
+			if f[693] < 98.03333 {
+				if f[24] < 45.233334 {
+					return 0.0703156
+				}
+				return 0.5483203
+			}
+			if f[116] < 97.53333 {
+				return 0.20343035
+			}
+			return -0.32286194
+		}
+		return -0.43184352
+	}
+	if f[100] < 114.03333 {
+		if f[676] < 106.7 {
+			if f[199] < 122.73333 {
+				return -0.5832057
+			}
+			return 0.014821828
+		}
+		if f[484] < 114.63333 {
+			return 0.41647816
+		}
+		return -0.3816251
+	}
+	if f[336] < 117.6 {
+		return 0.5964207
+	}
+	return -0.3508407
+}
+
+func embeddedModelTree5(f []float32) float32 {
+	if f[96] < 105.9 {
+		if f[20] < 114.86667 {
+			if f[693] < 98.03333 {
+				if f[24] < 45.233334 {
+					return -0.070315905
+				}
+				return -0.5483203
+			}
+			if f[116] < 97.53333 {
+				return -0.20343055
+			}
+			return 0.3228619
+		}
+		return 0.4318435
+	}
+	if f[100] < 114.03333 {
+		if f[676] < 106.7 {
+			if f[199] < 122.73333 {
+				return 0.5832057
+			}
+			return -0.014821857
+		}
+		if f[484] < 114.63333 {
+			return -0.4164782
+		}
+		return 0.38162494
+	}
+	if f[336] < 117.6 {
+		return -0.5964207
+	}
+	return 0.35084063
+}
+
+func embeddedModelTree6(f []float32) float32 {
+	if f[435] < 111.566666 {
+		if f[746] < 101.03333 {
+			if f[780] < 82.433334 {
+				if f[88] < 111.2 {
+					return 0.44476497
+				}
+				return -0.100074396
+			}
+			if f[446] < 100.63333 {
+				return -0.34526378
+			}
+			return 0.18389174
+		}
+		if f[468] < 110.85 {
+			return 0.5732288
+		}
+		return 0.098170884
+	}
+	if f[232] < 117.76667 {
+		return -0.09661888
+	}
+	return -0.44305745
+}
+
+func embeddedModelTree7(f []float32) float32 {
+	if f[435] < 111.566666 {
+		if f[746] < 101.03333 {
+			if f[780] < 82.433334 {
+				if f[88] < 111.2 {
+					return -0.44476494
+				}
+				return 0.100074396
+			}
+			if f[446] < 100.63333 {
+				return 0.3452639
+			}
+			return -0.18389165
+		}
+		if f[468] < 110.85 {
+			return -0.5732288
+		}
+		return -0.0981708
+	}
+	if f[232] < 117.76667 {
+		return 0.09661893
+	}
+	return 0.44305745
+}
+
+func embeddedModelTree8(f []float32) float32 {
+	if f[754] < 86.03333 {
+		if f[218] < 71.55 {
+			if f[88] < 97.1 {
+				return 0.2565208
+			}
+			return -0.29660258
+		}
+		return 0.48228437
+	}
+	if f[742] < 99.4 {
+		if f[92] < 99.7 {
+			if f[4] < 106.05 {
+				return 0.33242568
+			}
+			return -0.07617836
+		}
+		if f[728] < 99.066666 {
+			return -0.45597133
+		}
+		return -0.0911235
+	}
+	if f[336] < 116.666664 {
+		if f[723] < 97.23333 {
+			return -0.0619269
+		}
+		return 0.40361658
+	}
+	return -0.27607346
+}
+
+func embeddedModelTree9(f []float32) float32 {
+	if f[754] < 86.03333 {
+		if f[218] < 71.55 {
+			if f[88] < 97.1 {
+				return -0.2565208
+			}
+			return 0.29660255
+		}
+		return -0.4822844
+	}
+	if f[742] < 99.4 {
+		if f[92] < 99.7 {
+			if f[4] < 106.05 {
+				return -0.33242568
+			}
+			return 0.076178245
+		}
+		if f[728] < 99.066666 {
+			return 0.45597133
+		}
+		return 0.09112358
+	}
+	if f[336] < 116.666664 {
+		if f[723] < 97.23333 {
+			return 0.06192696
+		}
+		return -0.4036166
+	}
+	return 0.27607355
+}
+
+func embeddedModelTree10(f []float32) float32 {
+	if f[510] < 110.46667 {
+		if f[401] < 74.73333 {
+			if f[96] < 95.666664 {
+				return 0.06937611
+			}
+			return -0.28190705
+		}
+		if f[541] < 93.4 {
+			return 0.3916874
+		}
+		if f[146] < 103.9 {
+			return -0.30199757
+		}
+		return 0.21327546
+	}
+	if f[100] < 109.333336 {
+		return -0.3200798
+	}
+	return -0.06438178
+}
+
+func embeddedModelTree11(f []float32) float32 {
+	if f[510] < 110.46667 {
+		if f[401] < 74.73333 {
+			if f[96] < 95.666664 {
+				return -0.06937701
+			}
+			return 0.281907
+		}
+		if f[541] < 93.4 {
+			return -0.39168745
+		}
+		if f[146] < 103.9 {
+			return 0.30199772
+		}
+		return -0.21327531
+	}
+	if f[100] < 109.333336 {
+		return 0.32007986
+	}
+	return 0.06438164
+}
+
+func embeddedModelTree12(f []float32) float32 {
+	if f[14] < 111.76667 {
+		if f[97] < 105.4 {
+			if f[796] < 87.96667 {
+				return 0.31204656
+			}
+			return 0.06744111
+		}
+		if f[29] < 106.9 {
+			return -0.18831052
+		}
+		return 0.12711444
+	}
+	if f[37] < 119.8 {
+		return -0.32761428
+	}
+	return 0.094811566
+}
+
+func embeddedModelTree13(f []float32) float32 {
+	if f[14] < 111.76667 {
+		if f[97] < 105.4 {
+			if f[796] < 87.96667 {
+				return -0.31204653
+			}
+			return -0.06744117
+		}
+		if f[29] < 106.9 {
+			return 0.18831058
+		}
+		return -0.12711436
+	}
+	if f[37] < 119.8 {
+		return 0.32761416
+	}
+	return -0.094811745
+}
+
+func embeddedModelTree14(f []float32) float32 {
+	if f[498] < 111.36667 {
+		if f[498] < 104.76667 {
+			if f[783] < 93.9 {
+				if f[410] < 80.583336 {
+					return -0.10343804
+				}
+				return 0.22825268
+			}
+			return -0.21482517
+		}
+		return 0.26957634
+	}
+	return -0.21186046
+}
+
+func embeddedModelTree15(f []float32) float32 {
+	if f[498] < 111.36667 {
+		if f[498] < 104.76667 {
+			if f[783] < 93.9 {
+				if f[410] < 80.583336 {
+					return 0.10343689
+				}
+				return -0.22825246
+			}
+			return 0.21482535
+		}
+		return -0.2695763
+	}
+	return 0.2118605
+}
+
+func embeddedModelTree16(f []float32) float32 {
+	if f[526] < 109.96667 {
+		if f[56] < 105.03333 {
+			if f[696] < 84.36667 {
+				return 0.09173281
+			}
+			return -0.20286882
+		}
+		if f[608] < 101.5 {
+			return 0.26459515
+		}
+		return 0.033164408
+	}
+	return -0.16308853
+}
+
+func embeddedModelTree17(f []float32) float32 {
+	if f[526] < 109.96667 {
+		if f[56] < 105.03333 {
+			if f[696] < 84.36667 {
+				return -0.09173299
+			}
+			return 0.2028687
+		}
+		if f[608] < 101.5 {
+			return -0.26459512
+		}
+		return -0.03316428
+	}
+	return 0.16308875
+}
+
+func embeddedModelTree18(f []float32) float32 {
+	if f[90] < 120.2 {
+		if f[752] < 102.53333 {
+			if f[797] < 89.7 {
+				return 0.10074596
+			}
+			return -0.15511903
+		}
+		return 0.18903694
+	}
+	return -0.1437359
+}
+
+func embeddedModelTree19(f []float32) float32 {
+	if f[90] < 120.2 {
+		if f[752] < 102.53333 {
+			if f[797] < 89.7 {
+				return -0.10074497
+			}
+			return 0.1551189
+		}
+		return -0.18903714
+	}
+	return 0.14373598
+}
@@ -0,0 +1,121 @@
+package oceanprefilter
+
+import (
+	"image"
+	"math"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	// DefaultMotionThreshold is the mean difference from the background, as a fraction of full brightness,
+	// a patch needs to count as moving
+	DefaultMotionThreshold = 0.1
+	// motionLearningRate is how much of each new frame is blended into the background model
+	motionLearningRate = 0.05
+	// MotionModeTrigger makes motion trigger the prefilter on its own, on top of the XGBoost model
+	MotionModeTrigger = "trigger"
+	// MotionModeGate only lets the XGBoost model trigger on patches that are also moving
+	MotionModeGate  = "gate"
+	motionClassName = "MOTION"
+)
+
+// checkMotionMode returns the motion mode to use, defaulting to MotionModeTrigger
+func checkMotionMode(mode string) (string, error) {
+	switch mode {
+	case "":
+		return MotionModeTrigger, nil
+	case MotionModeTrigger, MotionModeGate:
+		return mode, nil
+	default:
+		return "", errors.Errorf("motion_mode must be %q or %q, got %q", MotionModeTrigger, MotionModeGate, mode)
+	}
+}
+
+// motionDetector keeps a running average of the water below the horizon as a background model of the scene,
+// and scores how much each patch of the water differs from that background. Only the pixels of the patches
+// that are scored are modelled, so the sky and clouds above the horizon never count as motion.
+type motionDetector struct {
+	mu           sync.Mutex
+	learningRate float32
+	bounds       image.Rectangle
+	background   []float32 // gray values between 0 and 1, one per pixel of bounds, NaN where there is no water
+}
+
+func newMotionDetector(learningRate float64) *motionDetector {
+	return &motionDetector{learningRate: float32(learningRate)}
+}
+
+// score returns the mean absolute difference between the frame and the background within each box,
+// as a fraction of full brightness, over the pixels the background has seen as water. The boxes of the frame
+// are then blended into the background. The first frame, or a frame of a different size, scores 0 everywhere.
+func (md *motionDetector) score(img image.Image, boxes []image.Rectangle) []float64 {
+	md.mu.Lock()
+	defer md.mu.Unlock()
+	gray := toGray(img)
+	bounds := gray.Bounds()
+	scores := make([]float64, len(boxes))
+	if md.background == nil || bounds != md.bounds {
+		md.bounds = bounds
+		md.background = make([]float32, bounds.Dx()*bounds.Dy())
+		for k := range md.background {
+			md.background[k] = float32(math.NaN())
+		}
+	}
+	for i, box := range boxes {
+		box = box.Intersect(bounds)
+		if box.Empty() {
+			continue
+		}
+		sum, seen := 0.0, 0
+		for y := box.Min.Y; y < box.Max.Y; y++ {
+			row := gray.Pix[gray.PixOffset(box.Min.X, y):]
+			bg := md.background[(y-bounds.Min.Y)*bounds.Dx()+(box.Min.X-bounds.Min.X):]
+			for x := 0; x < box.Dx(); x++ {
+				if math.IsNaN(float64(bg[x])) {
+					continue
+				}
+				sum += math.Abs(float64(float32(row[x])/255 - bg[x]))
+				seen++
+			}
+		}
+		if seen > 0 {
+			scores[i] = sum / float64(seen)
+		}
+	}
+	md.blend(gray, boxes)
+	return scores
+}
+
+// blend mixes the pixels of the boxes into the background, starting from the frame where the background
+// has none yet, and forgets the background outside of the boxes, where there is no water in this frame
+func (md *motionDetector) blend(gray *image.Gray, boxes []image.Rectangle) {
+	w := md.bounds.Dx()
+	water := make([]bool, len(md.background))
+	for _, box := range boxes {
+		box = box.Intersect(md.bounds)
+		for y := box.Min.Y; y < box.Max.Y; y++ {
+			row := gray.Pix[gray.PixOffset(box.Min.X, y):]
+			offset := (y-md.bounds.Min.Y)*w + (box.Min.X - md.bounds.Min.X)
+			for x := 0; x < box.Dx(); x++ {
+				k := offset + x
+				if water[k] {
+					continue
+				}
+				water[k] = true
+				v := float32(row[x]) / 255
+				if math.IsNaN(float64(md.background[k])) {
+					md.background[k] = v
+				} else {
+					md.background[k] += md.learningRate * (v - md.background[k])
+				}
+			}
+		}
+	}
+	for k, isWater := range water {
+		if !isWater {
+			md.background[k] = float32(math.NaN())
+		}
+	}
+}
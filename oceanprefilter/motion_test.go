@@ -0,0 +1,117 @@
+package oceanprefilter
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+	"os"
+	"testing"
+
+	"go.viam.com/test"
+)
+
+func TestMotionDetector(t *testing.T) {
+	md := newMotionDetector(motionLearningRate)
+	boxes := []image.Rectangle{image.Rect(0, 100, 200, 180), image.Rect(200, 100, 400, 180)}
+
+	// the first frame only sets up the background
+	frame := image.NewGray(image.Rect(0, 0, 640, 480))
+	scores := md.score(frame, boxes)
+	test.That(t, scores, test.ShouldResemble, []float64{0, 0})
+
+	// a bright object shows up in the second box only
+	moved := image.NewGray(frame.Bounds())
+	for y := 120; y < 160; y++ {
+		for x := 250; x < 350; x++ {
+			moved.Pix[moved.PixOffset(x, y)] = 255
+		}
+	}
+	scores = md.score(moved, boxes)
+	test.That(t, scores[0], test.ShouldEqual, 0)
+	test.That(t, scores[1], test.ShouldAlmostEqual, 0.25, 1e-6) // a quarter of the box turned white
+
+	// the object slowly becomes part of the background
+	scores = md.score(moved, boxes)
+	test.That(t, scores[1], test.ShouldBeLessThan, 0.25)
+	test.That(t, scores[1], test.ShouldBeGreaterThan, 0.2)
+
+	// a new resolution starts the background over
+	scores = md.score(image.NewGray(image.Rect(0, 0, 320, 240)), boxes)
+	test.That(t, scores, test.ShouldResemble, []float64{0, 0})
+
+	// clouds moving in the sky above the water don't count, and the sky isn't part of the background
+	// if the horizon later moves up and it becomes water
+	sky := image.NewGray(frame.Bounds())
+	for y := 0; y < 100; y++ {
+		for x := 0; x < 640; x++ {
+			sky.Pix[sky.PixOffset(x, y)] = 255
+		}
+	}
+	md = newMotionDetector(motionLearningRate)
+	md.score(frame, boxes)
+	scores = md.score(sky, boxes)
+	test.That(t, scores, test.ShouldResemble, []float64{0, 0})
+	skyBoxes := []image.Rectangle{image.Rect(0, 20, 200, 100), image.Rect(200, 100, 400, 180)}
+	scores = md.score(sky, skyBoxes)
+	test.That(t, scores, test.ShouldResemble, []float64{0, 0})
+	// once seen, the new water is part of the background
+	scores = md.score(frame, skyBoxes)
+	test.That(t, scores[0], test.ShouldAlmostEqual, 1.0, 1e-6)
+
+	_, err := checkMotionMode("sometimes")
+	test.That(t, err, test.ShouldNotBeNil)
+	mode, err := checkMotionMode("")
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, mode, test.ShouldEqual, MotionModeTrigger)
+}
+
+func TestMotionInference(t *testing.T) {
+	f, err := os.Open("test_data/2288.jpg")
+	test.That(t, err, test.ShouldBeNil)
+	defer f.Close()
+	img, _, err := image.Decode(f)
+	test.That(t, err, test.ShouldBeNil)
+	ensemble, err := loadModel("", numFeatures(defaultPatchSize, defaultPoolWindow))
+	test.That(t, err, test.ShouldBeNil)
+	rect := image.Rectangle{
+		Min: image.Point{X: 250, Y: 350},
+		Max: image.Point{X: 580, Y: 480},
+	}
+
+	// the same frame twice never moves, so the motion gate stops the model from triggering
+	rc := RunConfig{
+		Model:           ensemble,
+		Threshold:       0.25,
+		Mask:            NewRegionMask([]Region{RectRegion(rect)}, nil, 0),
+		motionTrigger:   true,
+		motionMode:      MotionModeGate,
+		motionThreshold: DefaultMotionThreshold,
+		motion:          newMotionDetector(motionLearningRate),
+	}
+	for i := 0; i < 2; i++ {
+		res, err := MakeInference(img, rc)
+		test.That(t, err, test.ShouldBeNil)
+		test.That(t, res.Triggered, test.ShouldBeFalse)
+	}
+
+	// as a trigger source, a bright object in the water triggers even if the model doesn't
+	rc.motionMode = MotionModeTrigger
+	rc.Threshold = 1.0
+	rc.motion = newMotionDetector(motionLearningRate)
+	res, err := MakeInference(img, rc)
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, res.Triggered, test.ShouldBeFalse)
+	withObject := image.NewRGBA(img.Bounds())
+	draw.Draw(withObject, withObject.Bounds(), img, img.Bounds().Min, draw.Src)
+	object := image.Rect(20, 400, 180, 470)
+	draw.Draw(withObject, object, image.NewUniform(color.White), image.Point{}, draw.Src)
+	res, err = MakeInference(withObject, rc)
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, res.Triggered, test.ShouldBeTrue)
+	test.That(t, res.Detections, test.ShouldNotBeEmpty)
+	for _, d := range res.Detections {
+		test.That(t, d.Label(), test.ShouldEqual, motionClassName)
+		test.That(t, d.BoundingBox().Overlaps(object), test.ShouldBeTrue)
+		test.That(t, d.BoundingBox().Overlaps(rect), test.ShouldBeFalse)
+	}
+}
@@ -0,0 +1,234 @@
+package oceanprefilter
+
+import (
+	"bytes"
+	"encoding/json"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// nativeModel is the part of a model saved by XGBoost's save_model, as JSON or UBJSON, that scoring needs
+type nativeModel struct {
+	Learner struct {
+		GradientBooster struct {
+			Name  string `json:"name"`
+			Model struct {
+				Param struct {
+					NumTrees string `json:"num_trees"`
+				} `json:"gbtree_model_param"`
+				Trees    []nativeTree `json:"trees"`
+				TreeInfo []int        `json:"tree_info"`
+			} `json:"model"`
+		} `json:"gradient_booster"`
+		Param struct {
+			BaseScore  string `json:"base_score"`
+			NumClass   string `json:"num_class"`
+			NumFeature string `json:"num_feature"`
+		} `json:"learner_model_param"`
+		Objective struct {
+			Name string `json:"name"`
+		} `json:"objective"`
+	} `json:"learner"`
+}
+
+// nativeTree is a tree of a saved model, stored as one array per property of the nodes. Node 0 is the root,
+// a leaf has no children and keeps its value in split_conditions.
+type nativeTree struct {
+	Param struct {
+		SizeLeafVector string `json:"size_leaf_vector"`
+	} `json:"tree_param"`
+	LeftChildren    []int32      `json:"left_children"`
+	RightChildren   []int32      `json:"right_children"`
+	SplitIndices    []int32      `json:"split_indices"`
+	SplitConditions []float32    `json:"split_conditions"`
+	SplitType       []int        `json:"split_type"`
+	DefaultLeft     []nativeBool `json:"default_left"`
+}
+
+// nativeBool is a flag XGBoost saves as either a boolean or a 0 or 1
+type nativeBool bool
+
+func (b *nativeBool) UnmarshalJSON(data []byte) error {
+	switch string(data) {
+	case "true", "1":
+		*b = true
+	case "false", "0":
+		*b = false
+	default:
+		return errors.Errorf("%s is not a flag", data)
+	}
+	return nil
+}
+
+// isNativeModel reports whether the data is a model saved by save_model rather than a JSON dump, which is an array
+func isNativeModel(data []byte) bool {
+	return bytes.HasPrefix(bytes.TrimLeft(data, " \t\r\n"), []byte("{"))
+}
+
+// loadNativeModel loads a model saved by XGBoost's save_model as JSON or UBJSON. The number of classes and trees,
+// the objective and the base score all come from the model. Models trained with multi:softprob or multi:softmax
+// need two classes, and binary:logistic models score the "interesting" class with the sigmoid of their margin.
+func loadNativeModel(data []byte, nFeatures int) (*XGBoostModel, error) {
+	if !json.Valid(data) {
+		var err error
+		if data, err = decodeUBJSON(data); err != nil {
+			return nil, err
+		}
+	}
+	var saved nativeModel
+	if err := json.Unmarshal(data, &saved); err != nil {
+		return nil, errors.Wrap(err, "model is not a valid XGBoost model")
+	}
+	learner := saved.Learner
+	booster := learner.GradientBooster
+	if booster.Name != "gbtree" {
+		return nil, errors.Errorf("model uses the %q booster, only gbtree models are supported", booster.Name)
+	}
+	trees := booster.Model.Trees
+	if len(trees) == 0 {
+		return nil, errors.New("model does not contain any trees")
+	}
+	if numTrees, err := strconv.Atoi(booster.Model.Param.NumTrees); err != nil || numTrees != len(trees) {
+		return nil, errors.Errorf("model says it has %q trees, but holds %v", booster.Model.Param.NumTrees, len(trees))
+	}
+	if len(booster.Model.TreeInfo) != len(trees) {
+		return nil, errors.Errorf("model has %v trees, but the class of %v of them", len(trees), len(booster.Model.TreeInfo))
+	}
+	// the features are read by their place in the patch, so a model trained on any other number reads the wrong ones
+	numFeature, err := strconv.Atoi(learner.Param.NumFeature)
+	if err != nil {
+		return nil, errors.Errorf("model says it was trained on %q features, which is not a number", learner.Param.NumFeature)
+	}
+	if numFeature != nFeatures {
+		return nil, errors.Errorf("model was trained on %v features, but each patch has %v features. "+
+			"Check that patch_width, patch_height and pool_window match the ones the model was trained with",
+			numFeature, nFeatures)
+	}
+	baseScores, err := parseBaseScore(learner.Param.BaseScore)
+	if err != nil {
+		return nil, err
+	}
+
+	m := &XGBoostModel{
+		numClasses:      modelNumClasses,
+		numFeatures:     nFeatures,
+		trainedFeatures: numFeature,
+		base:            make([]float32, modelNumClasses),
+	}
+	objective := learner.Objective.Name
+	switch objective {
+	case "multi:softprob", "multi:softmax":
+		numClass, err := strconv.Atoi(learner.Param.NumClass)
+		if err != nil || numClass != modelNumClasses {
+			return nil, errors.Errorf("model has %q classes, the prefilter expects %v", learner.Param.NumClass, modelNumClasses)
+		}
+		// the base score is the margin every class starts at
+		for c := range m.base {
+			m.base[c] = baseScores[0]
+			if len(baseScores) == modelNumClasses {
+				m.base[c] = baseScores[c]
+			}
+		}
+	case "binary:logistic":
+		// the softmax of a boring score of 0 and an interesting score of the margin is the sigmoid of the margin
+		if len(baseScores) != 1 || baseScores[0] <= 0 || baseScores[0] >= 1 {
+			return nil, errors.Errorf("base score %q of the model is not a probability", learner.Param.BaseScore)
+		}
+		p := float64(baseScores[0])
+		m.base[interestingClass] = float32(math.Log(p / (1 - p)))
+	default:
+		return nil, errors.Errorf("model was trained with the %q objective, the prefilter supports "+
+			"multi:softprob and multi:softmax with two classes, and binary:logistic", objective)
+	}
+
+	for i, tree := range trees {
+		class := booster.Model.TreeInfo[i]
+		if objective == "binary:logistic" {
+			if class != 0 {
+				return nil, errors.Errorf("tree %v of model is for class %v of a binary model", i, class)
+			}
+			class = interestingClass
+		}
+		if class < 0 || class >= modelNumClasses {
+			return nil, errors.Errorf("tree %v of model is for class %v, the prefilter expects %v classes", i, class, modelNumClasses)
+		}
+		if err := m.addNativeTree(tree, nFeatures); err != nil {
+			return nil, errors.Wrapf(err, "error in tree %v of model", i)
+		}
+		m.classes = append(m.classes, int32(class))
+	}
+	return m, nil
+}
+
+// parseBaseScore reads the base score of a model, which newer versions of XGBoost save as a list with one per class
+func parseBaseScore(s string) ([]float32, error) {
+	var scores []float32
+	for _, field := range strings.Split(strings.Trim(s, "[] "), ",") {
+		v, err := strconv.ParseFloat(strings.TrimSpace(field), 32)
+		if err != nil {
+			return nil, errors.Errorf("base score %q of the model is not a number", s)
+		}
+		scores = append(scores, float32(v))
+	}
+	return scores, nil
+}
+
+// addNativeTree appends the nodes of one tree of a saved model after the nodes of the trees before it
+func (m *XGBoostModel) addNativeTree(tree nativeTree, nFeatures int) error {
+	if tree.Param.SizeLeafVector != "" && tree.Param.SizeLeafVector != "0" && tree.Param.SizeLeafVector != "1" {
+		return errors.New("tree has vector leaves, only trees with one value per leaf are supported")
+	}
+	n := len(tree.LeftChildren)
+	if n == 0 || len(tree.RightChildren) != n || len(tree.SplitIndices) != n || len(tree.SplitConditions) != n ||
+		len(tree.DefaultLeft) != n || (tree.SplitType != nil && len(tree.SplitType) != n) {
+		return errors.New("tree doesn't have every property for every node")
+	}
+	base := int32(len(m.nodes))
+	nodes := make([]treeNode, n)
+	// walk down from the root, so every node is reached once, and nodes that are never reached are left alone
+	seen := make([]bool, n)
+	seen[0] = true
+	stack := []int32{0}
+	for len(stack) > 0 {
+		id := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		left, right := tree.LeftChildren[id], tree.RightChildren[id]
+		if left == -1 {
+			nodes[id] = treeNode{feature: -1, leaf: tree.SplitConditions[id]}
+			continue
+		}
+		for _, child := range []int32{left, right} {
+			if child < 0 || int(child) >= n || seen[child] {
+				return errors.Errorf("node %v doesn't point at children of its own", id)
+			}
+			seen[child] = true
+		}
+		if tree.SplitType != nil && tree.SplitType[id] != 0 {
+			return errors.Errorf("node %v is a categorical split, only numerical splits are supported", id)
+		}
+		feature := tree.SplitIndices[id]
+		if feature < 0 || int(feature) >= nFeatures {
+			return errors.Errorf("node %v splits on feature f%v, but each patch only has %v features. "+
+				"Check that patch_width, patch_height and pool_window match the ones the model was trained with",
+				id, feature, nFeatures)
+		}
+		missing := right
+		if tree.DefaultLeft[id] {
+			missing = left
+		}
+		nodes[id] = treeNode{
+			feature:   feature,
+			threshold: tree.SplitConditions[id],
+			yes:       base + left,
+			no:        base + right,
+			missing:   base + missing,
+		}
+		stack = append(stack, left, right)
+	}
+	m.roots = append(m.roots, base)
+	m.nodes = append(m.nodes, nodes...)
+	return nil
+}
@@ -0,0 +1,363 @@
+package oceanprefilter
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+
+	"github.com/viamrobotics/ocean-prefilter/internal/xgbdump"
+	"go.viam.com/test"
+)
+
+// nativeFromDump turns a JSON dump into the model save_model writes as JSON, with the given base score
+func nativeFromDump(tb testing.TB, dump []byte, baseScore string) map[string]interface{} {
+	tb.Helper()
+	var dumped []*xgbdump.Node
+	test.That(tb, json.Unmarshal(dump, &dumped), test.ShouldBeNil)
+	trees := []interface{}{}
+	treeInfo := []int32{}
+	for k, root := range dumped {
+		byID := map[int]*xgbdump.Node{}
+		stack := []*xgbdump.Node{root}
+		for len(stack) > 0 {
+			node := stack[len(stack)-1]
+			stack = stack[:len(stack)-1]
+			byID[node.NodeID] = node
+			stack = append(stack, node.Children...)
+		}
+		n := len(byID)
+		left, right, parents, indices := make([]int32, n), make([]int32, n), make([]int32, n), make([]int32, n)
+		conditions, weights := make([]float32, n), make([]float32, n)
+		defaultLeft, splitType := make(byteFlags, n), make(byteFlags, n)
+		parents[0] = math.MaxInt32
+		for id, node := range byID {
+			if len(node.Children) == 0 {
+				left[id], right[id], conditions[id], weights[id] = -1, -1, node.Leaf, node.Leaf
+				continue
+			}
+			feature, err := xgbdump.SplitFeature(node.Split)
+			test.That(tb, err, test.ShouldBeNil)
+			left[id], right[id], indices[id], conditions[id] = int32(node.Yes), int32(node.No), int32(feature), node.SplitCondition
+			parents[node.Yes], parents[node.No] = int32(id), int32(id)
+			if node.Missing == node.Yes {
+				defaultLeft[id] = 1
+			}
+		}
+		trees = append(trees, map[string]interface{}{
+			"base_weights": weights, "categories": []int32{}, "categories_nodes": []int32{},
+			"categories_segments": []int64{}, "categories_sizes": []int64{}, "default_left": defaultLeft, "id": k,
+			"left_children": left, "loss_changes": make([]float32, n), "parents": parents, "right_children": right,
+			"split_conditions": conditions, "split_indices": indices, "split_type": splitType, "sum_hessian": make([]float32, n),
+			"tree_param": map[string]interface{}{
+				"num_deleted": "0", "num_feature": "800", "num_nodes": fmt.Sprint(n), "size_leaf_vector": "1",
+			},
+		})
+		treeInfo = append(treeInfo, int32(k%modelNumClasses))
+	}
+	return map[string]interface{}{
+		"learner": map[string]interface{}{
+			"attributes": map[string]interface{}{}, "feature_names": []string{}, "feature_types": []string{},
+			"gradient_booster": map[string]interface{}{
+				"model": map[string]interface{}{
+					"gbtree_model_param": map[string]interface{}{"num_parallel_tree": "1", "num_trees": fmt.Sprint(len(trees))},
+					"iteration_indptr":   []int32{0, 2, 4, 6, 8},
+					"tree_info":          treeInfo,
+					"trees":              trees,
+				},
+				"name": "gbtree",
+			},
+			"learner_model_param": map[string]interface{}{
+				"base_score": baseScore, "boost_from_average": "1", "num_class": "2", "num_feature": "800", "num_target": "1",
+			},
+			"objective": map[string]interface{}{
+				"name": "multi:softprob", "softmax_multiclass_param": map[string]interface{}{"num_class": "2"},
+			},
+		},
+		"version": []int32{2, 0, 3},
+	}
+}
+
+// byteFlags are saved as numbers, as XGBoost does, rather than the base64 encoding/json gives a []uint8
+type byteFlags []uint8
+
+func (f byteFlags) MarshalJSON() ([]byte, error) {
+	values := make([]int, len(f))
+	for i, v := range f {
+		values[i] = int(v)
+	}
+	return json.Marshal(values)
+}
+
+// encodeUBJSON writes the value as UBJSON the way XGBoost does, with typed arrays of numbers
+func encodeUBJSON(buf *bytes.Buffer, v interface{}) {
+	writeLength := func(n int) {
+		buf.WriteByte('L')
+		_ = binary.Write(buf, binary.BigEndian, int64(n))
+	}
+	switch v := v.(type) {
+	case map[string]interface{}:
+		buf.WriteByte('{')
+		keys := make([]string, 0, len(v))
+		for key := range v {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			writeLength(len(key))
+			buf.WriteString(key)
+			encodeUBJSON(buf, v[key])
+		}
+		buf.WriteByte('}')
+	case []interface{}:
+		buf.WriteByte('[')
+		for _, e := range v {
+			encodeUBJSON(buf, e)
+		}
+		buf.WriteByte(']')
+	case []string:
+		buf.WriteString("[#")
+		writeLength(len(v))
+		for _, e := range v {
+			encodeUBJSON(buf, e)
+		}
+	case string:
+		buf.WriteByte('S')
+		writeLength(len(v))
+		buf.WriteString(v)
+	case int:
+		buf.WriteByte('l')
+		_ = binary.Write(buf, binary.BigEndian, int32(v))
+	case []float32, []int32, []int64, byteFlags:
+		typ := map[string]byte{"[]float32": 'd', "[]int32": 'l', "[]int64": 'L', "oceanprefilter.byteFlags": 'U'}[fmt.Sprintf("%T", v)]
+		buf.WriteString("[$")
+		buf.WriteByte(typ)
+		buf.WriteByte('#')
+		writeLength(numbersLen(v))
+		_ = binary.Write(buf, binary.BigEndian, v)
+	default:
+		panic(fmt.Sprintf("can't encode %T", v))
+	}
+}
+
+// numbersLen is the length of a slice of numbers
+func numbersLen(v interface{}) int {
+	switch v := v.(type) {
+	case []float32:
+		return len(v)
+	case []int32:
+		return len(v)
+	case []int64:
+		return len(v)
+	case byteFlags:
+		return len(v)
+	}
+	return 0
+}
+
+func TestNativeModel(t *testing.T) {
+	dumped, err := loadModelFromBytes(modelbytes, numFeatures(defaultPatchSize, defaultPoolWindow))
+	test.That(t, err, test.ShouldBeNil)
+	// the dump model without the compiled code, to compare the trees with the trees
+	interpreted := *dumped
+	interpreted.compiled = nil
+	frame := loadFrame(t, 1280, 720)
+	_, imgs, err := RunConfig{}.patches(frame)
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, len(imgs), test.ShouldBeGreaterThan, 0)
+
+	load := func(v interface{}, ubjson bool) (*XGBoostModel, error) {
+		if ubjson {
+			var buf bytes.Buffer
+			encodeUBJSON(&buf, v)
+			return LoadXGBoostModel(buf.Bytes())
+		}
+		data, err := json.Marshal(v)
+		test.That(t, err, test.ShouldBeNil)
+		return LoadXGBoostModel(data)
+	}
+	for _, ubjson := range []bool{false, true} {
+		// with a base score of 0 the trees add up to exactly the scores of the dump
+		zero, err := load(nativeFromDump(t, modelbytes, "0E0"), ubjson)
+		test.That(t, err, test.ShouldBeNil)
+		test.That(t, zero.compiled, test.ShouldBeNil)
+		test.That(t, zero.NumClasses(), test.ShouldEqual, modelNumClasses)
+		// and a base score the same for both classes cancels out in the softmax, up to rounding
+		half, err := load(nativeFromDump(t, modelbytes, "5E-1"), ubjson)
+		test.That(t, err, test.ShouldBeNil)
+		test.That(t, half.base, test.ShouldResemble, []float32{0.5, 0.5})
+		for _, p := range imgs {
+			features := pooled(p.img, defaultPoolWindow)
+			want, err := interestingProbability(&interpreted, features)
+			test.That(t, err, test.ShouldBeNil)
+			got, err := interestingProbability(zero, features)
+			test.That(t, err, test.ShouldBeNil)
+			test.That(t, got, test.ShouldEqual, want)
+			got, err = interestingProbability(half, features)
+			test.That(t, err, test.ShouldBeNil)
+			test.That(t, got, test.ShouldAlmostEqual, want, 1e-6)
+		}
+	}
+
+	// a binary:logistic model as save_model writes it, with one tree that splits on f0 and sends missing values left
+	logistic := func(baseScore string) string {
+		return `{"learner":{"attributes":{},"feature_names":[],"feature_types":[],
+			"gradient_booster":{"model":{"gbtree_model_param":{"num_parallel_tree":"1","num_trees":"1"},
+			"iteration_indptr":[0,1],"tree_info":[0],"trees":[{"base_weights":[0,-1,1],"categories":[],
+			"categories_nodes":[],"categories_segments":[],"categories_sizes":[],"default_left":[1,0,0],"id":0,
+			"left_children":[1,-1,-1],"loss_changes":[1,0,0],"parents":[2147483647,0,0],"right_children":[2,-1,-1],
+			"split_conditions":[5E-1,-1E0,1E0],"split_indices":[0,0,0],"split_type":[0,0,0],"sum_hessian":[2,1,1],
+			"tree_param":{"num_deleted":"0","num_feature":"800","num_nodes":"3","size_leaf_vector":"1"}}]},
+			"name":"gbtree"},"learner_model_param":{"base_score":"` + baseScore + `","boost_from_average":"1",
+			"num_class":"0","num_feature":"800","num_target":"1"},
+			"objective":{"name":"binary:logistic","reg_loss_param":{"scale_pos_weight":"1"}}},"version":[2,0,3]}`
+	}
+	sigmoid := func(x float64) float64 { return 1 / (1 + math.Exp(-x)) }
+	model, err := LoadXGBoostModel([]byte(logistic("5E-1")))
+	test.That(t, err, test.ShouldBeNil)
+	features := model.newFeatures()
+	for _, tc := range []struct {
+		f0   float32
+		want float64
+	}{{0, sigmoid(-1)}, {1, sigmoid(1)}, {float32(math.NaN()), sigmoid(-1)}} {
+		features[0] = tc.f0
+		got, err := interestingProbability(model, features)
+		test.That(t, err, test.ShouldBeNil)
+		test.That(t, got, test.ShouldAlmostEqual, tc.want, 1e-6)
+	}
+	// newer versions save the base score as a list, and it is a probability for a logistic model
+	model, err = LoadXGBoostModel([]byte(logistic("[2.5E-1]")))
+	test.That(t, err, test.ShouldBeNil)
+	features[0] = 1
+	got, err := interestingProbability(model, features)
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, got, test.ShouldAlmostEqual, sigmoid(math.Log(0.25/0.75)+1), 1e-6)
+	_, err = LoadXGBoostModel([]byte(logistic("1E0")))
+	test.That(t, err.Error(), test.ShouldContainSubstring, "not a probability")
+
+	// models the prefilter can't use
+	broken := func(change func(m map[string]interface{})) error {
+		m := nativeFromDump(t, modelbytes, "5E-1")
+		change(m)
+		_, err := load(m, false)
+		test.That(t, err, test.ShouldNotBeNil)
+		return err
+	}
+	learner := func(m map[string]interface{}) map[string]interface{} { return m["learner"].(map[string]interface{}) }
+	gbtree := func(m map[string]interface{}) map[string]interface{} {
+		return learner(m)["gradient_booster"].(map[string]interface{})["model"].(map[string]interface{})
+	}
+	firstTree := func(m map[string]interface{}) map[string]interface{} {
+		return gbtree(m)["trees"].([]interface{})[0].(map[string]interface{})
+	}
+	err = broken(func(m map[string]interface{}) {
+		learner(m)["objective"] = map[string]interface{}{"name": "reg:squarederror"}
+	})
+	test.That(t, err.Error(), test.ShouldContainSubstring, "reg:squarederror")
+	err = broken(func(m map[string]interface{}) {
+		learner(m)["learner_model_param"].(map[string]interface{})["num_class"] = "3"
+	})
+	test.That(t, err.Error(), test.ShouldContainSubstring, "expects 2")
+	err = broken(func(m map[string]interface{}) {
+		learner(m)["gradient_booster"].(map[string]interface{})["name"] = "dart"
+	})
+	test.That(t, err.Error(), test.ShouldContainSubstring, "only gbtree")
+	err = broken(func(m map[string]interface{}) {
+		learner(m)["learner_model_param"].(map[string]interface{})["num_feature"] = "900"
+	})
+	test.That(t, err.Error(), test.ShouldContainSubstring, "trained on 900 features")
+	// fewer features than a patch has is the wrong layout too
+	err = broken(func(m map[string]interface{}) {
+		learner(m)["learner_model_param"].(map[string]interface{})["num_feature"] = "799"
+	})
+	test.That(t, err.Error(), test.ShouldContainSubstring, "trained on 799 features, but each patch has 800")
+	err = broken(func(m map[string]interface{}) {
+		delete(learner(m)["learner_model_param"].(map[string]interface{}), "num_feature")
+	})
+	test.That(t, err.Error(), test.ShouldContainSubstring, "not a number")
+	err = broken(func(m map[string]interface{}) { gbtree(m)["tree_info"] = []int32{0, 1, 0} })
+	test.That(t, err.Error(), test.ShouldContainSubstring, "the class of 3")
+	err = broken(func(m map[string]interface{}) { firstTree(m)["split_type"].(byteFlags)[0] = 1 })
+	test.That(t, err.Error(), test.ShouldContainSubstring, "categorical")
+	err = broken(func(m map[string]interface{}) { firstTree(m)["split_indices"].([]int32)[0] = 900 })
+	test.That(t, err.Error(), test.ShouldContainSubstring, "splits on feature f900")
+	err = broken(func(m map[string]interface{}) { firstTree(m)["right_children"].([]int32)[0] = 0 })
+	test.That(t, err.Error(), test.ShouldContainSubstring, "children of its own")
+	err = broken(func(m map[string]interface{}) { firstTree(m)["default_left"] = byteFlags{1} })
+	test.That(t, err.Error(), test.ShouldContainSubstring, "every property")
+
+	var buf bytes.Buffer
+	encodeUBJSON(&buf, nativeFromDump(t, modelbytes, "5E-1"))
+	_, err = LoadXGBoostModel(buf.Bytes()[:buf.Len()/2])
+	test.That(t, err.Error(), test.ShouldContainSubstring, "not valid UBJSON")
+}
+
+// savedPredictions are the rows XGBoost scored a saved model on, and the "interesting" probability it gave them
+type savedPredictions struct {
+	Features    [][]*float32 `json:"features"`
+	Interesting []float64    `json:"interesting"`
+}
+
+func TestSavedModels(t *testing.T) {
+	// the models were saved by XGBoost itself, with test_data/make_saved_models.py. They aren't committed,
+	// so the test only runs where they were written, which is always the case in CI
+	for _, name := range []string{"softprob", "logistic"} {
+		t.Run(name, func(t *testing.T) {
+			data, err := os.ReadFile(filepath.Join("test_data", "saved_"+name+"_predictions.json"))
+			if errors.Is(err, fs.ErrNotExist) {
+				// CI writes them before it runs this test, so there they must be found
+				if os.Getenv("REQUIRE_SAVED_MODELS") != "" {
+					t.Fatal("REQUIRE_SAVED_MODELS is set, but test_data/make_saved_models.py wrote no saved models")
+				}
+				t.Skip("the saved models are only written in CI, run test_data/make_saved_models.py with xgboost installed to write them")
+			}
+			test.That(t, err, test.ShouldBeNil)
+			var want savedPredictions
+			test.That(t, json.Unmarshal(data, &want), test.ShouldBeNil)
+			test.That(t, want.Features, test.ShouldHaveLength, len(want.Interesting))
+			rows := make([][]float32, len(want.Features))
+			for i, row := range want.Features {
+				rows[i] = make([]float32, len(row))
+				for k, v := range row {
+					rows[i][k] = float32(math.NaN())
+					if v != nil {
+						rows[i][k] = *v
+					}
+				}
+			}
+			probabilities := func(file string) []float64 {
+				data, err := os.ReadFile(filepath.Join("test_data", file))
+				test.That(t, err, test.ShouldBeNil)
+				model, err := LoadXGBoostModel(data)
+				test.That(t, err, test.ShouldBeNil)
+				probs := make([]float64, len(rows))
+				for i, row := range rows {
+					probs[i], err = model.Probability(row, interestingClass)
+					test.That(t, err, test.ShouldBeNil)
+				}
+				return probs
+			}
+
+			// both formats score the rows like XGBoost does
+			for _, ext := range []string{".json", ".ubj"} {
+				for i, prob := range probabilities("saved_" + name + ext) {
+					test.That(t, prob, test.ShouldAlmostEqual, want.Interesting[i], 1e-5)
+				}
+			}
+			// and like the dump of the same booster, for the objective a dump can hold
+			if name != "softprob" {
+				return
+			}
+			for i, prob := range probabilities("saved_" + name + "_dump.json") {
+				test.That(t, prob, test.ShouldAlmostEqual, want.Interesting[i], 1e-5)
+			}
+		})
+	}
+}
@@ -5,15 +5,16 @@ import (
 	"context"
 	_ "embed"
 	"image"
+	"math"
+	"runtime"
+	"slices"
 	"sync"
 	"sync/atomic"
 	"time"
 
-	xgb "github.com/Elvenson/xgboost-go"
-	"github.com/Elvenson/xgboost-go/activation"
-	"github.com/Elvenson/xgboost-go/inference"
 	"github.com/pkg/errors"
 	"go.viam.com/rdk/components/camera"
+	"go.viam.com/rdk/components/movementsensor"
 	"go.viam.com/rdk/logging"
 	"go.viam.com/rdk/resource"
 	"go.viam.com/rdk/services/vision"
@@ -31,7 +32,9 @@ const (
 	DefaultMaxFrequency = 10.0
 	DefaultThreshold    = 0.25
 	triggerClassName    = "TRIGGER"
-	triggerCountdown    = 4
+	triggerCountdown    = 4 // the trigger is held for the time of this many frames at max_frequency_hz if trigger_hold_seconds is not set
+	// streamRetryDelay is how long a camera stream waits before it starts again after the camera failed
+	streamRetryDelay = time.Second
 )
 
 var (
@@ -51,23 +54,97 @@ func init() {
 
 // Config contains names for necessary resources (camera and vision service)
 type Config struct {
-	CameraName      string             `json:"camera_name"`
-	DetectorName    string             `json:"detector_name"`
-	ChosenLabels    map[string]float64 `json:"chosen_labels"`
-	MaxFrequency    float64            `json:"max_frequency_hz"`
-	Threshold       float64            `json:"threshold"`
-	Debug           bool               `json:"debug"`
-	ExcludedRegion  []int              `json:"excluded_region"`
-	TriggerOnMotion bool               `json:"trigger_on_motion"`
+	CameraName             string                         `json:"camera_name"`
+	CameraNames            []string                       `json:"camera_names"`
+	CameraRegions          map[string]CameraRegionsConfig `json:"camera_regions"`
+	DetectorName           string                         `json:"detector_name"`
+	ChosenLabels           map[string]float64             `json:"chosen_labels"`
+	DetectOnPatches        bool                           `json:"detect_on_patches"`
+	MaxFrequency           float64                        `json:"max_frequency_hz"`
+	Threshold              float64                        `json:"threshold"`
+	Debug                  bool                           `json:"debug"`
+	ExcludedRegion         []int                          `json:"excluded_region"`
+	ExcludedRegions        []RegionConfig                 `json:"excluded_regions"`
+	IncludedRegions        []RegionConfig                 `json:"included_regions"`
+	MaxExcludedOverlap     float64                        `json:"max_excluded_overlap"`
+	TriggerOnMotion        bool                           `json:"trigger_on_motion"`
+	MotionMode             string                         `json:"motion_mode"`
+	MotionThreshold        float64                        `json:"motion_threshold"`
+	ModelPath              string                         `json:"model_path"`
+	PatchHeight            int                            `json:"patch_height"`
+	PatchWidth             int                            `json:"patch_width"`
+	PoolWindow             []int                          `json:"pool_window"`
+	MovementSensorName     string                         `json:"movement_sensor_name"`
+	SensorHorizonMode      string                         `json:"sensor_horizon_mode"`
+	SensorHorizonTolerance float64                        `json:"sensor_horizon_tolerance"`
+	CameraVerticalFOV      float64                        `json:"camera_vertical_fov_degrees"`
+	CameraPitchOffset      float64                        `json:"camera_pitch_offset_degrees"`
+	CameraRollOffset       float64                        `json:"camera_roll_offset_degrees"`
+	HorizonHoldSeconds     float64                        `json:"horizon_hold_seconds"`
+	HorizonMaxJump         float64                        `json:"horizon_max_jump"`
+	HorizonSmoothing       float64                        `json:"horizon_smoothing"`
+	HorizonStrategy        string                         `json:"horizon_strategy"`
+	TriggerHoldSeconds     float64                        `json:"trigger_hold_seconds"`
+	TriggerQuietSeconds    float64                        `json:"trigger_quiet_seconds"`
+	TriggerConfirmFrames   int                            `json:"trigger_confirm_frames"`
+	TriggerConfirmWindow   int                            `json:"trigger_confirm_window"`
+	FixedHorizon           *FixedHorizonConfig            `json:"fixed_horizon"`
+	InferenceWorkers       int                            `json:"inference_workers"`
+	StopAtFirstTrigger     bool                           `json:"stop_at_first_trigger"`
 }
 
 // Validate validates the config and returns implicit dependencies,
-// this Validate checks if the camera and detector(optional) exist for the module's vision model.
+// this Validate checks if the cameras, detector(optional) and movement sensor(optional) exist for the module's vision model.
 func (cfg *Config) Validate(path string) ([]string, error) {
-	if cfg.CameraName == "" {
+	for label, conf := range cfg.ChosenLabels {
+		if conf < 0 || conf > 1 {
+			return nil, errors.Errorf("confidence for chosen label %q must be a number between 0 and 1, got %v", label, conf)
+		}
+	}
+	if _, err := cfg.horizonStrategy(); err != nil {
+		return nil, err
+	}
+	if cfg.MovementSensorName != "" {
+		if cfg.HorizonStrategy != "" && cfg.HorizonStrategy != HorizonOtsuEdges {
+			return nil, errors.Errorf("movement_sensor_name can only be used with horizon_strategy %q", HorizonOtsuEdges)
+		}
+		if _, err := checkSensorHorizonMode(cfg.SensorHorizonMode); err != nil {
+			return nil, err
+		}
+		if cfg.CameraVerticalFOV <= 0 || cfg.CameraVerticalFOV >= 180 {
+			return nil, errors.New("camera_vertical_fov_degrees must be between 0 and 180 to predict the horizon from movement_sensor_name")
+		}
+		if cfg.SensorHorizonTolerance < 0 || cfg.SensorHorizonTolerance > 1 {
+			return nil, errors.New("sensor_horizon_tolerance must be a number between 0 and 1")
+		}
+	}
+	cameraNames, err := cfg.cameraNames()
+	if err != nil {
+		return nil, err
+	}
+	for name := range cfg.CameraRegions {
+		if !slices.Contains(cameraNames, name) {
+			return nil, errors.Errorf("camera_regions has regions for %q, which is not a configured camera", name)
+		}
+		if _, err := cfg.cameraMask(name, nil); err != nil {
+			return nil, err
+		}
+	}
+	if cfg.MovementSensorName != "" && len(cameraNames) > 1 {
+		return nil, errors.New("movement_sensor_name can only be used with a single camera, as each camera sees the horizon at a different angle")
+	}
+	deps := []string{}
+	deps = append(deps, cameraNames...)
+	if cfg.DetectorName != "" {
+		deps = append(deps, cfg.DetectorName)
+	}
+	if cfg.MovementSensorName != "" {
+		deps = append(deps, cfg.MovementSensorName)
+	}
+	if len(deps) == 0 {
 		return nil, nil
 	}
-	return []string{cfg.CameraName}, nil
+	return deps, nil
 }
 
 // prefilter is the main struct for this module. It is a vision service classifier that will return a "TRIGGER" class
@@ -78,137 +155,357 @@ type prefilter struct {
 	cancelFunc              context.CancelFunc
 	cancelContext           context.Context
 	activeBackgroundWorkers sync.WaitGroup
-	triggerFlag             *atomic.Bool // will be a shared variable
-	currImg                 atomic.Pointer[image.Image]
-	camName                 string
+	workers                 atomic.Pointer[cameraWorkers] // background stream of each camera
 	properties              vision.Properties
-	rc                      RunConfig
+	rcMu                    sync.Mutex                // serializes changes to rc and the workers
+	rc                      atomic.Pointer[RunConfig] // current settings for images that are passed in
 }
 
 // RunConfig are the settings that will be fed to the background thread that will constantly be evaluating images for events
 type RunConfig struct {
-	logger        logging.Logger
-	cam           camera.Camera
-	camName       string
-	chosenLabels  map[string]float64
-	frequency     float64
-	minConfidence float64
-	Threshold     float64
-	ExcludedZone  *image.Rectangle
-	motionTrigger bool
-	debug         bool
-	Model         *inference.Ensemble
+	logger          logging.Logger
+	cam             camera.Camera
+	camName         string
+	detector        vision.Service
+	detectorName    string
+	detectOnPatches bool
+	chosenLabels    map[string]float64
+	frequency       float64
+	minConfidence   float64
+	Threshold       float64
+	Mask            *RegionMask     // areas of the image to ignore, nil to look at everything
+	PatchSize       image.Point     // width and height of the patches, 200x80 if not set
+	PoolWindow      image.Point     // width and height of the average pooling window, 10x2 if not set
+	HorizonStrategy HorizonStrategy // how the horizon is found, OtsuEdgesHorizon if not set
+	motionTrigger   bool
+	motionMode      string
+	motionThreshold float64
+	motion          *motionDetector
+	debug           bool
+	Model           *XGBoostModel
+	horizonSensor   *horizonSensor
+	// predictedHorizon is where the movement sensor puts the horizon in the current frame, if there is one
+	predictedHorizon *Horizon
+	horizonHold      time.Duration
+	horizonMaxJump   float64
+	horizonSmoothing float64
+	// horizonTracker follows the horizon across the frames of the background stream, nil for single images
+	horizonTracker *horizonTracker
+	triggerHold    time.Duration // 0 holds the trigger for the time of triggerCountdown frames at the max frequency
+	triggerQuiet   time.Duration
+	confirmFrames  int
+	confirmWindow  int
+
+	// Workers is how many goroutines score the patches of a frame, one at a time if not set
+	Workers int
+	// StopAtFirstTrigger stops scoring a frame at the first patch that triggers
+	StopAtFirstTrigger bool
+}
+
+func (rc RunConfig) patchSize() image.Point {
+	if rc.PatchSize == (image.Point{}) {
+		return defaultPatchSize
+	}
+	return rc.PatchSize
+}
+
+func (rc RunConfig) poolWindow() image.Point {
+	if rc.PoolWindow == (image.Point{}) {
+		return defaultPoolWindow
+	}
+	return rc.PoolWindow
 }
 
 // newPrefilter creates the vision service classifier
 func newPrefilter(ctx context.Context, deps resource.Dependencies, conf resource.Config, logger logging.Logger) (vision.Service, error) {
-	var triggerFlag atomic.Bool
 	pf := &prefilter{
-		Named:       conf.ResourceName().AsNamed(),
-		logger:      logger,
-		triggerFlag: &triggerFlag,
+		Named:  conf.ResourceName().AsNamed(),
+		logger: logger,
 		properties: vision.Properties{
 			ClassificationSupported: true,
-			DetectionSupported:      false,
+			DetectionSupported:      true,
 			ObjectPCDsSupported:     false,
 		},
 	}
-	pf.triggerFlag.Store(false)
-
 	if err := pf.Reconfigure(ctx, deps, conf); err != nil {
 		return nil, err
 	}
 	return pf, nil
 }
 
-// Reconfigure reconfigures prefilter with new settings from the config. It stops the old stream and starts a new one.
-func (pf *prefilter) Reconfigure(ctx context.Context, deps resource.Dependencies, conf resource.Config) error {
-	// first check if there is a stream controled by the context already running that needs to be closed
-	if pf.cancelFunc != nil {
-		pf.cancelFunc()
-		pf.activeBackgroundWorkers.Wait()
-	}
-	pf.triggerFlag.Store(false)
-	cancelableCtx, cancel := context.WithCancel(context.Background())
-	pf.cancelFunc = cancel
-	pf.cancelContext = cancelableCtx
-	// This takes the generic resource.Config passed down from the parent and converts it to the
-	// model-specific (aka "native") Config structure defined, above making it easier to directly access attributes.
-	prefilterConfig, err := resource.NativeConfig[*Config](conf)
-	if err != nil {
-		return errors.Errorf("Could not assert proper config for %s", ModelName)
-	}
+// NewRunConfig returns the settings the service uses for the images passed in to it, from its attributes.
+// The detector, movement sensor and cameras of the config are not used, as they are only found in a running robot.
+func NewRunConfig(cfg *Config, logger logging.Logger) (RunConfig, error) {
+	return cfg.runConfig(logger)
+}
 
-	// the run config will store the relevant variables from the prefilterConfig for running
+// ForStills returns the settings for scoring unrelated still images, such as a dataset, rather than the frames
+// of one camera. Motion detection and horizon tracking are turned off, as they compare a frame to the ones before it,
+// and so is the movement sensor, as its orientation is that of the camera mount now, not of the still.
+func (rc RunConfig) ForStills() RunConfig {
+	rc.motionTrigger = false
+	rc.motion = nil
+	rc.horizonTracker = nil
+	rc.horizonSensor = nil
+	rc.predictedHorizon = nil
+	return rc
+}
+
+// runConfig checks the attributes and turns them into the settings that don't need any dependencies
+func (cfg *Config) runConfig(logger logging.Logger) (RunConfig, error) {
+	var err error
+	// the run config will store the relevant variables from the config for running
 	rc := RunConfig{}
-	rc.logger = pf.logger
-	rc.debug = prefilterConfig.Debug
+	rc.logger = logger
+	rc.debug = cfg.Debug
 	// now load the relevant info into the RunConfig
-	if prefilterConfig.MaxFrequency < 0 {
-		return errors.New("max_frequency_hz must be a non-negative number")
+	if cfg.MaxFrequency < 0 {
+		return RunConfig{}, errors.New("max_frequency_hz must be a non-negative number")
 	}
-	rc.frequency = prefilterConfig.MaxFrequency
+	rc.frequency = cfg.MaxFrequency
 	if rc.frequency == 0 {
 		rc.frequency = DefaultMaxFrequency
 	}
-	if prefilterConfig.Threshold > 1.0 || prefilterConfig.Threshold < 0 {
-		return errors.New("threshold must be a number between 0 and 1")
+	if cfg.Threshold > 1.0 || cfg.Threshold < 0 {
+		return RunConfig{}, errors.New("threshold must be a number between 0 and 1")
 	}
-	rc.Threshold = prefilterConfig.Threshold
+	rc.Threshold = cfg.Threshold
 	if rc.Threshold == 0 {
 		rc.Threshold = DefaultThreshold
 	}
 
-	rc.motionTrigger = prefilterConfig.TriggerOnMotion
-	rc.chosenLabels = prefilterConfig.ChosenLabels // if you configred an optional detector, this determines the labels and confidences to use
-	if len(prefilterConfig.ExcludedRegion) != 0 {
-		if len(prefilterConfig.ExcludedRegion) != 4 {
-			return errors.Errorf("excluded_region must have four numbers that represent upper left and lower right corner of the excluded region in pixels. Instead got a list of %v elements", len(prefilterConfig.ExcludedRegion))
+	rc.motionTrigger = cfg.TriggerOnMotion
+	if rc.motionTrigger {
+		rc.motionMode, err = checkMotionMode(cfg.MotionMode)
+		if err != nil {
+			return RunConfig{}, err
 		}
-		er := prefilterConfig.ExcludedRegion
-		theZone := image.Rectangle{image.Point{er[0], er[1]}, image.Point{er[2], er[3]}}
-		rc.ExcludedZone = &theZone
+		if cfg.MotionThreshold > 1.0 || cfg.MotionThreshold < 0 {
+			return RunConfig{}, errors.New("motion_threshold must be a number between 0 and 1")
+		}
+		rc.motionThreshold = cfg.MotionThreshold
+		if rc.motionThreshold == 0 {
+			rc.motionThreshold = DefaultMotionThreshold
+		}
+		// the background model is built up frame by frame, and starts over on every reconfigure
+		rc.motion = newMotionDetector(motionLearningRate)
 	}
-	ensemble, err := xgb.LoadXGBoostFromJSONBytes(modelbytes,
-		"", 2, 8, &activation.Softmax{})
+	rc.chosenLabels = cfg.ChosenLabels // if you configred an optional detector, this determines the labels and confidences to use
+	rc.Mask, err = cfg.regionMask()
 	if err != nil {
-		return errors.Wrapf(err, "unable to properly load XGBoost model")
+		return RunConfig{}, err
+	}
+	rc.PatchSize = defaultPatchSize
+	if cfg.PatchWidth != 0 {
+		rc.PatchSize.X = cfg.PatchWidth
+	}
+	if cfg.PatchHeight != 0 {
+		rc.PatchSize.Y = cfg.PatchHeight
+	}
+	rc.PoolWindow = defaultPoolWindow
+	if len(cfg.PoolWindow) != 0 {
+		if len(cfg.PoolWindow) != 2 {
+			return RunConfig{}, errors.Errorf("pool_window must have two numbers, the width and height of the window. Instead got a list of %v elements", len(cfg.PoolWindow))
+		}
+		rc.PoolWindow = image.Point{cfg.PoolWindow[0], cfg.PoolWindow[1]}
+	}
+	if err := checkPatchGeometry(rc.PatchSize, rc.PoolWindow); err != nil {
+		return RunConfig{}, err
+	}
+	// use the model on disk if one is given, otherwise fall back to the embedded model
+	ensemble, err := loadModel(cfg.ModelPath, numFeatures(rc.PatchSize, rc.PoolWindow))
+	if err != nil {
+		return RunConfig{}, err
+	}
+	// a dump doesn't say what it was trained on, so it can only be checked against the features it splits on
+	if ensemble.trainedFeatures == 0 && numFeatures(rc.PatchSize, rc.PoolWindow) != numFeatures(defaultPatchSize, defaultPoolWindow) {
+		logger.Warnf("patches have %v features instead of the default %v, make sure the model was trained on "+
+			"patch_width, patch_height and pool_window of %vx%v and %vx%v", numFeatures(rc.PatchSize, rc.PoolWindow),
+			numFeatures(defaultPatchSize, defaultPoolWindow), rc.PatchSize.X, rc.PatchSize.Y, rc.PoolWindow.X, rc.PoolWindow.Y)
 	}
 	rc.Model = ensemble
+	rc.detectorName = cfg.DetectorName
+	rc.detectOnPatches = cfg.DetectOnPatches
 
-	if prefilterConfig.CameraName != "" {
-		rc.camName = prefilterConfig.CameraName
-		pf.camName = prefilterConfig.CameraName
-		rc.cam, err = camera.FromDependencies(deps, prefilterConfig.CameraName)
-		if err != nil {
-			return errors.Wrapf(err, "unable to get camera %v for ocean prefilter", prefilterConfig.CameraName)
-		}
+	rc.HorizonStrategy, err = cfg.horizonStrategy()
+	if err != nil {
+		return RunConfig{}, err
+	}
+	if cfg.HorizonHoldSeconds < 0 {
+		return RunConfig{}, errors.New("horizon_hold_seconds must be a non-negative number")
+	}
+	rc.horizonHold = time.Duration(cfg.HorizonHoldSeconds * float64(time.Second))
+	if rc.horizonHold == 0 {
+		rc.horizonHold = DefaultHorizonHold
+	}
+	if cfg.HorizonMaxJump < 0 || cfg.HorizonMaxJump > 1 {
+		return RunConfig{}, errors.New("horizon_max_jump must be a number between 0 and 1")
+	}
+	rc.horizonMaxJump = cfg.HorizonMaxJump
+	if rc.horizonMaxJump == 0 {
+		rc.horizonMaxJump = DefaultHorizonMaxJump
+	}
+	if cfg.HorizonSmoothing < 0 || cfg.HorizonSmoothing > 1 {
+		return RunConfig{}, errors.New("horizon_smoothing must be a number between 0 and 1")
+	}
+	rc.horizonSmoothing = cfg.HorizonSmoothing
+	if rc.horizonSmoothing == 0 {
+		rc.horizonSmoothing = DefaultHorizonSmoothing
+	}
+
+	if cfg.TriggerHoldSeconds < 0 || cfg.TriggerQuietSeconds < 0 {
+		return RunConfig{}, errors.New("trigger_hold_seconds and trigger_quiet_seconds must be non-negative numbers")
+	}
+	rc.triggerHold = time.Duration(cfg.TriggerHoldSeconds * float64(time.Second))
+	rc.triggerQuiet = time.Duration(cfg.TriggerQuietSeconds * float64(time.Second))
+	rc.confirmFrames, rc.confirmWindow, err = checkTriggerConfirmation(cfg.TriggerConfirmFrames, cfg.TriggerConfirmWindow)
+	if err != nil {
+		return RunConfig{}, err
+	}
+
+	if cfg.InferenceWorkers < 0 {
+		return RunConfig{}, errors.New("inference_workers must be a non-negative number")
+	}
+	rc.Workers = cfg.InferenceWorkers
+	if rc.Workers == 0 {
+		rc.Workers = runtime.NumCPU()
+	}
+	rc.StopAtFirstTrigger = cfg.StopAtFirstTrigger
+
+	return rc, nil
+}
+
+// Reconfigure reconfigures prefilter with new settings from the config. It stops the old stream and starts a new one.
+// If the config or its dependencies are wrong, the old streams keep running.
+func (pf *prefilter) Reconfigure(ctx context.Context, deps resource.Dependencies, conf resource.Config) error {
+	rc, workers, err := newCameraWorkers(deps, conf, pf.logger)
+	if err != nil {
+		return err
+	}
+	// then check if there is a stream controled by the context already running that needs to be closed
+	if pf.cancelFunc != nil {
+		pf.cancelFunc()
+		pf.activeBackgroundWorkers.Wait()
+	}
+	cancelableCtx, cancel := context.WithCancel(context.Background())
+	pf.cancelFunc = cancel
+	pf.cancelContext = cancelableCtx
+	// images given to Detections and Classifications aren't frames of one stream, so they are scored
+	// without the motion detector and horizon tracker, which only the cameras get
+	stills := rc.ForStills()
+	// a DoCommand in between would only change the settings being replaced
+	pf.rcMu.Lock()
+	pf.rc.Store(&stills)
+	pf.setWorkers(workers)
+	pf.rcMu.Unlock()
 
-		// now start the background thread only if a camera dependency is given
+	// now start a background thread for every camera that is given
+	for _, w := range workers {
+		w := w
 		pf.activeBackgroundWorkers.Add(1)
 		viamutils.ManagedGo(func() {
 			// if you get an error while running just keep trying forever
 			for {
-				runErr := run(pf.cancelContext, rc, pf.triggerFlag, &pf.currImg)
-				if runErr != nil {
-					pf.logger.Errorw("background camera stream exited with error", "error", runErr)
-					continue // keep trying to run, forever
+				runErr := run(pf.cancelContext, w)
+				if runErr == nil {
+					return
+				}
+				pf.logger.Errorw("background camera stream exited with error", "camera", w.name, "error", runErr)
+				// keep trying to run, forever, but don't spin on a camera that keeps failing
+				select {
+				case <-pf.cancelContext.Done():
+					return
+				case <-time.After(streamRetryDelay):
 				}
-				return
 			}
 		}, func() {
 			pf.activeBackgroundWorkers.Done()
 		})
-	} else {
-		pf.rc = rc
 	}
 	return nil
 }
 
-// run sets up a camera stream and then takes new pictures and processes them for anomalies
-// at the desired frequency.
-func run(ctx context.Context, rc RunConfig, trigger *atomic.Bool, currImg *atomic.Pointer[image.Image]) error {
-	triggerCount := 0
+// newCameraWorkers checks the config, gets its dependencies and makes the settings of the service and
+// the workers of its cameras, without starting them
+func newCameraWorkers(deps resource.Dependencies, conf resource.Config, logger logging.Logger) (RunConfig, []*cameraWorker, error) {
+	// This takes the generic resource.Config passed down from the parent and converts it to the
+	// model-specific (aka "native") Config structure defined, above making it easier to directly access attributes.
+	prefilterConfig, err := resource.NativeConfig[*Config](conf)
+	if err != nil {
+		return RunConfig{}, nil, errors.Errorf("Could not assert proper config for %s", ModelName)
+	}
+
+	rc, err := prefilterConfig.runConfig(logger)
+	if err != nil {
+		return RunConfig{}, nil, err
+	}
+	if prefilterConfig.DetectorName != "" {
+		rc.detector, err = vision.FromDependencies(deps, prefilterConfig.DetectorName)
+		if err != nil {
+			return RunConfig{}, nil, errors.Wrapf(err, "unable to get detector %v for ocean prefilter", prefilterConfig.DetectorName)
+		}
+	}
+
+	if prefilterConfig.MovementSensorName != "" {
+		sensor, err := movementsensor.FromDependencies(deps, prefilterConfig.MovementSensorName)
+		if err != nil {
+			return RunConfig{}, nil, errors.Wrapf(err, "unable to get movement sensor %v for ocean prefilter", prefilterConfig.MovementSensorName)
+		}
+		mode, err := checkSensorHorizonMode(prefilterConfig.SensorHorizonMode)
+		if err != nil {
+			return RunConfig{}, nil, err
+		}
+		tolerance := prefilterConfig.SensorHorizonTolerance
+		if tolerance == 0 {
+			tolerance = DefaultSensorHorizonTolerance
+		}
+		rc.horizonSensor = &horizonSensor{
+			sensor:      sensor,
+			name:        prefilterConfig.MovementSensorName,
+			mode:        mode,
+			verticalFOV: prefilterConfig.CameraVerticalFOV * math.Pi / 180,
+			pitchOffset: prefilterConfig.CameraPitchOffset * math.Pi / 180,
+			rollOffset:  prefilterConfig.CameraRollOffset * math.Pi / 180,
+			tolerance:   tolerance,
+		}
+	}
+
+	cameraNames, err := prefilterConfig.cameraNames()
+	if err != nil {
+		return RunConfig{}, nil, err
+	}
+	workers := make([]*cameraWorker, 0, len(cameraNames))
+	for _, name := range cameraNames {
+		// every camera gets its own copy of the settings, with its own regions and background model
+		camRC := rc
+		camRC.camName = name
+		camRC.cam, err = camera.FromDependencies(deps, name)
+		if err != nil {
+			return RunConfig{}, nil, errors.Wrapf(err, "unable to get camera %v for ocean prefilter", name)
+		}
+		camRC.Mask, err = prefilterConfig.cameraMask(name, rc.Mask)
+		if err != nil {
+			return RunConfig{}, nil, err
+		}
+		if rc.motion != nil {
+			camRC.motion = newMotionDetector(motionLearningRate)
+		}
+		w := newCameraWorker(name)
+		_, w.ownRegions = prefilterConfig.CameraRegions[name]
+		w.rc.Store(&camRC)
+		workers = append(workers, w)
+	}
+	return rc, workers, nil
+}
+
+// run sets up the stream of the worker's camera and then takes new pictures and processes them for anomalies
+// at the desired frequency. The settings are read again for every frame, so they can be changed while running.
+func run(ctx context.Context, w *cameraWorker) error {
+	rcPtr, trigger, currImg := &w.rc, &w.triggerFlag, &w.currImg
+	// the regions are checked against the frame size whenever either of them changes
+	var checkedMask *RegionMask
+	var checkedBounds image.Rectangle
+	rc := *rcPtr.Load()
 	if rc.cam == nil {
 		return errors.Errorf("underlying camera %q is nil, cannot start background stream", rc.camName)
 	}
@@ -217,32 +514,29 @@ func run(ctx context.Context, rc RunConfig, trigger *atomic.Bool, currImg *atomi
 		return err
 	}
 	defer stream.Close(ctx)
+	tracker, state := w.streamState(rc)
 	for {
 		select {
 		case <-ctx.Done():
 			return nil
 		default:
+			rc = *rcPtr.Load()
+			rc.horizonTracker = tracker
 			start := time.Now()
 			img, release, err := stream.Next(ctx)
 			if err != nil {
 				trigger.Store(false)
 				return err
 			}
+			streamNextTook := time.Since(start)
 			currImg.Store(&img)
-			// this function is where the decision happens
-			isTriggered, err := MakeInference(img, rc)
-			if err != nil {
-				return errors.Errorf("inference error: %q", err)
-			}
-			if isTriggered {
-				triggerCount = triggerCountdown
-				trigger.Store(true)
-			} else if triggerCount > 0 {
-				trigger.Store(true)
-				triggerCount--
-			} else {
-				trigger.Store(false)
+			if rc.Mask != checkedMask || img.Bounds() != checkedBounds {
+				checkedMask, checkedBounds = rc.Mask, img.Bounds()
+				if err := rc.Mask.checkBounds(checkedBounds); err != nil {
+					rc.logger.Warnw("some regions are not fully inside the camera image", "error", err)
+				}
 			}
+			w.processFrame(ctx, img, rc, state, streamNextTook)
 			release()
 			if rc.debug && trigger.Load() {
 				rc.logger.Info("TRIGGER is true")
@@ -261,16 +555,60 @@ func run(ctx context.Context, rc RunConfig, trigger *atomic.Bool, currImg *atomi
 	}
 }
 
+// processFrame scores a frame of the camera's stream, and updates its trigger and stats with the result.
+// A frame that can't be scored, such as one without a visible horizon, counts as a frame that didn't trigger,
+// so the stream goes on with the next frame.
+func (w *cameraWorker) processFrame(ctx context.Context, img image.Image, rc RunConfig, state *triggerState, streamNextTook time.Duration) {
+	// this function is where the decision happens
+	inferenceStart := time.Now()
+	result, err := infer(ctx, img, rc)
+	inferenceTook := time.Since(inferenceStart)
+	if err != nil {
+		rc.logger.Debugw("unable to score frame, it counts as not triggered", "camera", w.name, "error", err)
+		raised := state.update(time.Now(), false)
+		w.stats.addFailedFrame(streamNextTook, inferenceTook, raised)
+		w.triggerFlag.Store(raised)
+		return
+	}
+	raised := state.update(time.Now(), result.Triggered)
+	w.stats.addFrame(streamNextTook, inferenceTook, result.Triggered, raised)
+	if raised && result.Triggered {
+		w.lastTrigger.Store(&result)
+	}
+	w.triggerFlag.Store(raised)
+}
+
 func (pf *prefilter) DetectionsFromCamera(
 	ctx context.Context,
 	cameraName string,
 	extra map[string]interface{},
 ) ([]objdet.Detection, error) {
-	return nil, errUnimplemented
+	w, err := pf.worker(cameraName)
+	if err != nil {
+		return nil, err
+	}
+	select {
+	case <-ctx.Done():
+		return nil, errors.Wrap(ctx.Err(), "module might be configuring")
+	case <-pf.cancelContext.Done():
+		return nil, errors.Wrap(pf.cancelContext.Err(), "lost connection with background camera stream loop")
+	default:
+		return w.triggerDetections(), nil
+	}
 }
 
 func (pf *prefilter) Detections(ctx context.Context, img image.Image, extra map[string]interface{}) ([]objdet.Detection, error) {
-	return nil, errUnimplemented
+	rc := pf.rc.Load()
+	if rc == nil {
+		return nil, errors.New("prefilter is not configured yet")
+	}
+	result, err := infer(ctx, img, *rc)
+	if err != nil {
+		pf.logger.Infow("detection error", "error", err.Error())
+	}
+	dets := []objdet.Detection{}
+	dets = append(dets, result.Detections...)
+	return dets, nil
 }
 
 func (pf *prefilter) ClassificationsFromCamera(
@@ -279,8 +617,9 @@ func (pf *prefilter) ClassificationsFromCamera(
 	n int,
 	extra map[string]interface{},
 ) (classification.Classifications, error) {
-	if cameraName != pf.camName {
-		return nil, errors.Errorf("camera name given to method, %v is not the same as configured camera %v", cameraName, pf.camName)
+	w, err := pf.worker(cameraName)
+	if err != nil {
+		return nil, err
 	}
 	select {
 	case <-ctx.Done():
@@ -288,28 +627,22 @@ func (pf *prefilter) ClassificationsFromCamera(
 	case <-pf.cancelContext.Done():
 		return nil, errors.Wrap(pf.cancelContext.Err(), "lost connection with background camera stream loop")
 	default:
-		cls := []classification.Classification{}
-		if pf.triggerFlag.Load() {
-			c := classification.NewClassification(1.0, triggerClassName)
-			cls = append(cls, c)
-		}
-		return classification.Classifications(cls), nil
+		return w.triggerClassifications(), nil
 	}
 }
 
 func (pf *prefilter) Classifications(ctx context.Context, img image.Image,
 	n int, extra map[string]interface{},
 ) (classification.Classifications, error) {
-	isTriggered, err := MakeInference(img, pf.rc)
+	rc := pf.rc.Load()
+	if rc == nil {
+		return nil, errors.New("prefilter is not configured yet")
+	}
+	result, err := infer(ctx, img, *rc)
 	if err != nil {
 		pf.logger.Infow("classification error", "error", err.Error())
 	}
-	cls := []classification.Classification{}
-	if isTriggered {
-		c := classification.NewClassification(1.0, triggerClassName)
-		cls = append(cls, c)
-	}
-	return classification.Classifications(cls), nil
+	return result.classifications(), nil
 }
 
 func (pf *prefilter) GetObjectPointClouds(
@@ -330,7 +663,8 @@ func (pf *prefilter) CaptureAllFromCamera(
 	opt viscapture.CaptureOptions,
 	extra map[string]interface{},
 ) (viscapture.VisCapture, error) {
-	cls := []classification.Classification{}
+	var cls classification.Classifications
+	var dets []objdet.Detection
 	var img image.Image
 	select {
 	case <-pf.cancelContext.Done():
@@ -338,21 +672,27 @@ func (pf *prefilter) CaptureAllFromCamera(
 	case <-ctx.Done():
 		return viscapture.VisCapture{}, ctx.Err()
 	default:
+		cw := pf.cameras()
+		w, ok := cw.byName[cameraName]
+		if !ok {
+			if len(cw.names) > 1 {
+				return viscapture.VisCapture{}, errors.Errorf("Camera name %q given to CaptureAllFromCamera is not one of the configured cameras %q", cameraName, cw.names)
+			}
+			return viscapture.VisCapture{}, errors.Errorf("Camera name %q given to CaptureAllFromCamera is not the same as configured camera %q", cameraName, cw.onlyCamera())
+		}
 		if opt.ReturnImage {
-			if cameraName != pf.camName {
-				return viscapture.VisCapture{}, errors.Errorf("Camera name %q given to CaptureAllFromCamera is not the same as configured camera %q", cameraName, pf.camName)
+			if storedImg := w.currImg.Load(); storedImg != nil {
+				img = *storedImg
 			}
-			storedImg := pf.currImg.Load()
-			img = *storedImg
 		}
 		if opt.ReturnClassifications {
-			if pf.triggerFlag.Load() {
-				c := classification.NewClassification(1.0, triggerClassName)
-				cls = append(cls, c)
-			}
+			cls = w.triggerClassifications()
+		}
+		if opt.ReturnDetections {
+			dets = w.triggerDetections()
 		}
 	}
-	return viscapture.VisCapture{Image: img, Classifications: classification.Classifications(cls)}, nil
+	return viscapture.VisCapture{Image: img, Detections: dets, Classifications: cls}, nil
 }
 
 func (pf *prefilter) Close(ctx context.Context) error {
@@ -361,7 +701,26 @@ func (pf *prefilter) Close(ctx context.Context) error {
 	return nil
 }
 
-// DoCommand will return the slowest, fastest, and average time of the tracking module
+// DoCommand will return the slowest, fastest, and average time of the tracking module with "get_stats",
+// and can change the threshold and excluded region without restarting the camera streams.
+// Stats and excluded regions can be limited to one camera with a "camera_name" field.
+// The verb is given as the "command" field, e.g. {"command": "set_threshold", "threshold": 0.3}
 func (pf *prefilter) DoCommand(ctx context.Context, cmd map[string]interface{}) (map[string]interface{}, error) {
-	return nil, nil
+	verb, ok := cmd["command"].(string)
+	if !ok {
+		return nil, errors.Errorf("DoCommand needs a \"command\" field, one of %q, %q, %q or %q",
+			cmdGetStats, cmdResetStats, cmdSetThreshold, cmdSetExcludedRegion)
+	}
+	switch verb {
+	case cmdGetStats:
+		return pf.getStats(cmd)
+	case cmdResetStats:
+		return pf.resetStats(cmd)
+	case cmdSetThreshold:
+		return pf.setThreshold(cmd)
+	case cmdSetExcludedRegion:
+		return pf.setExcludedRegion(cmd)
+	default:
+		return nil, errors.Errorf("unknown command %q", verb)
+	}
 }
@@ -6,15 +6,17 @@ import (
 	"image/color"
 	"sync/atomic"
 	"testing"
+	"time"
 	"unsafe"
     "os"
+	"go.viam.com/rdk/components/camera"
+	"go.viam.com/rdk/logging"
+	"go.viam.com/rdk/resource"
 	"go.viam.com/rdk/services/vision"
 	"go.viam.com/rdk/vision/classification"
+	objdet "go.viam.com/rdk/vision/objectdetection"
 	"go.viam.com/rdk/vision/viscapture"
 	"go.viam.com/test"
-
-    xgb "github.com/Elvenson/xgboost-go"
-	"github.com/Elvenson/xgboost-go/activation"
 )
 
 // MockImage creates a mock RGBA image for testing purposes.
@@ -30,6 +32,17 @@ func MockImage(width, height int) *image.RGBA {
 	return img
 }
 
+// newTestPrefilter returns a prefilter for the given cameras, without starting their streams
+func newTestPrefilter(cameraNames ...string) *prefilter {
+	pf := &prefilter{cancelContext: context.Background()}
+	workers := make([]*cameraWorker, 0, len(cameraNames))
+	for _, name := range cameraNames {
+		workers = append(workers, newCameraWorker(name))
+	}
+	pf.setWorkers(workers)
+	return pf
+}
+
 func TestConfigValidate(t *testing.T) {
 	// Test case where camera name is empty
 	cfg := &Config{
@@ -49,14 +62,56 @@ func TestConfigValidate(t *testing.T) {
 	dependencies, err = cfg.Validate(path)
 	test.That(t, dependencies, test.ShouldResemble, []string{"camera1"})
 	test.That(t, err, test.ShouldBeNil)
+
+	// Test case where a detector is given, it becomes a dependency too
+	cfg = &Config{
+		CameraName:   "camera1",
+		DetectorName: "detector1",
+		ChosenLabels: map[string]float64{"boat": 0.5},
+	}
+	dependencies, err = cfg.Validate(path)
+	test.That(t, dependencies, test.ShouldResemble, []string{"camera1", "detector1"})
+	test.That(t, err, test.ShouldBeNil)
+
+	// Test case where a chosen label has an impossible confidence
+	cfg.ChosenLabels = map[string]float64{"boat": 1.5}
+	_, err = cfg.Validate(path)
+	test.That(t, err, test.ShouldNotBeNil)
+	test.That(t, err.Error(), test.ShouldContainSubstring, "boat")
+
+	// Test case where a movement sensor is given, it needs the field of view of the camera
+	cfg = &Config{
+		CameraName:         "camera1",
+		MovementSensorName: "imu1",
+	}
+	_, err = cfg.Validate(path)
+	test.That(t, err, test.ShouldNotBeNil)
+	test.That(t, err.Error(), test.ShouldContainSubstring, "camera_vertical_fov_degrees")
+	cfg.CameraVerticalFOV = 60
+	dependencies, err = cfg.Validate(path)
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, dependencies, test.ShouldResemble, []string{"camera1", "imu1"})
+	cfg.SensorHorizonMode = "sometimes"
+	_, err = cfg.Validate(path)
+	test.That(t, err, test.ShouldNotBeNil)
+
+	// Test case where the horizon is fixed, there is nothing for a movement sensor to do
+	cfg = &Config{
+		CameraName:        "camera1",
+		HorizonStrategy:   HorizonFixed,
+		FixedHorizon:      &FixedHorizonConfig{Left: 0.4, Right: 0.4, Normalized: true},
+		CameraVerticalFOV: 60,
+	}
+	_, err = cfg.Validate(path)
+	test.That(t, err, test.ShouldBeNil)
+	cfg.MovementSensorName = "imu1"
+	_, err = cfg.Validate(path)
+	test.That(t, err, test.ShouldNotBeNil)
 }
 
 func TestClassificationsFromCamera(t *testing.T) {
-	pf := &prefilter{
-		camName:      "configuredCamera",
-		triggerFlag:  &atomic.Bool{},
-		cancelContext: context.Background(),
-	}
+	pf := newTestPrefilter("configuredCamera")
+	w := pf.cameras().byName["configuredCamera"]
 	ctx := context.Background()
 	cameraName := "testCamera"
 
@@ -87,10 +142,11 @@ func TestClassificationsFromCamera(t *testing.T) {
 	test.That(t, err, test.ShouldBeNil)
 
 	// Test case where trigger flag is set
-	pf.triggerFlag.Store(true)
+	w.triggerFlag.Store(true)
+	w.lastTrigger.Store(&Inference{Triggered: true, Confidence: 0.8})
 	classifications, err = pf.ClassificationsFromCamera(ctx, "configuredCamera", 1, nil)
 	expectedClassifications := classification.Classifications{
-		classification.NewClassification(1.0, "TRIGGER"),
+		classification.NewClassification(0.8, "TRIGGER"),
 	}
 	test.That(t, classifications, test.ShouldResemble, expectedClassifications)
 	test.That(t, err, test.ShouldBeNil)
@@ -100,8 +156,7 @@ func TestClassifications(t *testing.T) {
     // only tests that get_classifications works with a given image
     // context no longer needed for this function
     rc := RunConfig{}
-    ensemble, err := xgb.LoadXGBoostFromJSONBytes(modelbytes,
-		"", 2, 8, &activation.Softmax{})
+    ensemble, err := loadModelFromBytes(modelbytes, numFeatures(defaultPatchSize, defaultPoolWindow))
     test.That(t, err, test.ShouldBeNil)
     rc.Model = ensemble
     rc.Threshold = 0.25
@@ -109,12 +164,9 @@ func TestClassifications(t *testing.T) {
 		Min: image.Point{X: 250, Y: 350},
 		Max: image.Point{X: 580, Y: 480},
 	}
-	rc.ExcludedZone = &rect
-    pf := &prefilter{
-        triggerFlag:   &atomic.Bool{},
-        cancelContext: context.Background(),
-        rc: rc,
-    }
+	rc.Mask = NewRegionMask([]Region{RectRegion(rect)}, nil, 0)
+    pf := newTestPrefilter()
+    pf.rc.Store(&rc)
 
     ctx := context.Background()
 	f, err := os.Open("test_data/2288.jpg")
@@ -173,15 +225,12 @@ func TestCaptureAllFromCamera(t *testing.T) {
     // Create a mock image
     mockImg := image.NewRGBA(image.Rect(0, 0, mockWidth, mockHeight))
 
-    pf := &prefilter{
-        camName:       "configuredCamera",
-        triggerFlag:   &atomic.Bool{},
-        cancelContext: context.Background(),
-    }
+    pf := newTestPrefilter("configuredCamera")
+    w := pf.cameras().byName["configuredCamera"]
 
     ctx := context.Background()
 
-    atomic.StorePointer((*unsafe.Pointer)(unsafe.Pointer(&pf.currImg)), unsafe.Pointer(&mockImg))
+    atomic.StorePointer((*unsafe.Pointer)(unsafe.Pointer(&w.currImg)), unsafe.Pointer(&mockImg))
 
     // Test case where context is canceled
     cancelledCtx, cancel := context.WithCancel(ctx)
@@ -214,8 +263,9 @@ func TestCaptureAllFromCamera(t *testing.T) {
     test.That(t, err, test.ShouldBeNil)
 
     // Test case where only image is requested
-    pf.triggerFlag.Store(true)
-    atomic.StorePointer((*unsafe.Pointer)(unsafe.Pointer(&pf.currImg)), imgPtr)
+    w.triggerFlag.Store(true)
+    w.lastTrigger.Store(&Inference{Triggered: true, Confidence: 0.7})
+    atomic.StorePointer((*unsafe.Pointer)(unsafe.Pointer(&w.currImg)), imgPtr)
     capture, err = pf.CaptureAllFromCamera(ctx, "configuredCamera", viscapture.CaptureOptions{ReturnImage: true}, nil)
     test.That(t, capture.Image, test.ShouldResemble, stubImage)
     test.That(t, capture.Classifications, test.ShouldBeEmpty)
@@ -225,7 +275,7 @@ func TestCaptureAllFromCamera(t *testing.T) {
     capture, err = pf.CaptureAllFromCamera(ctx, "configuredCamera", viscapture.CaptureOptions{ReturnClassifications: true}, nil)
     expectedClassifications := viscapture.VisCapture{
         Classifications: classification.Classifications{
-            classification.NewClassification(1.0, triggerClassName),
+            classification.NewClassification(0.7, triggerClassName),
         },
     }
     test.That(t, capture.Image, test.ShouldBeNil)
@@ -238,3 +288,366 @@ func TestCaptureAllFromCamera(t *testing.T) {
     test.That(t, capture.Classifications, test.ShouldResemble, expectedClassifications.Classifications)
     test.That(t, err, test.ShouldBeNil)
 }
+
+func TestDetectionsFromCamera(t *testing.T) {
+	pf := newTestPrefilter("configuredCamera")
+	w := pf.cameras().byName["configuredCamera"]
+	ctx := context.Background()
+
+	// Test case where camera name does not match
+	detections, err := pf.DetectionsFromCamera(ctx, "testCamera", nil)
+	test.That(t, detections, test.ShouldBeNil)
+	test.That(t, err.Error(), test.ShouldEqual, "camera name given to method, testCamera is not the same as configured camera configuredCamera")
+
+	// Test case where context is done
+	cancelledCtx, cancel := context.WithCancel(ctx)
+	cancel()
+	detections, err = pf.DetectionsFromCamera(cancelledCtx, "configuredCamera", nil)
+	test.That(t, detections, test.ShouldBeNil)
+	test.That(t, err.Error(), test.ShouldEqual, "module might be configuring: context canceled")
+
+	// Test case where trigger flag is not set, old detections are not returned
+	stored := []objdet.Detection{objdet.NewDetection(image.Rect(0, 300, 200, 380), 0.9, triggerClassName)}
+	w.lastTrigger.Store(&Inference{Triggered: true, Confidence: 0.9, Detections: stored})
+	detections, err = pf.DetectionsFromCamera(ctx, "configuredCamera", nil)
+	test.That(t, detections, test.ShouldBeEmpty)
+	test.That(t, err, test.ShouldBeNil)
+
+	// Test case where trigger flag is set
+	w.triggerFlag.Store(true)
+	detections, err = pf.DetectionsFromCamera(ctx, "configuredCamera", nil)
+	test.That(t, detections, test.ShouldResemble, stored)
+	test.That(t, err, test.ShouldBeNil)
+
+	// CaptureAllFromCamera returns the same detections
+	capture, err := pf.CaptureAllFromCamera(ctx, "configuredCamera", viscapture.CaptureOptions{ReturnDetections: true}, nil)
+	test.That(t, capture.Detections, test.ShouldResemble, stored)
+	test.That(t, err, test.ShouldBeNil)
+}
+
+func TestDoCommand(t *testing.T) {
+	pf := newTestPrefilter("configuredCamera")
+	w := pf.cameras().byName["configuredCamera"]
+	ctx := context.Background()
+
+	// Test case where no command or an unknown command is given
+	_, err := pf.DoCommand(ctx, map[string]interface{}{})
+	test.That(t, err, test.ShouldNotBeNil)
+	_, err = pf.DoCommand(ctx, map[string]interface{}{"command": "self_destruct"})
+	test.That(t, err.Error(), test.ShouldEqual, "unknown command \"self_destruct\"")
+
+	// Test case where the settings can't be changed before the prefilter is configured
+	_, err = pf.DoCommand(ctx, map[string]interface{}{"command": "set_threshold", "threshold": 0.5})
+	test.That(t, err.Error(), test.ShouldEqual, "prefilter is not configured yet")
+
+	// Test case where stats are collected and reset
+	w.stats.addFrame(10*time.Millisecond, 40*time.Millisecond, true, true)
+	w.stats.addFrame(30*time.Millisecond, 20*time.Millisecond, false, false)
+	resp, err := pf.DoCommand(ctx, map[string]interface{}{"command": "get_stats"})
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, resp["frames_processed"], test.ShouldEqual, 2)
+	test.That(t, resp["frames_triggered"], test.ShouldEqual, 1)
+	test.That(t, resp["frames_raised"], test.ShouldEqual, 1)
+	test.That(t, resp["trigger_rate"], test.ShouldEqual, 0.5)
+	test.That(t, resp["inference"], test.ShouldResemble, map[string]interface{}{"min_ms": 20.0, "max_ms": 40.0, "mean_ms": 30.0})
+	test.That(t, resp["stream_next"], test.ShouldResemble, map[string]interface{}{"min_ms": 10.0, "max_ms": 30.0, "mean_ms": 20.0})
+	// the rate is of the raised TRIGGER, a frame waiting for confirmation doesn't count
+	w.stats.addFrame(10*time.Millisecond, 40*time.Millisecond, true, false)
+	w.stats.addFrame(10*time.Millisecond, 40*time.Millisecond, true, false)
+	resp, err = pf.DoCommand(ctx, map[string]interface{}{"command": "get_stats"})
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, resp["frames_triggered"], test.ShouldEqual, 3)
+	test.That(t, resp["frames_raised"], test.ShouldEqual, 1)
+	test.That(t, resp["trigger_rate"], test.ShouldEqual, 0.25)
+	_, err = pf.DoCommand(ctx, map[string]interface{}{"command": "reset_stats"})
+	test.That(t, err, test.ShouldBeNil)
+	resp, err = pf.DoCommand(ctx, map[string]interface{}{"command": "get_stats"})
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, resp["frames_processed"], test.ShouldEqual, 0)
+	test.That(t, resp["trigger_rate"], test.ShouldEqual, 0.0)
+
+	// Test case where the threshold is changed live
+	zone := image.Rect(0, 0, 10, 10)
+	included := []Region{RectRegion(image.Rect(0, 0, 100, 100))}
+	pf.rc.Store(&RunConfig{Threshold: 0.25, Mask: NewRegionMask([]Region{RectRegion(zone)}, included, 0.5)})
+	resp, err = pf.DoCommand(ctx, map[string]interface{}{"command": "set_threshold", "threshold": 0.6})
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, resp["threshold"], test.ShouldEqual, 0.6)
+	test.That(t, pf.rc.Load().Threshold, test.ShouldEqual, 0.6)
+	test.That(t, pf.rc.Load().Mask.Excluded, test.ShouldResemble, []Region{RectRegion(zone)})
+	_, err = pf.DoCommand(ctx, map[string]interface{}{"command": "set_threshold", "threshold": 1.6})
+	test.That(t, err, test.ShouldNotBeNil)
+	_, err = pf.DoCommand(ctx, map[string]interface{}{"command": "set_threshold", "threshold": "high"})
+	test.That(t, err, test.ShouldNotBeNil)
+	test.That(t, pf.rc.Load().Threshold, test.ShouldEqual, 0.6)
+
+	// Test case where the excluded region is changed live, and then cleared
+	_, err = pf.DoCommand(ctx, map[string]interface{}{"command": "set_excluded_region", "excluded_region": []interface{}{1.0, 2.0, 3.0, 4.0}})
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, pf.rc.Load().Mask.Excluded, test.ShouldResemble, []Region{RectRegion(image.Rect(1, 2, 3, 4))})
+	test.That(t, pf.rc.Load().Mask.Included, test.ShouldResemble, included)
+	test.That(t, pf.rc.Load().Mask.MaxMaskedFraction, test.ShouldEqual, 0.5)
+	test.That(t, pf.rc.Load().Threshold, test.ShouldEqual, 0.6)
+	_, err = pf.DoCommand(ctx, map[string]interface{}{"command": "set_excluded_region", "excluded_region": []interface{}{1.0, 2.0}})
+	test.That(t, err, test.ShouldNotBeNil)
+	_, err = pf.DoCommand(ctx, map[string]interface{}{"command": "set_excluded_region", "excluded_region": []interface{}{}})
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, pf.rc.Load().Mask.Excluded, test.ShouldBeEmpty)
+	test.That(t, pf.rc.Load().Mask.Included, test.ShouldResemble, included)
+
+	// Test case where several regions are given, including a polygon
+	_, err = pf.DoCommand(ctx, map[string]interface{}{"command": "set_excluded_region", "excluded_regions": []interface{}{
+		map[string]interface{}{"rectangle": []interface{}{0.0, 0.0, 10.0, 10.0}},
+		map[string]interface{}{"polygon": []interface{}{[]interface{}{0.0, 0.0}, []interface{}{10.0, 0.0}, []interface{}{0.0, 10.0}}},
+	}})
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, pf.rc.Load().Mask.Excluded, test.ShouldResemble, []Region{
+		RectRegion(image.Rect(0, 0, 10, 10)),
+		{Corners: []Corner{{0, 0}, {10, 0}, {0, 10}}},
+	})
+	_, err = pf.DoCommand(ctx, map[string]interface{}{"command": "set_excluded_region", "excluded_regions": []interface{}{
+		map[string]interface{}{"rectangle": []interface{}{0.0, 0.5, 0.25, 1.0}, "normalized": true},
+	}})
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, pf.rc.Load().Mask.Excluded, test.ShouldResemble, []Region{NormalizedRectRegion(0, 0.5, 0.25, 1)})
+	_, err = pf.DoCommand(ctx, map[string]interface{}{"command": "set_excluded_region", "excluded_regions": []interface{}{
+		map[string]interface{}{"polygon": []interface{}{[]interface{}{0.0, 0.0}}},
+	}})
+	test.That(t, err, test.ShouldNotBeNil)
+	_, err = pf.DoCommand(ctx, map[string]interface{}{"command": "set_excluded_region"})
+	test.That(t, err, test.ShouldNotBeNil)
+
+	// Test case where max_excluded_overlap is configured without regions, and still applies to regions set later
+	mask, err := (&Config{MaxExcludedOverlap: 0.5}).regionMask()
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, mask, test.ShouldNotBeNil)
+	pf.rc.Store(&RunConfig{Threshold: 0.25, Mask: mask})
+	bounds, patch := image.Rect(0, 0, 100, 100), image.Rect(0, 0, 10, 10)
+	test.That(t, pf.rc.Load().Mask.skip(bounds, patch), test.ShouldBeFalse)
+	_, err = pf.DoCommand(ctx, map[string]interface{}{"command": "set_excluded_region", "excluded_region": []interface{}{0.0, 0.0, 4.0, 10.0}})
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, pf.rc.Load().Mask.MaxMaskedFraction, test.ShouldEqual, 0.5)
+	test.That(t, pf.rc.Load().Mask.skip(bounds, patch), test.ShouldBeFalse)
+	_, err = pf.DoCommand(ctx, map[string]interface{}{"command": "set_excluded_region", "excluded_region": []interface{}{0.0, 0.0, 6.0, 10.0}})
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, pf.rc.Load().Mask.skip(bounds, patch), test.ShouldBeTrue)
+}
+
+func TestMultipleCameras(t *testing.T) {
+	ctx := context.Background()
+	cfg := &Config{
+		CameraName:  "bow",
+		CameraNames: []string{"stern", "port"},
+		CameraRegions: map[string]CameraRegionsConfig{
+			"stern": {ExcludedRegions: []RegionConfig{{Rectangle: []float64{0, 0.8, 1, 1}, Normalized: true}}},
+		},
+		ExcludedRegion: []int{0, 0, 10, 10},
+	}
+	deps, err := cfg.Validate("test_path")
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, deps, test.ShouldResemble, []string{"bow", "stern", "port"})
+
+	// each camera has its own regions, or the ones of the service
+	serviceMask, err := cfg.regionMask()
+	test.That(t, err, test.ShouldBeNil)
+	mask, err := cfg.cameraMask("bow", serviceMask)
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, mask, test.ShouldNotEqual, serviceMask)
+	test.That(t, mask.Excluded, test.ShouldResemble, serviceMask.Excluded)
+	// the copy caches the mask of its own resolution, so it doesn't replace the one of the service
+	bounds := image.Rect(0, 0, 100, 100)
+	test.That(t, mask.maskedFraction(bounds, image.Rect(0, 0, 20, 20)), test.ShouldEqual, 0.25)
+	test.That(t, mask.cachedBounds, test.ShouldResemble, bounds)
+	test.That(t, serviceMask.integral, test.ShouldBeNil)
+	mask, err = cfg.cameraMask("stern", serviceMask)
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, mask.Excluded, test.ShouldResemble, []Region{NormalizedRectRegion(0, 0.8, 1, 1)})
+
+	for _, bad := range []*Config{
+		{CameraName: "bow", CameraNames: []string{"bow"}},
+		{CameraNames: []string{"bow", ""}},
+		{CameraNames: []string{"bow"}, CameraRegions: map[string]CameraRegionsConfig{"stern": {}}},
+		{CameraNames: []string{"bow"}, CameraRegions: map[string]CameraRegionsConfig{"bow": {ExcludedRegions: []RegionConfig{{}}}}},
+		{CameraNames: []string{"bow", "stern"}, MovementSensorName: "imu1", CameraVerticalFOV: 60},
+	} {
+		_, err = bad.Validate("test_path")
+		test.That(t, err, test.ShouldNotBeNil)
+	}
+
+	// every camera has its own trigger
+	pf := newTestPrefilter("bow", "stern")
+	bow, stern := pf.cameras().byName["bow"], pf.cameras().byName["stern"]
+	bow.triggerFlag.Store(true)
+	bow.lastTrigger.Store(&Inference{Triggered: true, Confidence: 0.9})
+	classifications, err := pf.ClassificationsFromCamera(ctx, "bow", 1, nil)
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, classifications, test.ShouldResemble, classification.Classifications{classification.NewClassification(0.9, triggerClassName)})
+	classifications, err = pf.ClassificationsFromCamera(ctx, "stern", 1, nil)
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, classifications, test.ShouldBeEmpty)
+	_, err = pf.ClassificationsFromCamera(ctx, "port", 1, nil)
+	test.That(t, err.Error(), test.ShouldEqual, "camera name given to method, port is not one of the configured cameras [bow stern]")
+
+	// and its own last frame
+	var sternImg image.Image = image.NewRGBA(image.Rect(0, 0, 10, 10))
+	stern.currImg.Store(&sternImg)
+	capture, err := pf.CaptureAllFromCamera(ctx, "stern", viscapture.CaptureOptions{ReturnImage: true, ReturnClassifications: true}, nil)
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, capture.Image, test.ShouldEqual, sternImg)
+	test.That(t, capture.Classifications, test.ShouldBeEmpty)
+	capture, err = pf.CaptureAllFromCamera(ctx, "bow", viscapture.CaptureOptions{ReturnImage: true}, nil)
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, capture.Image, test.ShouldBeNil)
+	_, err = pf.CaptureAllFromCamera(ctx, "port", viscapture.CaptureOptions{ReturnDetections: true}, nil)
+	test.That(t, err, test.ShouldNotBeNil)
+
+	// and its own stats
+	bow.stats.addFrame(time.Millisecond, time.Millisecond, true, true)
+	resp, err := pf.DoCommand(ctx, map[string]interface{}{"command": "get_stats", "camera_name": "bow"})
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, resp["frames_processed"], test.ShouldEqual, 1)
+	resp, err = pf.DoCommand(ctx, map[string]interface{}{"command": "get_stats"})
+	test.That(t, err, test.ShouldBeNil)
+	cameras, ok := resp["cameras"].(map[string]interface{})
+	test.That(t, ok, test.ShouldBeTrue)
+	test.That(t, cameras["stern"].(map[string]interface{})["frames_processed"], test.ShouldEqual, 0)
+	_, err = pf.DoCommand(ctx, map[string]interface{}{"command": "reset_stats", "camera_name": "bow"})
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, bow.stats.toMap()["frames_processed"], test.ShouldEqual, 0)
+	_, err = pf.DoCommand(ctx, map[string]interface{}{"command": "get_stats", "camera_name": "port"})
+	test.That(t, err, test.ShouldNotBeNil)
+
+	// the threshold changes for every camera, excluded regions can be changed for one
+	pf.rc.Store(&RunConfig{Threshold: 0.25})
+	bow.rc.Store(&RunConfig{Threshold: 0.25})
+	stern.rc.Store(&RunConfig{Threshold: 0.25})
+	_, err = pf.DoCommand(ctx, map[string]interface{}{"command": "set_threshold", "threshold": 0.5})
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, bow.rc.Load().Threshold, test.ShouldEqual, 0.5)
+	test.That(t, stern.rc.Load().Threshold, test.ShouldEqual, 0.5)
+	resp, err = pf.DoCommand(ctx, map[string]interface{}{"command": "set_excluded_region", "camera_name": "stern", "excluded_region": []interface{}{0, 0, 10, 10}})
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, resp["camera_name"], test.ShouldEqual, "stern")
+	test.That(t, stern.rc.Load().Mask.Excluded, test.ShouldResemble, []Region{RectRegion(image.Rect(0, 0, 10, 10))})
+	test.That(t, bow.rc.Load().Mask, test.ShouldBeNil)
+	test.That(t, pf.rc.Load().Mask, test.ShouldBeNil)
+
+	// without a camera_name, cameras with their own camera_regions keep them
+	stern.ownRegions = true
+	_, err = pf.DoCommand(ctx, map[string]interface{}{"command": "set_excluded_region", "excluded_region": []interface{}{0, 0, 20, 20}})
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, pf.rc.Load().Mask.Excluded, test.ShouldResemble, []Region{RectRegion(image.Rect(0, 0, 20, 20))})
+	test.That(t, bow.rc.Load().Mask.Excluded, test.ShouldResemble, []Region{RectRegion(image.Rect(0, 0, 20, 20))})
+	test.That(t, stern.rc.Load().Mask.Excluded, test.ShouldResemble, []Region{RectRegion(image.Rect(0, 0, 10, 10))})
+}
+
+func TestStreamStateSurvivesRestart(t *testing.T) {
+	w := newCameraWorker("bow")
+	rc := RunConfig{frequency: DefaultMaxFrequency, confirmFrames: 2, confirmWindow: 3}
+	tracker, state := w.streamState(rc)
+	now := time.Now()
+	test.That(t, state.update(now, true), test.ShouldBeFalse)
+
+	// a stream started again after an error gets the same tracker and confirmation history
+	restartedTracker, restartedState := w.streamState(rc)
+	test.That(t, restartedTracker, test.ShouldEqual, tracker)
+	test.That(t, restartedState, test.ShouldEqual, state)
+	test.That(t, restartedState.update(now.Add(100*time.Millisecond), true), test.ShouldBeTrue)
+}
+
+func TestProcessFrameWithoutHorizon(t *testing.T) {
+	ctx := context.Background()
+	// a frame too small to find the horizon in, like a frame in fog
+	noHorizon := image.NewGray(image.Rect(0, 0, 4, 4))
+
+	// the frame counts as not triggered, and the trigger is still held by an earlier frame
+	w := newCameraWorker("bow")
+	rc := RunConfig{logger: logging.NewTestLogger(t), frequency: DefaultMaxFrequency, confirmFrames: 1, confirmWindow: 1, triggerHold: time.Hour}
+	_, state := w.streamState(rc)
+	test.That(t, state.update(time.Now(), true), test.ShouldBeTrue)
+	w.processFrame(ctx, noHorizon, rc, state, time.Millisecond)
+	test.That(t, w.triggerFlag.Load(), test.ShouldBeTrue)
+	resp := w.stats.toMap()
+	test.That(t, resp["frames_processed"], test.ShouldEqual, 1)
+	test.That(t, resp["frames_failed"], test.ShouldEqual, 1)
+	test.That(t, resp["frames_triggered"], test.ShouldEqual, 0)
+	test.That(t, resp["frames_raised"], test.ShouldEqual, 1)
+
+	// and breaks the confirmation of the frames around it
+	w = newCameraWorker("stern")
+	rc.confirmFrames, rc.confirmWindow = 2, 2
+	_, state = w.streamState(rc)
+	now := time.Now()
+	test.That(t, state.update(now, true), test.ShouldBeFalse)
+	w.processFrame(ctx, noHorizon, rc, state, time.Millisecond)
+	test.That(t, w.triggerFlag.Load(), test.ShouldBeFalse)
+	test.That(t, state.update(now, true), test.ShouldBeFalse)
+}
+
+func TestSwapWorkers(t *testing.T) {
+	ctx := context.Background()
+	pf := newTestPrefilter("bow")
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		// a reconfigure swaps the cameras while they are read, which the race detector checks
+		for i := 0; i < 200; i++ {
+			pf.setWorkers([]*cameraWorker{newCameraWorker("bow"), newCameraWorker("stern")})
+			pf.setWorkers([]*cameraWorker{newCameraWorker("bow")})
+		}
+	}()
+	for i := 0; i < 200; i++ {
+		_, err := pf.ClassificationsFromCamera(ctx, "bow", 1, nil)
+		test.That(t, err, test.ShouldBeNil)
+		_, err = pf.CaptureAllFromCamera(ctx, "bow", viscapture.CaptureOptions{ReturnClassifications: true}, nil)
+		test.That(t, err, test.ShouldBeNil)
+		_, err = pf.DoCommand(ctx, map[string]interface{}{"command": "get_stats"})
+		test.That(t, err, test.ShouldBeNil)
+	}
+	<-done
+}
+
+// fakeCamera is a camera dependency that is only looked up, never streamed from
+type fakeCamera struct {
+	camera.Camera
+}
+
+func TestReconfigure(t *testing.T) {
+	ctx := context.Background()
+	logger := logging.NewTestLogger(t)
+	deps := resource.Dependencies{camera.Named("bow"): &fakeCamera{}}
+	conf := resource.Config{ConvertedAttributes: &Config{CameraName: "bow", TriggerOnMotion: true}}
+
+	// the settings of the service come back whole, every camera gets its own background model
+	rc, workers, err := newCameraWorkers(deps, conf, logger)
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, rc.motion, test.ShouldNotBeNil)
+	test.That(t, workers, test.ShouldHaveLength, 1)
+	camRC := workers[0].rc.Load()
+	test.That(t, camRC.camName, test.ShouldEqual, "bow")
+	test.That(t, camRC.motion, test.ShouldNotBeNil)
+	test.That(t, camRC.motion, test.ShouldNotEqual, rc.motion)
+
+	// a config that fails leaves the running streams and their trigger alone
+	pf := newTestPrefilter("bow")
+	running, cancel := context.WithCancel(ctx)
+	defer cancel()
+	pf.cancelContext, pf.cancelFunc = running, cancel
+	pf.rc.Store(&RunConfig{Threshold: 0.25})
+	bow := pf.cameras().byName["bow"]
+	bow.triggerFlag.Store(true)
+	for _, bad := range []resource.Config{
+		{ConvertedAttributes: &Config{CameraName: "stern"}},
+		{ConvertedAttributes: &Config{CameraName: "bow", DetectorName: "detector1"}},
+		{ConvertedAttributes: &Config{CameraName: "bow", Threshold: 2}},
+	} {
+		err = pf.Reconfigure(ctx, deps, bad)
+		test.That(t, err, test.ShouldNotBeNil)
+		test.That(t, running.Err(), test.ShouldBeNil)
+		test.That(t, pf.cameras().byName["bow"], test.ShouldEqual, bow)
+		test.That(t, pf.rc.Load().Threshold, test.ShouldEqual, 0.25)
+		classifications, err := pf.ClassificationsFromCamera(ctx, "bow", 1, nil)
+		test.That(t, err, test.ShouldBeNil)
+		test.That(t, classifications, test.ShouldHaveLength, 1)
+	}
+}
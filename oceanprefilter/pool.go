@@ -0,0 +1,87 @@
+package oceanprefilter
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+// patchScore is the outcome of scoring one patch
+type patchScore struct {
+	scored bool // false if motion gating skipped the patch
+	prob   float64
+	err    error
+}
+
+// scorePatches scores the patches with the model, on up to rc.Workers goroutines. It returns the scores and the number
+// of patches, from the first one on, whose scores are final. Patches are handed out in order, and once a patch triggers
+// with rc.StopAtFirstTrigger set, or fails, no patch after it is started, so the scores up to and including it are exactly
+// the ones the patches would get one at a time.
+func (rc RunConfig) scorePatches(imgs []imagePatch, motion []float64) ([]patchScore, int) {
+	scores := make([]patchScore, len(imgs))
+	poolWindow := rc.poolWindow()
+	// every goroutine pools its patches into its own features, which are reused from patch to patch
+	score := func(i int, features []float32) bool {
+		if motion != nil && rc.motionMode == MotionModeGate && motion[i] < rc.motionThreshold {
+			return false // the model only gets to look at patches that moved
+		}
+		avgPool(imgs[i].img, poolWindow, features)
+		prob, err := interestingProbability(rc.Model, features)
+		scores[i] = patchScore{scored: true, prob: prob, err: err}
+		if err != nil {
+			return true
+		}
+		moving := motion != nil && motion[i] >= rc.motionThreshold
+		return rc.StopAtFirstTrigger && (prob >= rc.Threshold || (moving && rc.motionMode == MotionModeTrigger))
+	}
+
+	workers := rc.Workers
+	if workers > len(imgs) {
+		workers = len(imgs)
+	}
+	if workers <= 1 {
+		features := rc.newFeatures()
+		for i := range imgs {
+			if score(i, features) {
+				return scores, i + 1
+			}
+		}
+		return scores, len(imgs)
+	}
+
+	var next, stop atomic.Int64
+	stop.Store(int64(len(imgs)))
+	var wg sync.WaitGroup
+	for k := 0; k < workers; k++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			features := rc.newFeatures()
+			for {
+				i := next.Add(1) - 1
+				if i >= stop.Load() {
+					return
+				}
+				if !score(int(i), features) {
+					continue
+				}
+				// an earlier patch may have stopped the work already
+				for s := stop.Load(); i < s && !stop.CompareAndSwap(s, i); s = stop.Load() {
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	end := int(stop.Load())
+	if end < len(imgs) {
+		end++
+	}
+	return scores, end
+}
+
+// newFeatures returns a buffer for the features of one patch
+func (rc RunConfig) newFeatures() []float32 {
+	if rc.Model != nil {
+		return rc.Model.newFeatures()
+	}
+	return make([]float32, numFeatures(rc.patchSize(), rc.poolWindow()))
+}
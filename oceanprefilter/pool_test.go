@@ -0,0 +1,95 @@
+package oceanprefilter
+
+import (
+	"fmt"
+	"image"
+	"os"
+	"runtime"
+	"testing"
+
+	"go.viam.com/test"
+)
+
+// loadFrame returns the test image, scaled up to width x height like a frame of a bigger camera
+func loadFrame(tb testing.TB, width, height int) image.Image {
+	f, err := os.Open("test_data/2288.jpg")
+	test.That(tb, err, test.ShouldBeNil)
+	defer f.Close()
+	img, _, err := image.Decode(f)
+	test.That(tb, err, test.ShouldBeNil)
+	src := img.Bounds()
+	frame := image.NewRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			frame.Set(x, y, img.At(src.Min.X+x*src.Dx()/width, src.Min.Y+y*src.Dy()/height))
+		}
+	}
+	return frame
+}
+
+func TestParallelInference(t *testing.T) {
+	img := loadFrame(t, 1920, 1080)
+	ensemble, err := loadModel("", numFeatures(defaultPatchSize, defaultPoolWindow))
+	test.That(t, err, test.ShouldBeNil)
+
+	// any number of workers gives the result of scoring the patches one at a time
+	rc := RunConfig{Model: ensemble, Threshold: 0.25}
+	sequential, err := MakeInference(img, rc)
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, len(sequential.Detections), test.ShouldBeGreaterThan, 1)
+	for _, workers := range []int{2, 4, 16, 1000} {
+		rc.Workers = workers
+		res, err := MakeInference(img, rc)
+		test.That(t, err, test.ShouldBeNil)
+		test.That(t, res, test.ShouldResemble, sequential)
+	}
+
+	// stopping at the first trigger always stops at the same patch
+	rc.StopAtFirstTrigger = true
+	rc.Workers = 1
+	first, err := MakeInference(img, rc)
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, first.Triggered, test.ShouldBeTrue)
+	test.That(t, first.Detections, test.ShouldResemble, sequential.Detections[:1])
+	for _, workers := range []int{2, 4, 16} {
+		rc.Workers = workers
+		for i := 0; i < 10; i++ {
+			res, err := MakeInference(img, rc)
+			test.That(t, err, test.ShouldBeNil)
+			test.That(t, res, test.ShouldResemble, first)
+		}
+	}
+
+	// nothing triggers, so every patch is scored
+	rc.Threshold = 1.0
+	res, err := MakeInference(img, rc)
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, res.Triggered, test.ShouldBeFalse)
+
+	// a failing patch fails the frame
+	rc.Model = nil
+	_, err = MakeInference(img, rc)
+	test.That(t, err, test.ShouldNotBeNil)
+}
+
+func BenchmarkMakeInference(b *testing.B) {
+	img := loadFrame(b, 1920, 1080)
+	ensemble, err := loadModel("", numFeatures(defaultPatchSize, defaultPoolWindow))
+	test.That(b, err, test.ShouldBeNil)
+
+	workerCounts := []int{1, 2, 4}
+	if n := runtime.NumCPU(); n > 4 {
+		workerCounts = append(workerCounts, n)
+	}
+	for _, workers := range workerCounts {
+		// nothing triggers, so every patch is scored
+		rc := RunConfig{Model: ensemble, Threshold: 1.0, Workers: workers}
+		b.Run(fmt.Sprintf("workers=%v", workers), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				if _, err := MakeInference(img, rc); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
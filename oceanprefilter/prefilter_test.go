@@ -2,13 +2,10 @@ package oceanprefilter
 
 import (
 	"image"
-	"math"
 	"os"
 	"path/filepath"
 	"testing"
 
-	xgb "github.com/Elvenson/xgboost-go"
-	"github.com/Elvenson/xgboost-go/activation"
 	"go.viam.com/test"
 )
 
@@ -20,8 +17,7 @@ func TestXGBoostInference(t *testing.T) {
 	test.That(t, err, test.ShouldBeNil)
 
 	rc := RunConfig{}
-	ensemble, err := xgb.LoadXGBoostFromJSONBytes(modelbytes,
-		"", 2, 8, &activation.Softmax{})
+	ensemble, err := loadModelFromBytes(modelbytes, numFeatures(defaultPatchSize, defaultPoolWindow))
 	test.That(t, err, test.ShouldBeNil)
 
 	rc.Model = ensemble
@@ -30,11 +26,32 @@ func TestXGBoostInference(t *testing.T) {
 		Min: image.Point{X: 250, Y: 350},
 		Max: image.Point{X: 580, Y: 480},
 	}
-	rc.ExcludedZone = &rect
+	rc.Mask = NewRegionMask([]Region{RectRegion(rect)}, nil, 0)
 
 	res, err := MakeInference(img, rc)
 	test.That(t, err, test.ShouldBeNil)
-	test.That(t, res, test.ShouldBeTrue)
+	test.That(t, res.Triggered, test.ShouldBeTrue)
+	test.That(t, res.Confidence, test.ShouldBeGreaterThanOrEqualTo, rc.Threshold)
+	test.That(t, res.Confidence, test.ShouldBeLessThanOrEqualTo, 1.0)
+	// every triggering patch is reported as a box below the horizon, outside of the excluded zone
+	test.That(t, res.Detections, test.ShouldNotBeEmpty)
+	for _, d := range res.Detections {
+		test.That(t, d.Label(), test.ShouldEqual, triggerClassName)
+		test.That(t, d.Score(), test.ShouldBeGreaterThanOrEqualTo, rc.Threshold)
+		test.That(t, d.Score(), test.ShouldBeLessThanOrEqualTo, res.Confidence)
+		box := *d.BoundingBox()
+		test.That(t, box.In(img.Bounds()), test.ShouldBeTrue)
+		test.That(t, box.Min.Y, test.ShouldBeGreaterThan, 1)
+		test.That(t, box.Overlaps(rect), test.ShouldBeFalse)
+	}
+
+	// a threshold above every patch's probability never triggers
+	rc.Threshold = 1.0
+	res, err = MakeInference(img, rc)
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, res.Triggered, test.ShouldBeFalse)
+	test.That(t, res.Confidence, test.ShouldBeLessThan, 1.0)
+	test.That(t, res.Detections, test.ShouldBeEmpty)
 }
 
 func TestSplitData(t *testing.T) {
@@ -57,13 +74,117 @@ func TestSplitData(t *testing.T) {
 			Min: image.Point{X: 250, Y: 350},
 			Max: image.Point{X: 580, Y: 480},
 		}
-		rc.ExcludedZone = &rect
-		linePoints, err := findHorizonLine(img)
+		rc.Mask = NewRegionMask([]Region{RectRegion(rect)}, nil, 0)
+		horizon, err := findHorizonLine(img)
 		test.That(t, err, test.ShouldBeNil)
-		cropY := int(math.Max(float64(linePoints[0].Y), float64(linePoints[1].Y)))
 
-		_, err = splitUpImageConst(img, rc.ExcludedZone, cropY, 80, 200)
+		patches, err := splitUpImageBelow(img, rc.Mask, horizon, 80, 200)
 		test.That(t, err, test.ShouldBeNil)
+		for _, p := range patches {
+			test.That(t, float64(p.box.Min.Y), test.ShouldBeGreaterThanOrEqualTo, horizon.YAt(float64(p.box.Min.X)))
+			test.That(t, float64(p.box.Min.Y), test.ShouldBeGreaterThanOrEqualTo, horizon.YAt(float64(p.box.Max.X-1)))
+			test.That(t, p.box.In(img.Bounds()), test.ShouldBeTrue)
+		}
+
+	}
+}
+
+func TestLoadModel(t *testing.T) {
+	// an empty path falls back to the embedded model
+	ensemble, err := loadModel("", numFeatures(defaultPatchSize, defaultPoolWindow))
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, ensemble.NumClasses(), test.ShouldEqual, modelNumClasses)
+
+	// a model on disk gets loaded
+	dir := t.TempDir()
+	fp := filepath.Join(dir, "model.json")
+	test.That(t, os.WriteFile(fp, modelbytes, 0o600), test.ShouldBeNil)
+	ensemble, err = loadModel(fp, numFeatures(defaultPatchSize, defaultPoolWindow))
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, ensemble, test.ShouldNotBeNil)
+
+	// missing file
+	_, err = loadModel(filepath.Join(dir, "not_there.json"), 800)
+	test.That(t, err, test.ShouldNotBeNil)
+	test.That(t, err.Error(), test.ShouldContainSubstring, "unable to read model file")
+
+	// tree count that doesn't fit two classes
+	leaf := `{ "nodeid": 0, "depth": 0, "split": "f1", "split_condition": 1.0, "yes": 1, "no": 2, "missing": 2, "children": [
+		{ "nodeid": 1, "leaf": 0.5 }, { "nodeid": 2, "leaf": -0.5 } ]}`
+	_, err = loadModelFromBytes([]byte("["+leaf+","+leaf+","+leaf+"]"), 800)
+	test.That(t, err, test.ShouldNotBeNil)
+	test.That(t, err.Error(), test.ShouldContainSubstring, "not a multiple of the 2 classes")
+
+	// splitting on a feature the patches don't have
+	bigFeature := `{ "nodeid": 0, "depth": 0, "split": "f900", "split_condition": 1.0, "yes": 1, "no": 2, "missing": 2, "children": [
+		{ "nodeid": 1, "leaf": 0.5 }, { "nodeid": 2, "leaf": -0.5 } ]}`
+	_, err = loadModelFromBytes([]byte("["+leaf+","+bigFeature+"]"), 800)
+	test.That(t, err, test.ShouldNotBeNil)
+	test.That(t, err.Error(), test.ShouldContainSubstring, "splits on feature f900")
+
+	// not a dump at all
+	_, err = loadModelFromBytes([]byte(`{"learner": {}}`), 800)
+	test.That(t, err, test.ShouldNotBeNil)
+	_, err = loadModelFromBytes([]byte(`[]`), 800)
+	test.That(t, err, test.ShouldNotBeNil)
+}
+
+func TestSplitUpImageConstBoxes(t *testing.T) {
+	img := MockImage(640, 480)
+	patches, err := splitUpImageConst(img, nil, 100, 80, 200)
+	test.That(t, err, test.ShouldBeNil)
+	// 380 rows of water give 5 rows of patches, 640 columns give 4 columns of patches
+	test.That(t, len(patches), test.ShouldEqual, 20)
+	test.That(t, patches[0].box, test.ShouldResemble, image.Rect(0, 100, 200, 180))
+	test.That(t, patches[5].box, test.ShouldResemble, image.Rect(200, 180, 400, 260))
+	for _, p := range patches {
+		// the boxes are in the coordinates of the original image, but the patches all have the same size
+		test.That(t, p.box.In(img.Bounds()), test.ShouldBeTrue)
+		test.That(t, p.img.Bounds().Dx(), test.ShouldEqual, 200)
+		test.That(t, p.img.Bounds().Dy(), test.ShouldEqual, 80)
+	}
+
+	// the excluded zone is given in the coordinates of the original image too
+	exZone := image.Rect(0, 100, 100, 150)
+	patches, err = splitUpImageConst(img, NewRegionMask([]Region{RectRegion(exZone)}, nil, 0), 100, 80, 200)
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, len(patches), test.ShouldEqual, 19)
+	for _, p := range patches {
+		test.That(t, p.box.Overlaps(exZone), test.ShouldBeFalse)
+	}
+}
+
+func TestPatchGeometry(t *testing.T) {
+	test.That(t, numFeatures(defaultPatchSize, defaultPoolWindow), test.ShouldEqual, 800)
+	test.That(t, checkPatchGeometry(defaultPatchSize, defaultPoolWindow), test.ShouldBeNil)
+	test.That(t, checkPatchGeometry(image.Point{200, 0}, defaultPoolWindow), test.ShouldNotBeNil)
+	test.That(t, checkPatchGeometry(defaultPatchSize, image.Point{-10, 2}), test.ShouldNotBeNil)
+	test.That(t, checkPatchGeometry(image.Point{205, 80}, defaultPoolWindow), test.ShouldNotBeNil)
+
+	// the embedded model needs 800 features, smaller patches don't have enough
+	_, err := loadModel("", numFeatures(image.Point{100, 40}, defaultPoolWindow))
+	test.That(t, err, test.ShouldNotBeNil)
+	test.That(t, err.Error(), test.ShouldContainSubstring, "only has 200 features")
+
+	// and a smaller pool window gives more features than it was trained on, in other places
+	_, err = loadModel("", numFeatures(defaultPatchSize, image.Point{5, 2}))
+	test.That(t, err, test.ShouldNotBeNil)
+	test.That(t, err.Error(), test.ShouldContainSubstring, "trained on 800 features, but each patch has 1600 features")
 
+	// bigger patches pooled with a bigger window give the same number of features
+	patchSize, poolWindow := image.Point{400, 160}, image.Point{20, 4}
+	ensemble, err := loadModel("", numFeatures(patchSize, poolWindow))
+	test.That(t, err, test.ShouldBeNil)
+	f, err := os.Open("test_data/2288.jpg")
+	test.That(t, err, test.ShouldBeNil)
+	defer f.Close()
+	img, _, err := image.Decode(f)
+	test.That(t, err, test.ShouldBeNil)
+	rc := RunConfig{Model: ensemble, Threshold: 0.25, PatchSize: patchSize, PoolWindow: poolWindow}
+	res, err := MakeInference(img, rc)
+	test.That(t, err, test.ShouldBeNil)
+	for _, d := range res.Detections {
+		test.That(t, d.BoundingBox().Dx(), test.ShouldBeLessThanOrEqualTo, patchSize.X)
+		test.That(t, d.BoundingBox().Dy(), test.ShouldBeLessThanOrEqualTo, patchSize.Y)
 	}
 }
@@ -0,0 +1,285 @@
+package oceanprefilter
+
+import (
+	"fmt"
+	"image"
+	"strings"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+// Corner is a corner of a region
+type Corner struct {
+	X, Y float64
+}
+
+// Region is an area of the image given as the corners of a polygon. The corners are in pixels, or if Normalized
+// is set, in fractions of the width and height of the frame, so the region covers the same part of the scene
+// whatever the resolution of the camera is.
+type Region struct {
+	Corners    []Corner
+	Normalized bool
+}
+
+// RectRegion returns the region covering the rectangle, in pixels
+func RectRegion(r image.Rectangle) Region {
+	r = r.Canon()
+	return Region{Corners: []Corner{
+		{float64(r.Min.X), float64(r.Min.Y)},
+		{float64(r.Max.X), float64(r.Min.Y)},
+		{float64(r.Max.X), float64(r.Max.Y)},
+		{float64(r.Min.X), float64(r.Max.Y)},
+	}}
+}
+
+// NormalizedRectRegion returns the region covering the rectangle given in fractions of the frame's width and height
+func NormalizedRectRegion(xMin, yMin, xMax, yMax float64) Region {
+	return Region{Corners: []Corner{{xMin, yMin}, {xMax, yMin}, {xMax, yMax}, {xMin, yMax}}, Normalized: true}
+}
+
+// inFrame returns the corners of the region in the pixels of a frame with the given bounds
+func (r Region) inFrame(bounds image.Rectangle) []Corner {
+	if !r.Normalized {
+		return r.Corners
+	}
+	corners := make([]Corner, 0, len(r.Corners))
+	for _, c := range r.Corners {
+		corners = append(corners, Corner{
+			X: float64(bounds.Min.X) + c.X*float64(bounds.Dx()),
+			Y: float64(bounds.Min.Y) + c.Y*float64(bounds.Dy()),
+		})
+	}
+	return corners
+}
+
+// polygonContains reports whether the center of the pixel at (x, y) lies inside the polygon, using the even-odd rule
+func polygonContains(corners []Corner, x, y int) bool {
+	px, py := float64(x)+0.5, float64(y)+0.5
+	inside := false
+	for i, j := 0, len(corners)-1; i < len(corners); j, i = i, i+1 {
+		ci, cj := corners[i], corners[j]
+		if (ci.Y > py) != (cj.Y > py) && px < (cj.X-ci.X)*(py-ci.Y)/(cj.Y-ci.Y)+ci.X {
+			inside = !inside
+		}
+	}
+	return inside
+}
+
+// RegionConfig is how a region is written in the config, either as a rectangle or as a polygon
+type RegionConfig struct {
+	// Rectangle is the upper left and lower right corner, [x_min, y_min, x_max, y_max]
+	Rectangle []float64 `json:"rectangle,omitempty"`
+	// Polygon is a list of at least three [x, y] corners
+	Polygon [][]float64 `json:"polygon,omitempty"`
+	// Normalized means the numbers are fractions between 0 and 1 of the frame's width and height, instead of pixels
+	Normalized bool `json:"normalized,omitempty"`
+}
+
+// region checks the config and turns it into a Region
+func (rc RegionConfig) region() (Region, error) {
+	var corners []Corner
+	switch {
+	case rc.Rectangle != nil && rc.Polygon != nil:
+		return Region{}, errors.New("a region must be either a rectangle or a polygon, not both")
+	case rc.Rectangle != nil:
+		if len(rc.Rectangle) != 4 {
+			return Region{}, errors.Errorf("rectangle must have four numbers that represent upper left and lower right corner "+
+				"of the region. Instead got a list of %v elements", len(rc.Rectangle))
+		}
+		r := rc.Rectangle
+		if r[0] >= r[2] || r[1] >= r[3] {
+			return Region{}, errors.Errorf("rectangle %v must have its upper left corner above and to the left of its lower right corner", r)
+		}
+		corners = []Corner{{r[0], r[1]}, {r[2], r[1]}, {r[2], r[3]}, {r[0], r[3]}}
+	case rc.Polygon != nil:
+		if len(rc.Polygon) < 3 {
+			return Region{}, errors.Errorf("polygon must have at least three corners, got %v", len(rc.Polygon))
+		}
+		for _, pt := range rc.Polygon {
+			if len(pt) != 2 {
+				return Region{}, errors.Errorf("each corner of a polygon must be an [x, y] pair, got %v", pt)
+			}
+			corners = append(corners, Corner{pt[0], pt[1]})
+		}
+	default:
+		return Region{}, errors.New("a region needs either a rectangle or a polygon")
+	}
+	if rc.Normalized {
+		for _, c := range corners {
+			if c.X < 0 || c.X > 1 || c.Y < 0 || c.Y > 1 {
+				return Region{}, errors.Errorf("corner (%v, %v) of a normalized region must be between 0 and 1", c.X, c.Y)
+			}
+		}
+	}
+	return Region{Corners: corners, Normalized: rc.Normalized}, nil
+}
+
+// parseRegions turns the configured regions into Regions
+func parseRegions(configs []RegionConfig, attribute string) ([]Region, error) {
+	regions := make([]Region, 0, len(configs))
+	for i, c := range configs {
+		r, err := c.region()
+		if err != nil {
+			return nil, errors.Wrapf(err, "%s %v", attribute, i)
+		}
+		regions = append(regions, r)
+	}
+	return regions, nil
+}
+
+// regionMask builds the mask from the excluded_region, excluded_regions, included_regions and max_excluded_overlap attributes
+func (cfg *Config) regionMask() (*RegionMask, error) {
+	if cfg.MaxExcludedOverlap < 0 || cfg.MaxExcludedOverlap >= 1 {
+		return nil, errors.New("max_excluded_overlap must be a number from 0 up to, but not including, 1")
+	}
+	excluded, err := parseRegions(cfg.ExcludedRegions, "excluded_regions")
+	if err != nil {
+		return nil, err
+	}
+	zone, err := parseExcludedRegion(cfg.ExcludedRegion)
+	if err != nil {
+		return nil, err
+	}
+	if zone != nil {
+		excluded = append(excluded, RectRegion(*zone))
+	}
+	included, err := parseRegions(cfg.IncludedRegions, "included_regions")
+	if err != nil {
+		return nil, err
+	}
+	return NewRegionMask(excluded, included, cfg.MaxExcludedOverlap), nil
+}
+
+// RegionMask decides which parts of the image the prefilter ignores. A pixel is masked out if it is in
+// any of the excluded regions, or if there are included regions and it is in none of them.
+type RegionMask struct {
+	Excluded []Region
+	Included []Region
+	// MaxMaskedFraction is how much of a patch may be masked out before the patch is skipped.
+	// At 0, a patch is skipped as soon as any of its pixels is masked out.
+	MaxMaskedFraction float64
+
+	mu           sync.Mutex
+	cachedBounds image.Rectangle
+	integral     []int32 // summed area table of the masked pixels of an image with cachedBounds
+}
+
+// NewRegionMask returns a mask of the regions, or nil if there is nothing to mask out. A mask without regions
+// is still returned when maxMaskedFraction is set, so regions added later are checked against it.
+func NewRegionMask(excluded, included []Region, maxMaskedFraction float64) *RegionMask {
+	if len(excluded) == 0 && len(included) == 0 && maxMaskedFraction == 0 {
+		return nil
+	}
+	return &RegionMask{Excluded: excluded, Included: included, MaxMaskedFraction: maxMaskedFraction}
+}
+
+// copyRegions returns a new mask of the same regions, with a cache of its own. Cameras of different
+// resolutions sharing one mask would keep replacing each other's cached integral.
+func (m *RegionMask) copyRegions() *RegionMask {
+	if m == nil {
+		return nil
+	}
+	return &RegionMask{Excluded: m.Excluded, Included: m.Included, MaxMaskedFraction: m.MaxMaskedFraction}
+}
+
+// checkBounds returns an error naming every pixel region that reaches outside of a frame with the given bounds.
+// Normalized regions always fit.
+func (m *RegionMask) checkBounds(bounds image.Rectangle) error {
+	if m == nil {
+		return nil
+	}
+	var outside []string
+	check := func(regions []Region, kind string) {
+		for i, r := range regions {
+			if r.Normalized {
+				continue
+			}
+			for _, c := range r.Corners {
+				if c.X < float64(bounds.Min.X) || c.X > float64(bounds.Max.X) || c.Y < float64(bounds.Min.Y) || c.Y > float64(bounds.Max.Y) {
+					outside = append(outside, fmt.Sprintf("%s region %v", kind, i))
+					break
+				}
+			}
+		}
+	}
+	check(m.Excluded, "excluded")
+	check(m.Included, "included")
+	if len(outside) == 0 {
+		return nil
+	}
+	return errors.Errorf("%s reach outside of the %vx%v image, the regions might be meant for a different camera resolution",
+		strings.Join(outside, ", "), bounds.Dx(), bounds.Dy())
+}
+
+// maskedFraction returns the fraction of the pixels of box that are masked out, in an image with the given bounds
+func (m *RegionMask) maskedFraction(bounds, box image.Rectangle) float64 {
+	if m == nil || (len(m.Excluded) == 0 && len(m.Included) == 0) {
+		return 0
+	}
+	box = box.Intersect(bounds)
+	if box.Empty() {
+		return 0
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.integral == nil || m.cachedBounds != bounds {
+		m.buildIntegral(bounds)
+	}
+	// the summed area table has an extra row and column of zeros at the top and left
+	w := bounds.Dx() + 1
+	x0, y0 := box.Min.X-bounds.Min.X, box.Min.Y-bounds.Min.Y
+	x1, y1 := box.Max.X-bounds.Min.X, box.Max.Y-bounds.Min.Y
+	count := m.integral[y1*w+x1] - m.integral[y0*w+x1] - m.integral[y1*w+x0] + m.integral[y0*w+x0]
+	return float64(count) / float64(box.Dx()*box.Dy())
+}
+
+// skip reports whether too much of the patch at box is masked out to score it
+func (m *RegionMask) skip(bounds, box image.Rectangle) bool {
+	if m == nil {
+		return false
+	}
+	return m.maskedFraction(bounds, box) > m.MaxMaskedFraction
+}
+
+// buildIntegral rasterizes the mask for an image with the given bounds. The regions don't change,
+// so this is only done again when the resolution of the camera changes, which also resolves the normalized regions.
+func (m *RegionMask) buildIntegral(bounds image.Rectangle) {
+	w, h := bounds.Dx(), bounds.Dy()
+	m.cachedBounds = bounds
+	m.integral = make([]int32, (w+1)*(h+1))
+	excluded := make([][]Corner, 0, len(m.Excluded))
+	for _, r := range m.Excluded {
+		excluded = append(excluded, r.inFrame(bounds))
+	}
+	included := make([][]Corner, 0, len(m.Included))
+	for _, r := range m.Included {
+		included = append(included, r.inFrame(bounds))
+	}
+	// a pixel is masked out if it is excluded, or if there are included regions and it is in none of them
+	masked := func(x, y int) bool {
+		for _, corners := range excluded {
+			if polygonContains(corners, x, y) {
+				return true
+			}
+		}
+		if len(included) == 0 {
+			return false
+		}
+		for _, corners := range included {
+			if polygonContains(corners, x, y) {
+				return false
+			}
+		}
+		return true
+	}
+	for y := 0; y < h; y++ {
+		var rowSum int32
+		for x := 0; x < w; x++ {
+			if masked(bounds.Min.X+x, bounds.Min.Y+y) {
+				rowSum++
+			}
+			m.integral[(y+1)*(w+1)+x+1] = m.integral[y*(w+1)+x+1] + rowSum
+		}
+	}
+}
@@ -0,0 +1,124 @@
+package oceanprefilter
+
+import (
+	"image"
+	"testing"
+
+	"go.viam.com/test"
+)
+
+func TestRegionMask(t *testing.T) {
+	bounds := image.Rect(0, 0, 100, 100)
+	// a triangle covering the lower left half of the image
+	triangle := Region{Corners: []Corner{{0, 0}, {100, 100}, {0, 100}}}
+	test.That(t, polygonContains(triangle.Corners, 10, 90), test.ShouldBeTrue)
+	test.That(t, polygonContains(triangle.Corners, 90, 10), test.ShouldBeFalse)
+	test.That(t, polygonContains(RectRegion(image.Rect(10, 10, 20, 20)).Corners, 10, 10), test.ShouldBeTrue)
+	test.That(t, polygonContains(RectRegion(image.Rect(10, 10, 20, 20)).Corners, 20, 20), test.ShouldBeFalse)
+
+	var noMask *RegionMask
+	test.That(t, noMask.skip(bounds, bounds), test.ShouldBeFalse)
+	test.That(t, NewRegionMask(nil, nil, 0), test.ShouldBeNil)
+
+	mask := NewRegionMask([]Region{triangle}, nil, 0)
+	test.That(t, mask.maskedFraction(bounds, bounds), test.ShouldAlmostEqual, 0.5, 0.01)
+	test.That(t, mask.maskedFraction(bounds, image.Rect(0, 50, 10, 100)), test.ShouldEqual, 1.0)
+	test.That(t, mask.maskedFraction(bounds, image.Rect(60, 0, 100, 40)), test.ShouldEqual, 0.0)
+	// any overlap skips a patch by default
+	test.That(t, mask.skip(bounds, image.Rect(40, 0, 100, 60)), test.ShouldBeTrue)
+	mask.MaxMaskedFraction = 0.25
+	test.That(t, mask.skip(bounds, image.Rect(40, 0, 100, 60)), test.ShouldBeFalse)
+	test.That(t, mask.skip(bounds, bounds), test.ShouldBeTrue)
+
+	// only the included regions are looked at, minus the excluded ones
+	mask = NewRegionMask([]Region{RectRegion(image.Rect(0, 0, 50, 10))}, []Region{RectRegion(image.Rect(0, 0, 50, 100))}, 0)
+	test.That(t, mask.maskedFraction(bounds, bounds), test.ShouldAlmostEqual, 0.55, 1e-9)
+	test.That(t, mask.skip(bounds, image.Rect(0, 20, 50, 100)), test.ShouldBeFalse)
+	test.That(t, mask.skip(bounds, image.Rect(0, 0, 50, 100)), test.ShouldBeTrue)
+	// a new resolution rebuilds the mask
+	test.That(t, mask.maskedFraction(image.Rect(0, 0, 200, 100), image.Rect(0, 0, 200, 100)), test.ShouldAlmostEqual, 0.775, 1e-9)
+
+	// patches are skipped by how much of them is masked out
+	img := MockImage(640, 480)
+	mast := NewRegionMask([]Region{RectRegion(image.Rect(300, 100, 340, 480))}, nil, 0)
+	patches, err := splitUpImageConst(img, mast, 100, 80, 200)
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, len(patches), test.ShouldEqual, 15) // the column of patches from x=200 to 400 is gone
+	mast.MaxMaskedFraction = 0.25
+	patches, err = splitUpImageConst(img, mast, 100, 80, 200)
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, len(patches), test.ShouldEqual, 20) // the mast only covers a fifth of those patches
+}
+
+func TestNormalizedRegions(t *testing.T) {
+	// the left half of the frame, whatever its size
+	mask := NewRegionMask([]Region{NormalizedRectRegion(0, 0, 0.5, 1)}, nil, 0)
+	for _, bounds := range []image.Rectangle{image.Rect(0, 0, 640, 480), image.Rect(0, 0, 1920, 1080), image.Rect(10, 20, 110, 70)} {
+		test.That(t, mask.maskedFraction(bounds, bounds), test.ShouldAlmostEqual, 0.5, 1e-9)
+		left := image.Rect(bounds.Min.X, bounds.Min.Y, bounds.Min.X+bounds.Dx()/2, bounds.Max.Y)
+		test.That(t, mask.maskedFraction(bounds, left), test.ShouldEqual, 1.0)
+		test.That(t, mask.checkBounds(bounds), test.ShouldBeNil)
+	}
+
+	// the same patches are skipped at every resolution
+	for _, size := range []image.Point{{640, 480}, {1280, 960}} {
+		img := MockImage(size.X, size.Y)
+		patches, err := splitUpImageConst(img, mask, 0, size.Y/4, size.X/4)
+		test.That(t, err, test.ShouldBeNil)
+		test.That(t, len(patches), test.ShouldEqual, 8)
+		for _, p := range patches {
+			test.That(t, p.box.Min.X, test.ShouldBeGreaterThanOrEqualTo, size.X/2)
+		}
+	}
+
+	// pixel regions can fall outside of a smaller frame
+	mask = NewRegionMask([]Region{RectRegion(image.Rect(600, 0, 700, 100)), NormalizedRectRegion(0, 0, 1, 1)},
+		[]Region{RectRegion(image.Rect(0, 0, 100, 100))}, 0)
+	test.That(t, mask.checkBounds(image.Rect(0, 0, 1280, 720)), test.ShouldBeNil)
+	err := mask.checkBounds(image.Rect(0, 0, 640, 480))
+	test.That(t, err, test.ShouldNotBeNil)
+	test.That(t, err.Error(), test.ShouldContainSubstring, "excluded region 0")
+	test.That(t, err.Error(), test.ShouldNotContainSubstring, "excluded region 1")
+	test.That(t, err.Error(), test.ShouldNotContainSubstring, "included")
+	var noMask *RegionMask
+	test.That(t, noMask.checkBounds(image.Rect(0, 0, 1, 1)), test.ShouldBeNil)
+}
+
+func TestRegionConfig(t *testing.T) {
+	cfg := &Config{
+		ExcludedRegion:  []int{0, 0, 10, 10},
+		ExcludedRegions: []RegionConfig{{Polygon: [][]float64{{0, 0}, {5, 0}, {0, 5}}}},
+		IncludedRegions: []RegionConfig{
+			{Rectangle: []float64{0, 0, 100, 100}},
+			{Rectangle: []float64{0.5, 0, 1, 0.25}, Normalized: true},
+		},
+	}
+	mask, err := cfg.regionMask()
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, mask.Excluded, test.ShouldResemble, []Region{
+		{Corners: []Corner{{0, 0}, {5, 0}, {0, 5}}},
+		RectRegion(image.Rect(0, 0, 10, 10)),
+	})
+	test.That(t, mask.Included, test.ShouldResemble, []Region{
+		RectRegion(image.Rect(0, 0, 100, 100)),
+		NormalizedRectRegion(0.5, 0, 1, 0.25),
+	})
+
+	mask, err = (&Config{}).regionMask()
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, mask, test.ShouldBeNil)
+
+	for _, bad := range []*Config{
+		{ExcludedRegion: []int{1, 2, 3}},
+		{ExcludedRegions: []RegionConfig{{}}},
+		{ExcludedRegions: []RegionConfig{{Rectangle: []float64{0, 0, 1, 1}, Polygon: [][]float64{{0, 0}, {1, 0}, {0, 1}}}}},
+		{ExcludedRegions: []RegionConfig{{Polygon: [][]float64{{0, 0}, {1, 0}}}}},
+		{IncludedRegions: []RegionConfig{{Polygon: [][]float64{{0, 0}, {1, 0}, {0}}}}},
+		{ExcludedRegions: []RegionConfig{{Rectangle: []float64{0, 0, 2, 1}, Normalized: true}}},
+		{ExcludedRegions: []RegionConfig{{Polygon: [][]float64{{0, 0}, {1, 0}, {0, -0.1}}, Normalized: true}}},
+		{MaxExcludedOverlap: 1},
+	} {
+		_, err = bad.regionMask()
+		test.That(t, err, test.ShouldNotBeNil)
+	}
+}
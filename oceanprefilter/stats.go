@@ -0,0 +1,121 @@
+package oceanprefilter
+
+import (
+	"sync"
+	"time"
+)
+
+// durationStats keeps the slowest, fastest and average time of a repeated step
+type durationStats struct {
+	count int
+	total time.Duration
+	min   time.Duration
+	max   time.Duration
+}
+
+func (ds *durationStats) add(d time.Duration) {
+	if ds.count == 0 || d < ds.min {
+		ds.min = d
+	}
+	if d > ds.max {
+		ds.max = d
+	}
+	ds.total += d
+	ds.count++
+}
+
+// toMap reports the times in milliseconds
+func (ds durationStats) toMap() map[string]interface{} {
+	mean := 0.0
+	if ds.count > 0 {
+		mean = toMillis(ds.total) / float64(ds.count)
+	}
+	return map[string]interface{}{
+		"min_ms":  toMillis(ds.min),
+		"max_ms":  toMillis(ds.max),
+		"mean_ms": mean,
+	}
+}
+
+func toMillis(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
+
+// runStats are the statistics of the background camera stream, shared with DoCommand
+type runStats struct {
+	mu              sync.Mutex
+	since           time.Time
+	framesProcessed int
+	framesTriggered int // frames the prefilter triggered on
+	framesRaised    int // frames the TRIGGER was raised for, after hold and confirmation
+	framesFailed    int // frames that couldn't be scored, such as frames without a visible horizon
+	inference       durationStats
+	streamNext      durationStats
+}
+
+func newRunStats() *runStats {
+	return &runStats{since: time.Now()}
+}
+
+// addFrame records one frame of the background stream, whether the prefilter triggered on it,
+// and whether the TRIGGER that is reported was raised for it
+func (rs *runStats) addFrame(streamNext, inference time.Duration, triggered, raised bool) {
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+	rs.framesProcessed++
+	if triggered {
+		rs.framesTriggered++
+	}
+	if raised {
+		rs.framesRaised++
+	}
+	rs.streamNext.add(streamNext)
+	rs.inference.add(inference)
+}
+
+// addFailedFrame records a frame of the background stream that couldn't be scored, and whether the TRIGGER
+// that is reported was still raised for it
+func (rs *runStats) addFailedFrame(streamNext, inference time.Duration, raised bool) {
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+	rs.framesProcessed++
+	rs.framesFailed++
+	if raised {
+		rs.framesRaised++
+	}
+	rs.streamNext.add(streamNext)
+	rs.inference.add(inference)
+}
+
+func (rs *runStats) reset() {
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+	rs.since = time.Now()
+	rs.framesProcessed = 0
+	rs.framesTriggered = 0
+	rs.framesRaised = 0
+	rs.framesFailed = 0
+	rs.inference = durationStats{}
+	rs.streamNext = durationStats{}
+}
+
+// toMap returns the statistics in the form DoCommand responds with. The trigger rate is of the raised TRIGGER,
+// which is what callers of the service see.
+func (rs *runStats) toMap() map[string]interface{} {
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+	triggerRate := 0.0
+	if rs.framesProcessed > 0 {
+		triggerRate = float64(rs.framesRaised) / float64(rs.framesProcessed)
+	}
+	return map[string]interface{}{
+		"since":            rs.since.Format(time.RFC3339),
+		"frames_processed": rs.framesProcessed,
+		"frames_triggered": rs.framesTriggered,
+		"frames_raised":    rs.framesRaised,
+		"frames_failed":    rs.framesFailed,
+		"trigger_rate":     triggerRate,
+		"inference":        rs.inference.toMap(),
+		"stream_next":      rs.streamNext.toMap(),
+	}
+}
@@ -0,0 +1,49 @@
+"""Writes the models saved with XGBoost's save_model that TestSavedModels loads.
+
+The models are not committed, they are only written in CI by `make test-saved-models`, which pins the
+versions of xgboost and numpy. To run the test locally, run this from this folder with them installed:
+
+    python3 make_saved_models.py
+
+For each objective it trains a small model on 800 features, the features of a 200x80 patch pooled with a
+10x2 window, and writes it with save_model as JSON and as UBJSON, the predictions of XGBoost itself for a few
+rows, and for multi:softprob the JSON dump of the same booster.
+"""
+import json
+
+import numpy as np
+import xgboost as xgb
+
+NUM_FEATURES = 800
+NUM_ROWS = 400
+NUM_CHECKED = 8
+
+rng = np.random.default_rng(2288)
+features = rng.random((NUM_ROWS, NUM_FEATURES), dtype=np.float32)
+# interesting patches are brighter in the middle rows of the patch
+labels = (features[:, 300:500].mean(axis=1) + 0.05 * rng.standard_normal(NUM_ROWS) > 0.5).astype(int)
+# partly transparent patches have missing features
+features[rng.random(features.shape) < 0.05] = np.nan
+checked = features[:NUM_CHECKED]
+
+objectives = {
+    "softprob": {"objective": "multi:softprob", "num_class": 2},
+    "logistic": {"objective": "binary:logistic"},
+}
+for name, params in objectives.items():
+    # a fixed base score, so the dump, which has none, scores the same as the saved model
+    params.update({"max_depth": 3, "eta": 0.3, "base_score": 0.5, "seed": 0})
+    booster = xgb.train(params, xgb.DMatrix(features, label=labels, missing=np.nan), num_boost_round=5)
+    booster.save_model(f"saved_{name}.json")
+    booster.save_model(f"saved_{name}.ubj")
+    if "num_class" in params:
+        booster.dump_model(f"saved_{name}_dump.json", dump_format="json")
+    predictions = booster.predict(xgb.DMatrix(checked, missing=np.nan))
+    interesting = predictions[:, 1] if predictions.ndim == 2 else predictions
+    with open(f"saved_{name}_predictions.json", "w") as f:
+        json.dump({
+            "xgboost_version": xgb.__version__,
+            "features": [[None if np.isnan(v) else float(v) for v in row] for row in checked],
+            "interesting": [float(p) for p in interesting],
+        }, f)
+        f.write("\n")
@@ -0,0 +1,126 @@
+package oceanprefilter
+
+import (
+	"image"
+	"math"
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultHorizonHold is how long the last good horizon keeps being used while it can't be found
+	DefaultHorizonHold = 2 * time.Second
+	// DefaultHorizonMaxJump is how far, as a fraction of the image height, the horizon may move from the
+	// tracked one between frames before the detection is thrown out as an outlier
+	DefaultHorizonMaxJump = 0.1
+	// DefaultHorizonSmoothing is how much of each new detection goes into the tracked horizon
+	DefaultHorizonSmoothing = 0.5
+	// horizonMaxOutliers is how many outliers in a row it takes to believe the horizon really moved,
+	// for example because the camera was pointed somewhere else
+	horizonMaxOutliers = 5
+)
+
+// horizonTracker follows the horizon of a camera stream from frame to frame with an alpha-beta filter
+// on the height of the horizon in the middle of the image and its slope
+type horizonTracker struct {
+	mu      sync.Mutex
+	now     func() time.Time
+	hold    time.Duration
+	maxJump float64
+	alpha   float64
+	beta    float64
+
+	bounds      image.Rectangle
+	initialized bool
+	offset      float64 // height of the horizon in the middle of the image
+	slope       float64
+	offsetRate  float64 // per second
+	slopeRate   float64 // per second
+	lastUpdate  time.Time
+	outliers    int
+}
+
+func newHorizonTracker(hold time.Duration, maxJump, smoothing float64) *horizonTracker {
+	return &horizonTracker{
+		now:     time.Now,
+		hold:    hold,
+		maxJump: maxJump,
+		alpha:   smoothing,
+		beta:    smoothing * smoothing / (2 - smoothing),
+	}
+}
+
+// track folds the horizon found in the latest frame into the tracked one, and returns the horizon to use for the frame.
+// A detection that jumps too far from the tracked horizon is ignored, and if there is no usable detection,
+// the tracked horizon is used until it is older than the hold time. Horizons predicted from a movement sensor
+// already follow the motion of the boat, so they are passed through as they are.
+func (ht *horizonTracker) track(bounds image.Rectangle, detected Horizon, detectErr error) (Horizon, error) {
+	if detectErr == nil && detected.Predicted {
+		return detected, nil
+	}
+	ht.mu.Lock()
+	defer ht.mu.Unlock()
+	now := ht.now()
+	if bounds != ht.bounds {
+		ht.bounds = bounds
+		ht.initialized = false
+	}
+	centerX := float64(bounds.Min.X) + float64(bounds.Dx()-1)/2
+	var offset, slope float64
+	if detectErr == nil {
+		slope = (detected.Y1 - detected.Y0) / (detected.X1 - detected.X0)
+		offset = detected.YAt(centerX)
+	}
+
+	if ht.initialized {
+		dt := now.Sub(ht.lastUpdate).Seconds()
+		predictedOffset := ht.offset + ht.offsetRate*dt
+		predictedSlope := ht.slope + ht.slopeRate*dt
+		if detectErr == nil {
+			// how far the detection is from the prediction, at the edges of the image
+			halfWidth := float64(bounds.Dx()-1) / 2
+			jump := math.Abs(offset-predictedOffset) + math.Abs(slope-predictedSlope)*halfWidth
+			if jump <= ht.maxJump*float64(bounds.Dy()) {
+				offsetResidual, slopeResidual := offset-predictedOffset, slope-predictedSlope
+				ht.offset = predictedOffset + ht.alpha*offsetResidual
+				ht.slope = predictedSlope + ht.alpha*slopeResidual
+				if dt > 0 {
+					ht.offsetRate += ht.beta * offsetResidual / dt
+					ht.slopeRate += ht.beta * slopeResidual / dt
+				}
+				ht.lastUpdate = now
+				ht.outliers = 0
+				return ht.horizon(detected.Confidence), nil
+			}
+			ht.outliers++
+		}
+		if ht.outliers < horizonMaxOutliers && now.Sub(ht.lastUpdate) <= ht.hold {
+			// keep the last good horizon, and stop moving it along, as nothing in the frame backs that up
+			ht.offsetRate, ht.slopeRate = 0, 0
+			return ht.horizon(0), nil
+		}
+	}
+	if detectErr != nil {
+		ht.initialized = false
+		return Horizon{}, detectErr
+	}
+	ht.initialized = true
+	ht.offset, ht.slope = offset, slope
+	ht.offsetRate, ht.slopeRate = 0, 0
+	ht.lastUpdate = now
+	ht.outliers = 0
+	return ht.horizon(detected.Confidence), nil
+}
+
+// horizon returns the tracked horizon
+func (ht *horizonTracker) horizon(confidence float64) Horizon {
+	x0, x1 := float64(ht.bounds.Min.X), float64(ht.bounds.Max.X-1)
+	centerX := (x0 + x1) / 2
+	return Horizon{
+		X0:         x0,
+		Y0:         ht.offset + ht.slope*(x0-centerX),
+		X1:         x1,
+		Y1:         ht.offset + ht.slope*(x1-centerX),
+		Confidence: confidence,
+	}
+}
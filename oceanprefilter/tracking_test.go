@@ -0,0 +1,81 @@
+package oceanprefilter
+
+import (
+	"errors"
+	"image"
+	"testing"
+	"time"
+
+	"go.viam.com/test"
+)
+
+func TestHorizonTracker(t *testing.T) {
+	bounds := image.Rect(0, 0, 641, 480)
+	clock := time.Unix(0, 0)
+	tracker := newHorizonTracker(2*time.Second, DefaultHorizonMaxJump, 0.5)
+	tracker.now = func() time.Time { return clock }
+	level := func(y float64) Horizon { return Horizon{X0: 0, Y0: y, X1: 640, Y1: y, Confidence: 1} }
+	noHorizon := errors.New("could not find horizon")
+
+	// the first detection is taken as it is
+	horizon, err := tracker.track(bounds, level(200), nil)
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, horizon.Y0, test.ShouldAlmostEqual, 200, 1e-9)
+
+	// later ones are smoothed
+	clock = clock.Add(100 * time.Millisecond)
+	horizon, err = tracker.track(bounds, level(210), nil)
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, horizon.Y0, test.ShouldAlmostEqual, 205, 1e-9)
+	test.That(t, horizon.Confidence, test.ShouldEqual, 1.0)
+
+	// an outlier is ignored, and so is a frame without a horizon
+	clock = clock.Add(100 * time.Millisecond)
+	horizon, err = tracker.track(bounds, level(400), nil)
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, horizon.Y0, test.ShouldAlmostEqual, 205, 1e-9)
+	test.That(t, horizon.Confidence, test.ShouldEqual, 0.0)
+	clock = clock.Add(100 * time.Millisecond)
+	horizon, err = tracker.track(bounds, Horizon{}, noHorizon)
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, horizon.Y0, test.ShouldAlmostEqual, 205, 1e-9)
+
+	// a tilt is tracked as well
+	clock = clock.Add(100 * time.Millisecond)
+	horizon, err = tracker.track(bounds, Horizon{X0: 0, Y0: 195, X1: 640, Y1: 215, Confidence: 0.9}, nil)
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, horizon.YAt(320), test.ShouldAlmostEqual, 205, 1e-9)
+	test.That(t, horizon.Y1-horizon.Y0, test.ShouldAlmostEqual, 10, 1e-9)
+	test.That(t, horizon.Confidence, test.ShouldEqual, 0.9)
+
+	// once the last good horizon is older than the hold time, a missing horizon is an error again
+	clock = clock.Add(1900 * time.Millisecond)
+	_, err = tracker.track(bounds, Horizon{}, noHorizon)
+	test.That(t, err, test.ShouldBeNil)
+	clock = clock.Add(200 * time.Millisecond)
+	_, err = tracker.track(bounds, Horizon{}, noHorizon)
+	test.That(t, err, test.ShouldEqual, noHorizon)
+
+	// and the next detection starts the tracking over
+	clock = clock.Add(100 * time.Millisecond)
+	horizon, err = tracker.track(bounds, level(300), nil)
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, horizon.Y0, test.ShouldAlmostEqual, 300, 1e-9)
+
+	// a horizon that stays where it moved to is believed after a few frames
+	for i := 0; i < horizonMaxOutliers; i++ {
+		clock = clock.Add(100 * time.Millisecond)
+		horizon, err = tracker.track(bounds, level(100), nil)
+		test.That(t, err, test.ShouldBeNil)
+	}
+	test.That(t, horizon.Y0, test.ShouldAlmostEqual, 100, 1e-9)
+
+	// a new resolution starts over too, and predicted horizons pass straight through
+	horizon, err = tracker.track(image.Rect(0, 0, 1280, 720), Horizon{X0: 0, Y0: 360, X1: 1279, Y1: 360}, nil)
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, horizon.Y0, test.ShouldAlmostEqual, 360, 1e-9)
+	predicted := Horizon{X0: 0, Y0: 600, X1: 1279, Y1: 650, Predicted: true}
+	horizon, err = tracker.track(image.Rect(0, 0, 1280, 720), predicted, nil)
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, horizon, test.ShouldResemble, predicted)
+}
@@ -0,0 +1,196 @@
+package oceanprefilter
+
+import (
+	"math"
+
+	"github.com/chewxy/math32"
+	"github.com/pkg/errors"
+	"github.com/viamrobotics/ocean-prefilter/internal/xgbdump"
+)
+
+// maxExpMargin is a margin well within the ±88 past which the exponential of a float32 overflows or underflows
+const maxExpMargin = 64
+
+// treeNode is a node of a tree of an XGBoost model. The children are indexes into the nodes of the whole model.
+type treeNode struct {
+	feature   int32 // -1 for a leaf
+	threshold float32
+	yes       int32 // taken if the feature is below the threshold
+	no        int32
+	missing   int32 // taken if the feature is missing, a NaN in the feature vector
+	leaf      float32
+}
+
+// XGBoostModel is a multi class XGBoost tree ensemble that scores dense feature vectors
+type XGBoostModel struct {
+	nodes       []treeNode
+	roots       []int32   // the root of every tree
+	classes     []int32   // the class every tree adds to
+	base        []float32 // the score every class starts at, all 0 if nil
+	numClasses  int
+	numFeatures int
+	// trainedFeatures is the number of features the model was trained on, 0 if the model doesn't say
+	trainedFeatures int
+	// compiled is the model compiled to Go by xgbgen, used for vectors of at least compiledFeatures features
+	compiled         func(features []float32) [modelNumClasses]float32
+	compiledFeatures int
+}
+
+// NumClasses returns the number of classes the model scores
+func (m *XGBoostModel) NumClasses() int {
+	return m.numClasses
+}
+
+// NumFeatures returns the length of the feature vectors the model scores
+func (m *XGBoostModel) NumFeatures() int {
+	return m.numFeatures
+}
+
+// newFeatures returns a feature vector the model can score, with every feature missing
+func (m *XGBoostModel) newFeatures() []float32 {
+	features := make([]float32, m.numFeatures)
+	for i := range features {
+		features[i] = float32(math.NaN())
+	}
+	return features
+}
+
+// buildXGBoostModel turns the trees of an XGBoost JSON dump into a model for vectors of nFeatures features
+func buildXGBoostModel(trees []*xgbdump.Node, numClasses, nFeatures int) (*XGBoostModel, error) {
+	m := &XGBoostModel{numClasses: numClasses, numFeatures: nFeatures}
+	for i, root := range trees {
+		if err := m.addTree(root); err != nil {
+			return nil, errors.Wrapf(err, "error in tree %v of model", i)
+		}
+		// the trees of a dump take turns adding to each class
+		m.classes = append(m.classes, int32(i%numClasses))
+	}
+	return m, nil
+}
+
+// addTree appends the nodes of one tree, placed by their node id after the nodes of the trees before it
+func (m *XGBoostModel) addTree(root *xgbdump.Node) error {
+	byID := map[int]*xgbdump.Node{}
+	maxID := 0
+	stack := []*xgbdump.Node{root}
+	for len(stack) > 0 {
+		node := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		if node == nil {
+			return errors.New("tree has an empty node")
+		}
+		if node.NodeID < 0 {
+			return errors.Errorf("negative node id %v", node.NodeID)
+		}
+		if _, ok := byID[node.NodeID]; ok {
+			return errors.Errorf("node id %v is used more than once", node.NodeID)
+		}
+		byID[node.NodeID] = node
+		if node.NodeID > maxID {
+			maxID = node.NodeID
+		}
+		stack = append(stack, node.Children...)
+	}
+	base := int32(len(m.nodes))
+	m.roots = append(m.roots, base+int32(root.NodeID))
+	nodes := make([]treeNode, maxID+1)
+	for id := range nodes {
+		node, ok := byID[id]
+		if !ok {
+			continue // never reached from the root
+		}
+		if len(node.Children) == 0 {
+			nodes[id] = treeNode{feature: -1, leaf: node.Leaf}
+			continue
+		}
+		// following yes, no and missing must always lead further down the tree
+		children := map[int]bool{}
+		for _, child := range node.Children {
+			children[child.NodeID] = true
+		}
+		if !children[node.Yes] || !children[node.No] || (node.Missing != node.Yes && node.Missing != node.No) {
+			return errors.Errorf("node %v doesn't point at its own children", id)
+		}
+		feature, err := xgbdump.SplitFeature(node.Split)
+		if err != nil {
+			return err
+		}
+		nodes[id] = treeNode{
+			feature:   int32(feature),
+			threshold: node.SplitCondition,
+			yes:       base + int32(node.Yes),
+			no:        base + int32(node.No),
+			missing:   base + int32(node.Missing),
+		}
+	}
+	m.nodes = append(m.nodes, nodes...)
+	return nil
+}
+
+// rawScores adds up the leaves the features end up in, per class, in the order of the trees
+func (m *XGBoostModel) rawScores(features []float32, scores []float32) {
+	for c := range scores {
+		scores[c] = 0
+	}
+	copy(scores, m.base)
+	if m.compiled != nil && len(features) >= m.compiledFeatures {
+		compiled := m.compiled(features)
+		for c, v := range compiled {
+			scores[c] += v
+		}
+		return
+	}
+	for k, root := range m.roots {
+		idx := root
+		for {
+			node := &m.nodes[idx]
+			if node.feature < 0 {
+				scores[m.classes[k]] += node.leaf
+				break
+			}
+			v := float32(math.NaN())
+			if int(node.feature) < len(features) {
+				v = features[node.feature]
+			}
+			switch {
+			case v != v:
+				idx = node.missing
+			case v >= node.threshold:
+				idx = node.no
+			default:
+				idx = node.yes
+			}
+		}
+	}
+}
+
+// Probability returns the softmax probability of the class for the features
+func (m *XGBoostModel) Probability(features []float32, class int) (float64, error) {
+	if class < 0 || class >= m.numClasses {
+		return 0, errors.Errorf("model has no class %v", class)
+	}
+	var buf [modelNumClasses]float32
+	scores := buf[:]
+	if m.numClasses != modelNumClasses {
+		scores = make([]float32, m.numClasses)
+	}
+	m.rawScores(features, scores)
+	// the largest score is taken off every score once the exponential of it would overflow or underflow,
+	// smaller scores are left alone so they give exactly what xgboost-go gives
+	top := scores[0]
+	for _, v := range scores[1:] {
+		top = max(top, v)
+	}
+	if top < maxExpMargin && top > -maxExpMargin {
+		top = 0
+	}
+	var sum float32
+	for c, v := range scores {
+		scores[c] = math32.Exp(v - top)
+		sum += scores[c]
+	}
+	if sum == 0 {
+		return float64(scores[class]), nil
+	}
+	return float64(scores[class] * (1.0 / sum)), nil
+}
@@ -0,0 +1,225 @@
+package oceanprefilter
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"image"
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+
+	xgb "github.com/Elvenson/xgboost-go"
+	"github.com/Elvenson/xgboost-go/activation"
+	"github.com/Elvenson/xgboost-go/mat"
+	"go.viam.com/test"
+)
+
+// sparseFeatures returns the features as the one row sparse matrix the xgboost-go ensemble scores, leaving out missing ones
+func sparseFeatures(features []float32) mat.SparseMatrix {
+	row := mat.SparseVector{}
+	for k, v := range features {
+		if !math.IsNaN(float64(v)) {
+			row[k] = v
+		}
+	}
+	return mat.SparseMatrix{Vectors: []mat.SparseVector{row}}
+}
+
+func TestXGBoostModelParity(t *testing.T) {
+	model, err := loadModelFromBytes(modelbytes, numFeatures(defaultPatchSize, defaultPoolWindow))
+	test.That(t, err, test.ShouldBeNil)
+	ensemble, err := xgb.LoadXGBoostFromJSONBytes(modelbytes, "", modelNumClasses, 8, &activation.Softmax{})
+	test.That(t, err, test.ShouldBeNil)
+
+	check := func(features []float32) {
+		probs, err := ensemble.PredictProba(sparseFeatures(features))
+		test.That(t, err, test.ShouldBeNil)
+		for class := 0; class < modelNumClasses; class++ {
+			prob, err := model.Probability(features, class)
+			test.That(t, err, test.ShouldBeNil)
+			test.That(t, prob, test.ShouldEqual, float64((*probs.Vectors[0])[class]))
+		}
+	}
+
+	// every patch of a frame
+	frame := loadFrame(t, 1280, 720)
+	for _, kind := range []string{"rgba", "ycbcr"} {
+		patches, err := splitUpImageConst(frameAs(frame, kind), nil, 200, 80, 200)
+		test.That(t, err, test.ShouldBeNil)
+		features := model.newFeatures()
+		for _, p := range patches {
+			avgPool(p.img, defaultPoolWindow, features)
+			check(features)
+		}
+	}
+
+	// made up features, some of them missing
+	features := model.newFeatures()
+	for i := 0; i < 200; i++ {
+		for k := range features {
+			features[k] = float32((k*7919+i*104729)%1000) / 1000
+			if (k+i)%13 == 0 {
+				features[k] = float32(math.NaN())
+			}
+		}
+		check(features)
+	}
+
+	_, err = model.Probability(features, modelNumClasses)
+	test.That(t, err, test.ShouldNotBeNil)
+
+	// yes and no have to be children of the node
+	loop := `{ "nodeid": 0, "split": "f1", "split_condition": 1.0, "yes": 0, "no": 2, "missing": 2, "children": [
+		{ "nodeid": 1, "leaf": 0.5 }, { "nodeid": 2, "leaf": -0.5 } ]}`
+	_, err = loadModelFromBytes([]byte("["+loop+","+loop+"]"), 800)
+	test.That(t, err, test.ShouldNotBeNil)
+}
+
+func BenchmarkPatchScoring(b *testing.B) {
+	model, err := loadModelFromBytes(modelbytes, numFeatures(defaultPatchSize, defaultPoolWindow))
+	test.That(b, err, test.ShouldBeNil)
+	ensemble, err := xgb.LoadXGBoostFromJSONBytes(modelbytes, "", modelNumClasses, 8, &activation.Softmax{})
+	test.That(b, err, test.ShouldBeNil)
+	patches, err := splitUpImageConst(loadFrame(b, 640, 480), nil, 200, 80, 200)
+	test.That(b, err, test.ShouldBeNil)
+	patch := patches[0].img
+	features := model.newFeatures()
+
+	avgPool(patch, defaultPoolWindow, features)
+
+	b.Run("sparse", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			if _, err := ensemble.PredictProba(sparseFeatures(features)); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+	interpreted := *model
+	interpreted.compiled = nil
+	for name, m := range map[string]*XGBoostModel{"dense": &interpreted, "compiled": model} {
+		m := m
+		b.Run(name, func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				if _, err := m.Probability(features, interestingClass); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func TestCompiledModel(t *testing.T) {
+	// the generated code is of the embedded model, run go generate after changing it
+	digest := sha256.Sum256(modelbytes)
+	test.That(t, hex.EncodeToString(digest[:]), test.ShouldEqual, embeddedModelDigest)
+
+	model, err := loadModelFromBytes(modelbytes, numFeatures(defaultPatchSize, defaultPoolWindow))
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, model.compiled, test.ShouldNotBeNil)
+	ensemble, err := xgb.LoadXGBoostFromJSONBytes(modelbytes, "", modelNumClasses, 8, &activation.Softmax{})
+	test.That(t, err, test.ShouldBeNil)
+	interpreted := *model
+	interpreted.compiled = nil
+
+	files, err := os.ReadDir("test_data")
+	test.That(t, err, test.ShouldBeNil)
+	checked := 0
+	for _, file := range files {
+		f, err := os.Open(filepath.Join("test_data", file.Name()))
+		test.That(t, err, test.ShouldBeNil)
+		img, _, err := image.Decode(f)
+		f.Close()
+		if err != nil {
+			continue // not an image
+		}
+		// every patch, at a few of the water lines
+		for _, yValue := range []int{0, 100, 230} {
+			patches, err := splitUpImageConst(img, nil, yValue, 80, 200)
+			test.That(t, err, test.ShouldBeNil)
+			features := model.newFeatures()
+			for _, p := range patches {
+				avgPool(p.img, defaultPoolWindow, features)
+				probs, err := ensemble.PredictProba(sparseFeatures(features))
+				test.That(t, err, test.ShouldBeNil)
+				for class := 0; class < modelNumClasses; class++ {
+					compiled, err := model.Probability(features, class)
+					test.That(t, err, test.ShouldBeNil)
+					test.That(t, compiled, test.ShouldEqual, float64((*probs.Vectors[0])[class]))
+					prob, err := interpreted.Probability(features, class)
+					test.That(t, err, test.ShouldBeNil)
+					test.That(t, compiled, test.ShouldEqual, prob)
+				}
+				checked++
+			}
+		}
+	}
+	test.That(t, checked, test.ShouldBeGreaterThan, 0)
+
+	// missing features take the same branches
+	features := model.newFeatures()
+	compiled, err := model.Probability(features, interestingClass)
+	test.That(t, err, test.ShouldBeNil)
+	prob, err := interpreted.Probability(features, interestingClass)
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, compiled, test.ShouldEqual, prob)
+
+	// the compiled code starts from the base score like the trees do
+	withBase, withBaseInterpreted := *model, interpreted
+	withBase.base = []float32{0.5, -0.25}
+	withBaseInterpreted.base = withBase.base
+	compiled, err = withBase.Probability(features, interestingClass)
+	test.That(t, err, test.ShouldBeNil)
+	prob, err = withBaseInterpreted.Probability(features, interestingClass)
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, compiled, test.ShouldAlmostEqual, prob, 1e-6)
+	unbiased, err := model.Probability(features, interestingClass)
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, compiled, test.ShouldBeLessThan, unbiased)
+
+	// a feature vector too short for the compiled code is scored by the trees
+	_, err = model.Probability(features[:10], interestingClass)
+	test.That(t, err, test.ShouldBeNil)
+
+	// any other model is interpreted
+	leaf := `{ "nodeid": 0, "split": "f1", "split_condition": 1.0, "yes": 1, "no": 2, "missing": 2, "children": [
+		{ "nodeid": 1, "leaf": 0.5 }, { "nodeid": 2, "leaf": -0.5 } ]}`
+	other, err := loadModelFromBytes([]byte("["+leaf+","+leaf+"]"), 800)
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, other.compiled, test.ShouldBeNil)
+}
+
+func TestProbabilityLargeMargins(t *testing.T) {
+	// margins far past where the exponential of a float32 overflows or underflows still give a probability
+	m := &XGBoostModel{numClasses: modelNumClasses, base: []float32{0, 200}}
+	prob, err := m.Probability(nil, interestingClass)
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, prob, test.ShouldEqual, 1)
+	prob, err = m.Probability(nil, 0)
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, prob, test.ShouldEqual, 0)
+
+	m.base = []float32{-151, -150}
+	prob, err = m.Probability(nil, interestingClass)
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, prob, test.ShouldAlmostEqual, 1/(1+math.Exp(-1)), 1e-6)
+
+	m.base = []float32{150, 151}
+	prob, err = m.Probability(nil, interestingClass)
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, prob, test.ShouldAlmostEqual, 1/(1+math.Exp(-1)), 1e-6)
+}
+
+func TestAddTreeBadNodeIDs(t *testing.T) {
+	negative := `{ "nodeid": 0, "split": "f1", "split_condition": 1.0, "yes": -1, "no": 2, "missing": 2, "children": [
+		{ "nodeid": -1, "leaf": 0.5 }, { "nodeid": 2, "leaf": -0.5 } ]}`
+	_, err := loadModelFromBytes([]byte("["+negative+","+negative+"]"), 800)
+	test.That(t, err, test.ShouldNotBeNil)
+	test.That(t, err.Error(), test.ShouldContainSubstring, "negative node id -1")
+
+	twice := `{ "nodeid": 0, "split": "f1", "split_condition": 1.0, "yes": 1, "no": 1, "missing": 1, "children": [
+		{ "nodeid": 1, "leaf": 0.5 }, { "nodeid": 1, "leaf": -0.5 } ]}`
+	_, err = loadModelFromBytes([]byte("["+twice+","+twice+"]"), 800)
+	test.That(t, err, test.ShouldNotBeNil)
+	test.That(t, err.Error(), test.ShouldContainSubstring, "node id 1 is used more than once")
+}
@@ -0,0 +1,74 @@
+package oceanprefilter
+
+import (
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// triggerState decides when the TRIGGER flag of the background stream is raised and cleared.
+// The flag is raised when a frame triggers and at least confirmFrames of the last confirmWindow frames did.
+// It is cleared once no frame has been confirmed for longer than the hold time, and no frame has triggered at all for longer than the quiet period.
+type triggerState struct {
+	confirmFrames int
+	confirmWindow int
+	hold          time.Duration
+	quietPeriod   time.Duration
+
+	recent        []bool // whether each of the last confirmWindow frames triggered, as a ring
+	next          int
+	raised        bool
+	lastConfirmed time.Time
+	lastTriggered time.Time
+}
+
+func newTriggerState(confirmFrames, confirmWindow int, hold, quietPeriod time.Duration) *triggerState {
+	return &triggerState{
+		confirmFrames: confirmFrames,
+		confirmWindow: confirmWindow,
+		hold:          hold,
+		quietPeriod:   quietPeriod,
+		recent:        make([]bool, confirmWindow),
+	}
+}
+
+// checkTriggerConfirmation returns the number of frames and the window to confirm a trigger with, defaulting to 1 of 1
+func checkTriggerConfirmation(frames, window int) (int, int, error) {
+	if frames < 0 || window < 0 {
+		return 0, 0, errors.New("trigger_confirm_frames and trigger_confirm_window must be non-negative numbers")
+	}
+	if frames == 0 {
+		frames = 1
+	}
+	if window == 0 {
+		window = frames
+	}
+	if frames > window {
+		return 0, 0, errors.Errorf("trigger_confirm_frames (%v) can't be more than trigger_confirm_window (%v)", frames, window)
+	}
+	return frames, window, nil
+}
+
+// update adds the result of the latest frame and returns whether the trigger is raised
+func (ts *triggerState) update(now time.Time, triggered bool) bool {
+	ts.recent[ts.next] = triggered
+	ts.next = (ts.next + 1) % len(ts.recent)
+	if triggered {
+		ts.lastTriggered = now
+		count := 0
+		for _, t := range ts.recent {
+			if t {
+				count++
+			}
+		}
+		if count >= ts.confirmFrames {
+			ts.raised = true
+			ts.lastConfirmed = now
+			return true
+		}
+	}
+	if ts.raised && now.Sub(ts.lastConfirmed) > ts.hold && now.Sub(ts.lastTriggered) > ts.quietPeriod {
+		ts.raised = false
+	}
+	return ts.raised
+}
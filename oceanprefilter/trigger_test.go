@@ -0,0 +1,55 @@
+package oceanprefilter
+
+import (
+	"testing"
+	"time"
+
+	"go.viam.com/test"
+)
+
+func TestTriggerState(t *testing.T) {
+	start := time.Unix(0, 0)
+	at := func(frame int) time.Time { return start.Add(time.Duration(frame) * 100 * time.Millisecond) }
+
+	// without confirmation, a single frame raises the trigger, and it is held for the hold time
+	state := newTriggerState(1, 1, 400*time.Millisecond, 0)
+	test.That(t, state.update(at(0), false), test.ShouldBeFalse)
+	test.That(t, state.update(at(1), true), test.ShouldBeTrue)
+	for frame := 2; frame <= 5; frame++ {
+		test.That(t, state.update(at(frame), false), test.ShouldBeTrue)
+	}
+	test.That(t, state.update(at(6), false), test.ShouldBeFalse)
+
+	// 2 of the last 3 frames have to trigger, so a single noisy frame doesn't
+	state = newTriggerState(2, 3, 0, 0)
+	test.That(t, state.update(at(0), true), test.ShouldBeFalse)
+	test.That(t, state.update(at(1), false), test.ShouldBeFalse)
+	test.That(t, state.update(at(2), false), test.ShouldBeFalse)
+	test.That(t, state.update(at(3), true), test.ShouldBeFalse)
+	test.That(t, state.update(at(4), false), test.ShouldBeFalse)
+	test.That(t, state.update(at(5), true), test.ShouldBeTrue)
+	test.That(t, state.update(at(6), false), test.ShouldBeFalse)
+
+	// the quiet period keeps the trigger up while frames keep triggering, even if they aren't confirmed
+	state = newTriggerState(2, 2, 0, 300*time.Millisecond)
+	test.That(t, state.update(at(0), true), test.ShouldBeFalse)
+	test.That(t, state.update(at(1), true), test.ShouldBeTrue)
+	test.That(t, state.update(at(2), false), test.ShouldBeTrue)
+	test.That(t, state.update(at(3), true), test.ShouldBeTrue)
+	test.That(t, state.update(at(4), false), test.ShouldBeTrue)
+	test.That(t, state.update(at(6), false), test.ShouldBeTrue)
+	test.That(t, state.update(at(7), false), test.ShouldBeFalse)
+
+	frames, window, err := checkTriggerConfirmation(0, 0)
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, frames, test.ShouldEqual, 1)
+	test.That(t, window, test.ShouldEqual, 1)
+	frames, window, err = checkTriggerConfirmation(3, 0)
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, frames, test.ShouldEqual, 3)
+	test.That(t, window, test.ShouldEqual, 3)
+	_, _, err = checkTriggerConfirmation(3, 2)
+	test.That(t, err, test.ShouldNotBeNil)
+	_, _, err = checkTriggerConfirmation(-1, 2)
+	test.That(t, err, test.ShouldNotBeNil)
+}
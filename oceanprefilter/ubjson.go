@@ -0,0 +1,248 @@
+package oceanprefilter
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"math"
+
+	"github.com/pkg/errors"
+)
+
+// ubjsonMaxDepth is how deeply containers may be nested, which is far more than a model needs
+const ubjsonMaxDepth = 64
+
+// ubjsonDecoder reads Universal Binary JSON, the binary format XGBoost saves models in by default
+type ubjsonDecoder struct {
+	data  []byte
+	pos   int
+	depth int
+}
+
+// decodeUBJSON decodes a UBJSON document into the JSON it stands for
+func decodeUBJSON(data []byte) ([]byte, error) {
+	d := &ubjsonDecoder{data: data}
+	v, err := d.value(-1)
+	if err != nil {
+		return nil, errors.Wrap(err, "model is not valid UBJSON")
+	}
+	if d.pos != len(d.data) {
+		return nil, errors.Errorf("model is not valid UBJSON: %v bytes left after the document", len(d.data)-d.pos)
+	}
+	return json.Marshal(v)
+}
+
+// next returns the next n bytes
+func (d *ubjsonDecoder) next(n int) ([]byte, error) {
+	if n < 0 || n > len(d.data)-d.pos {
+		return nil, errors.Errorf("unexpected end of data at byte %v", d.pos)
+	}
+	b := d.data[d.pos : d.pos+n]
+	d.pos += n
+	return b, nil
+}
+
+// marker returns the next type marker, skipping no-ops
+func (d *ubjsonDecoder) marker() (byte, error) {
+	for {
+		b, err := d.next(1)
+		if err != nil {
+			return 0, err
+		}
+		if b[0] != 'N' {
+			return b[0], nil
+		}
+	}
+}
+
+// value reads a value of the given type, or of the type of the next marker if typ is -1.
+// Numbers come back as float64, and containers as the maps and slices encoding/json uses.
+func (d *ubjsonDecoder) value(typ int) (interface{}, error) {
+	m := byte(typ)
+	if typ < 0 {
+		var err error
+		if m, err = d.marker(); err != nil {
+			return nil, err
+		}
+	}
+	switch m {
+	case 'Z':
+		return nil, nil
+	case 'T':
+		return true, nil
+	case 'F':
+		return false, nil
+	case 'i', 'U', 'I', 'l', 'L':
+		n, err := d.integer(m)
+		return float64(n), err
+	case 'd':
+		b, err := d.next(4)
+		if err != nil {
+			return nil, err
+		}
+		return float64(math.Float32frombits(binary.BigEndian.Uint32(b))), nil
+	case 'D':
+		b, err := d.next(8)
+		if err != nil {
+			return nil, err
+		}
+		return math.Float64frombits(binary.BigEndian.Uint64(b)), nil
+	case 'H':
+		s, err := d.str()
+		if err != nil {
+			return nil, err
+		}
+		return json.Number(s), nil
+	case 'C':
+		b, err := d.next(1)
+		if err != nil {
+			return nil, err
+		}
+		return string(b), nil
+	case 'S':
+		return d.str()
+	case '[', '{':
+		d.depth++
+		defer func() { d.depth-- }()
+		if d.depth > ubjsonMaxDepth {
+			return nil, errors.Errorf("containers nested more than %v deep", ubjsonMaxDepth)
+		}
+		if m == '[' {
+			return d.array()
+		}
+		return d.object()
+	}
+	return nil, errors.Errorf("unknown type marker %q at byte %v", m, d.pos-1)
+}
+
+// integer reads an integer of the type
+func (d *ubjsonDecoder) integer(m byte) (int64, error) {
+	size := map[byte]int{'i': 1, 'U': 1, 'I': 2, 'l': 4, 'L': 8}[m]
+	if size == 0 {
+		return 0, errors.Errorf("type marker %q at byte %v is not an integer", m, d.pos-1)
+	}
+	b, err := d.next(size)
+	if err != nil {
+		return 0, err
+	}
+	switch m {
+	case 'i':
+		return int64(int8(b[0])), nil
+	case 'U':
+		return int64(b[0]), nil
+	case 'I':
+		return int64(int16(binary.BigEndian.Uint16(b))), nil
+	case 'l':
+		return int64(int32(binary.BigEndian.Uint32(b))), nil
+	}
+	return int64(binary.BigEndian.Uint64(b)), nil
+}
+
+// length reads a length, an integer with its own marker
+func (d *ubjsonDecoder) length() (int, error) {
+	m, err := d.marker()
+	if err != nil {
+		return 0, err
+	}
+	n, err := d.integer(m)
+	if err != nil {
+		return 0, err
+	}
+	if n < 0 || n > int64(len(d.data)) {
+		return 0, errors.Errorf("invalid length %v at byte %v", n, d.pos)
+	}
+	return int(n), nil
+}
+
+// str reads the length and bytes of a string
+func (d *ubjsonDecoder) str() (string, error) {
+	n, err := d.length()
+	if err != nil {
+		return "", err
+	}
+	b, err := d.next(n)
+	return string(b), err
+}
+
+// header reads the optional type and count of a container. The type is -1 if the elements have their own
+// markers, and the count is -1 if the container ends with a closing marker.
+func (d *ubjsonDecoder) header() (int, int, error) {
+	typ, count := -1, -1
+	if d.pos < len(d.data) && d.data[d.pos] == '$' {
+		d.pos++
+		b, err := d.next(1)
+		if err != nil {
+			return 0, 0, err
+		}
+		typ = int(b[0])
+		if d.pos >= len(d.data) || d.data[d.pos] != '#' {
+			return 0, 0, errors.Errorf("container with a type has no count at byte %v", d.pos)
+		}
+	}
+	if d.pos < len(d.data) && d.data[d.pos] == '#' {
+		d.pos++
+		n, err := d.length()
+		if err != nil {
+			return 0, 0, err
+		}
+		count = n
+	}
+	return typ, count, nil
+}
+
+// array reads the elements of an array after its opening marker
+func (d *ubjsonDecoder) array() ([]interface{}, error) {
+	typ, count, err := d.header()
+	if err != nil {
+		return nil, err
+	}
+	values := make([]interface{}, 0, min(max(count, 0), len(d.data)-d.pos))
+	for i := 0; count < 0 || i < count; i++ {
+		if count < 0 {
+			m, err := d.marker()
+			if err != nil {
+				return nil, err
+			}
+			if m == ']' {
+				break
+			}
+			d.pos-- // the marker belongs to the value
+		}
+		v, err := d.value(typ)
+		if err != nil {
+			return nil, err
+		}
+		values = append(values, v)
+	}
+	return values, nil
+}
+
+// object reads the keys and values of an object after its opening marker
+func (d *ubjsonDecoder) object() (map[string]interface{}, error) {
+	typ, count, err := d.header()
+	if err != nil {
+		return nil, err
+	}
+	values := map[string]interface{}{}
+	for i := 0; count < 0 || i < count; i++ {
+		if count < 0 {
+			m, err := d.marker()
+			if err != nil {
+				return nil, err
+			}
+			if m == '}' {
+				break
+			}
+			d.pos--
+		}
+		key, err := d.str()
+		if err != nil {
+			return nil, err
+		}
+		v, err := d.value(typ)
+		if err != nil {
+			return nil, err
+		}
+		values[key] = v
+	}
+	return values, nil
+}
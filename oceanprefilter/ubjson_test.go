@@ -0,0 +1,34 @@
+package oceanprefilter
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"go.viam.com/test"
+)
+
+func TestDecodeUBJSON(t *testing.T) {
+	// no-ops, containers with and without counts and types, and every kind of value
+	doc := []byte("{" +
+		"i\x01aN[i\xffU\xffI\xff\xfeC!TFZ]" +
+		"i\x01b[$d#i\x02\x3f\x80\x00\x00\xc0\x00\x00\x00" +
+		"i\x01c{#i\x01i\x01dSi\x02hi" +
+		"i\x01eHi\x031.5" +
+		"}")
+	data, err := decodeUBJSON(doc)
+	test.That(t, err, test.ShouldBeNil)
+	var v map[string]interface{}
+	test.That(t, json.Unmarshal(data, &v), test.ShouldBeNil)
+	test.That(t, v, test.ShouldResemble, map[string]interface{}{
+		"a": []interface{}{-1.0, 255.0, -2.0, "!", true, false, nil},
+		"b": []interface{}{1.0, -2.0},
+		"c": map[string]interface{}{"d": "hi"},
+		"e": 1.5,
+	})
+
+	for _, bad := range []string{"", "[", "X", "[$d]", "Si\x05ab", "[]]", strings.Repeat("[", 100) + strings.Repeat("]", 100)} {
+		_, err := decodeUBJSON([]byte(bad))
+		test.That(t, err, test.ShouldNotBeNil)
+	}
+}
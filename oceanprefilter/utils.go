@@ -1,49 +1,20 @@
 package oceanprefilter
 
 import (
+	"github.com/disintegration/imaging"
+	"github.com/pkg/errors"
 	"image"
 	"image/draw"
 	"math"
-	"github.com/disintegration/imaging"
-	"github.com/pkg/errors"
-	"gocv.io/x/gocv"
 )
 
-func findHorizonLine(pic image.Image) ([]image.Point, error) {
-	// make gray
-	gray := toGray(pic)
-	grayMat, err := gocv.ImageGrayToMatGray(gray)
+// findHorizonLine finds the line between the sky and the water
+func findHorizonLine(pic image.Image) (Horizon, error) {
+	mask, err := horizonMask(pic)
 	if err != nil {
-		return nil, err
-	}
-	defer grayMat.Close()
-	gocv.GaussianBlur(grayMat, &grayMat, image.Pt(3, 3), 0, 0, gocv.BorderDefault)
-	// threshold to turn it into a binary image according to Otsu's method
-	_ = gocv.Threshold(grayMat, &grayMat, 0, 255, gocv.ThresholdOtsu)
-	oneScalar := gocv.NewScalar(255, 0, 0, 0)
-	kernelMorph := gocv.NewMatWithSize(9, 9, gocv.MatTypeCV8U)
-	defer kernelMorph.Close()
-	kernelMorph.SetTo(oneScalar)
-	// smooth out holes with morphology transform
-	gocv.MorphologyEx(grayMat, &grayMat, gocv.MorphClose, kernelMorph)
-
-	horizonX1 := 0
-	horizonX2 := pic.Bounds().Max.X - 1
-	horizonY1 := 0
-	horizonY2 := 0
-	for y := 0; y < grayMat.Rows(); y++ { // For Mat, y is in the first dimension, the rows
-		// Check the pixel at [y, horizonX1]
-		pixelVal1 := grayMat.GetUCharAt(y, horizonX1)
-		if pixelVal1 == 255 {
-			horizonY1 = y
-		}
-		// Check the pixel at [y, horizonX2]
-		pixelVal2 := grayMat.GetUCharAt(y, horizonX2)
-		if pixelVal2 == 255 {
-			horizonY2 = y
-		}
+		return Horizon{}, err
 	}
-	return []image.Point{{horizonX1, horizonY1}, {horizonX2, horizonY2}}, nil
+	return fitHorizon(mask)
 }
 
 func toGray(pic image.Image) *image.Gray {
@@ -55,9 +26,41 @@ func toGray(pic image.Image) *image.Gray {
 	return gray
 }
 
+// imagePatch is one of the pieces of water that gets scored by the model
+type imagePatch struct {
+	img image.Image
+	// box is the area the patch was taken from, in the coordinates of the original image
+	box image.Rectangle
+	// row and col are the place of the patch in the grid, rows count down from the top of each column
+	row, col int
+	// top is the y its column of patches starts at
+	top int
+}
+
 // crop the image from yValue -> img.Bounds().Max.Y
-// and then split the cropped image into nh horizontal and nv vertical bands of equal height and width (dimensions given)
-func splitUpImageConst(img image.Image, exZone *image.Rectangle, yValue, h, w int) ([]image.Image, error) {
+// and then split the cropped image into nh horizontal and nv vertical bands of equal height and width (dimensions given).
+// Bands that are masked out more than the mask allows are skipped.
+func splitUpImageConst(img image.Image, mask *RegionMask, yValue, h, w int) ([]imagePatch, error) {
+	if img == nil {
+		return nil, errors.New("input image to split up is nil")
+	}
+	if yValue >= img.Bounds().Max.Y {
+		return nil, errors.New("yValue must be within the image bounds")
+	}
+	return splitUpImage(img, mask, func(x0, x1 int) int { return yValue }, h, w)
+}
+
+// splitUpImageBelow splits the water below a horizon that may be tilted. Every column of bands
+// starts at the lowest point of the horizon over the width of that column.
+func splitUpImageBelow(img image.Image, mask *RegionMask, horizon Horizon, h, w int) ([]imagePatch, error) {
+	return splitUpImage(img, mask, horizon.top, h, w)
+}
+
+// splitUpImage splits the image into bands of equal height and width, in columns of width w.
+// Each column is cropped from top(xMin, xMax) down to the bottom of the image, with xMin and xMax the edges of the column.
+// Bands at the right and bottom edge are resized to the full size, and
+// bands that are masked out more than the mask allows are skipped.
+func splitUpImage(img image.Image, mask *RegionMask, top func(x0, x1 int) int, h, w int) ([]imagePatch, error) {
 	if img == nil {
 		return nil, errors.New("input image to split up is nil")
 	}
@@ -68,36 +71,40 @@ func splitUpImageConst(img image.Image, exZone *image.Rectangle, yValue, h, w in
 		return nil, errors.Errorf("width must be greater than 0, got %v", w)
 	}
 
-	// Crop the image from yValue to img.Bounds().Max.Y
 	bounds := img.Bounds()
-	croppedHeight := bounds.Max.Y - yValue
-	if croppedHeight <= 0 {
-		return nil, errors.New("yValue must be within the image bounds")
-	}
-	// edit exluded zone to take the crop into account
-	excludedBox := image.Rectangle{}
-	if exZone != nil {
-		excludedBox.Min.X = exZone.Min.X
-		excludedBox.Min.Y = exZone.Min.Y - yValue
-		excludedBox.Max.X = exZone.Max.X
-		excludedBox.Max.Y = exZone.Max.Y - yValue
+	nh := int(math.Ceil(float64(bounds.Dx()) / float64(w)))
+	edgeX := bounds.Dx()
+	images := make([]imagePatch, 0)
+	type column struct{ j, yValue, nv int }
+	columns := make([]column, 0, nh)
+	maxRows := 0
+	for j := 0; j < nh; j++ {
+		yValue := top(bounds.Min.X+j*w, bounds.Min.X+int(math.Min(float64((j+1)*w), float64(edgeX))))
+		if yValue < bounds.Min.Y {
+			yValue = bounds.Min.Y
+		}
+		croppedHeight := bounds.Max.Y - yValue
+		if croppedHeight <= 0 {
+			continue // this column has no water
+		}
+		nv := int(math.Ceil(float64(croppedHeight) / float64(h)))
+		columns = append(columns, column{j, yValue, nv})
+		if nv > maxRows {
+			maxRows = nv
+		}
 	}
-	croppedRect := image.Rect(0, yValue, bounds.Max.X, bounds.Max.Y)
-	croppedImg := image.NewRGBA(image.Rect(0, 0, croppedRect.Dx(), croppedRect.Dy()))
-	draw.Draw(croppedImg, croppedImg.Bounds(), img, croppedRect.Min, draw.Src)
 
-	// Split the cropped image into n horizontal bands
-	nv := int(math.Ceil(float64(croppedImg.Bounds().Dy()) / float64(h)))
-	nh := int(math.Ceil(float64(croppedImg.Bounds().Dx()) / float64(w)))
-	images := make([]image.Image, 0, w*h)
-	edgeX := croppedImg.Bounds().Max.X
-	edgeY := croppedImg.Bounds().Max.Y
-
-	for i := 0; i < nv; i++ {
-		for j := 0; j < nh; j++ {
+	// go row by row, so the patches come out in reading order
+	for i := 0; i < maxRows; i++ {
+		for _, c := range columns {
+			if i >= c.nv {
+				continue
+			}
+			croppedMin := image.Pt(bounds.Min.X, c.yValue)
+			edgeY := bounds.Max.Y - c.yValue
 			flag := false
-			xEnd := (j+1)*w
-			yEnd := (i+1)*h
+			xEnd := (c.j + 1) * w
+			yEnd := (i + 1) * h
 			//bounds checking
 			if xEnd >= edgeX {
 				xEnd = edgeX - 1
@@ -107,21 +114,37 @@ func splitUpImageConst(img image.Image, exZone *image.Rectangle, yValue, h, w in
 				yEnd = edgeY - 1
 				flag = true
 			}
-			bandRect := image.Rect(j*w, i*h, xEnd, yEnd)
-			// if rect in excluded zone, skip it
-			if exZone != nil && bandRect.Overlaps(excludedBox) {
+			bandRect := image.Rect(c.j*w, i*h, xEnd, yEnd)
+			box := bandRect.Add(croppedMin)
+			if box.Empty() {
+				continue
+			}
+			// if rect is in the excluded regions, skip it
+			if mask.skip(bounds, box) {
 				continue
 			}
-			bandImg := image.NewRGBA(bandRect)
-			draw.Draw(bandImg, bandImg.Bounds(), croppedImg, image.Point{bandRect.Min.X, bandRect.Min.Y}, draw.Src)
+			bandImg := band(img, box)
 
 			if flag {
 				resized := imaging.Resize(bandImg, w, h, imaging.Lanczos)
-				images = append(images, resized)
+				images = append(images, imagePatch{img: resized, box: box, row: i, col: c.j, top: c.yValue})
 			} else {
-				images = append(images, bandImg)
+				images = append(images, imagePatch{img: bandImg, box: box, row: i, col: c.j, top: c.yValue})
 			}
 		}
 	}
 	return images, nil
 }
+
+// band returns the part of the image inside box. Images that support it are cut with SubImage, which shares
+// the pixels with the image instead of copying them, so the band must not be changed.
+func band(img image.Image, box image.Rectangle) image.Image {
+	if sub, ok := img.(interface {
+		SubImage(r image.Rectangle) image.Image
+	}); ok {
+		return sub.SubImage(box)
+	}
+	bandImg := image.NewRGBA(box)
+	draw.Draw(bandImg, box, img, box.Min, draw.Src)
+	return bandImg
+}
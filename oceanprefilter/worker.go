@@ -0,0 +1,161 @@
+package oceanprefilter
+
+import (
+	"image"
+	"sync/atomic"
+	"time"
+
+	"github.com/pkg/errors"
+	"go.viam.com/rdk/vision/classification"
+	objdet "go.viam.com/rdk/vision/objectdetection"
+)
+
+// cameraWorker is the state of the background stream of one camera
+type cameraWorker struct {
+	name        string
+	triggerFlag atomic.Bool
+	lastTrigger atomic.Pointer[Inference] // result of the frame that last raised the trigger
+	currImg     atomic.Pointer[image.Image]
+	rc          atomic.Pointer[RunConfig] // settings of this camera, read by its stream on every frame
+	stats       *runStats
+	ownRegions  bool // the camera has its own regions in camera_regions instead of those of the service
+	// tracker and state are only used by the stream of the camera, and kept here so they outlive a restart of it
+	tracker *horizonTracker
+	state   *triggerState
+}
+
+func newCameraWorker(name string) *cameraWorker {
+	return &cameraWorker{name: name, stats: newRunStats()}
+}
+
+// streamState returns the horizon tracker and trigger state of the camera's stream, made from rc the first time.
+// A stream started again after an error carries on with the tracked horizon and the confirmed frames of the last one.
+func (w *cameraWorker) streamState(rc RunConfig) (*horizonTracker, *triggerState) {
+	if w.tracker == nil {
+		// the horizon moves little from one frame to the next, so it is tracked for as long as the camera is watched
+		w.tracker = newHorizonTracker(rc.horizonHold, rc.horizonMaxJump, rc.horizonSmoothing)
+	}
+	if w.state == nil {
+		// without trigger_hold_seconds the trigger is held for the time triggerCountdown frames take at the max frequency
+		triggerHold := rc.triggerHold
+		if triggerHold == 0 {
+			triggerHold = time.Duration(triggerCountdown / rc.frequency * float64(time.Second))
+		}
+		w.state = newTriggerState(rc.confirmFrames, rc.confirmWindow, triggerHold, rc.triggerQuiet)
+	}
+	return w.tracker, w.state
+}
+
+// triggerDetections returns the detections of the frame that raised the trigger, if the stream is currently triggered
+func (w *cameraWorker) triggerDetections() []objdet.Detection {
+	dets := []objdet.Detection{}
+	if w.triggerFlag.Load() {
+		if stored := w.lastTrigger.Load(); stored != nil {
+			dets = append(dets, stored.Detections...)
+		}
+	}
+	return dets
+}
+
+// triggerClassifications returns the classifications of the frame that raised the trigger, if the stream is currently triggered
+func (w *cameraWorker) triggerClassifications() classification.Classifications {
+	if !w.triggerFlag.Load() {
+		return classification.Classifications{}
+	}
+	stored := w.lastTrigger.Load()
+	if stored == nil {
+		return classification.Classifications{classification.NewClassification(1.0, triggerClassName)}
+	}
+	return stored.classifications()
+}
+
+// cameraWorkers are the background streams of the configured cameras, replaced as a whole on every reconfigure
+type cameraWorkers struct {
+	byName map[string]*cameraWorker
+	names  []string // the cameras in the order they were configured
+}
+
+// onlyCamera returns the name of the camera if there is exactly one, for error messages
+func (cw *cameraWorkers) onlyCamera() string {
+	if len(cw.names) == 1 {
+		return cw.names[0]
+	}
+	return ""
+}
+
+// cameras returns the background streams of the cameras, none if the prefilter is not configured yet
+func (pf *prefilter) cameras() *cameraWorkers {
+	if cw := pf.workers.Load(); cw != nil {
+		return cw
+	}
+	return &cameraWorkers{}
+}
+
+// worker returns the background stream of the camera, or an error naming the configured cameras
+func (pf *prefilter) worker(cameraName string) (*cameraWorker, error) {
+	cw := pf.cameras()
+	if w, ok := cw.byName[cameraName]; ok {
+		return w, nil
+	}
+	if len(cw.names) > 1 {
+		return nil, errors.Errorf("camera name given to method, %v is not one of the configured cameras %v", cameraName, cw.names)
+	}
+	return nil, errors.Errorf("camera name given to method, %v is not the same as configured camera %v", cameraName, cw.onlyCamera())
+}
+
+// setWorkers replaces the cameras watched in the background
+func (pf *prefilter) setWorkers(workers []*cameraWorker) {
+	cw := &cameraWorkers{
+		byName: make(map[string]*cameraWorker, len(workers)),
+		names:  make([]string, 0, len(workers)),
+	}
+	for _, w := range workers {
+		cw.byName[w.name] = w
+		cw.names = append(cw.names, w.name)
+	}
+	pf.workers.Store(cw)
+}
+
+// cameraNames returns camera_name followed by camera_names
+func (cfg *Config) cameraNames() ([]string, error) {
+	names := []string{}
+	if cfg.CameraName != "" {
+		names = append(names, cfg.CameraName)
+	}
+	seen := map[string]bool{cfg.CameraName: true}
+	for _, name := range cfg.CameraNames {
+		if name == "" {
+			return nil, errors.New("camera_names can't have an empty name")
+		}
+		if seen[name] {
+			return nil, errors.Errorf("camera %q is configured more than once", name)
+		}
+		seen[name] = true
+		names = append(names, name)
+	}
+	return names, nil
+}
+
+// CameraRegionsConfig are the regions of one camera, used instead of the excluded_regions and included_regions of the service
+type CameraRegionsConfig struct {
+	ExcludedRegions []RegionConfig `json:"excluded_regions"`
+	IncludedRegions []RegionConfig `json:"included_regions"`
+}
+
+// cameraMask returns the mask of the camera, which is a copy of the mask of the service unless camera_regions has an entry for it
+func (cfg *Config) cameraMask(name string, serviceMask *RegionMask) (*RegionMask, error) {
+	regions, ok := cfg.CameraRegions[name]
+	if !ok {
+		return serviceMask.copyRegions(), nil
+	}
+	cameraCfg := &Config{
+		ExcludedRegions:    regions.ExcludedRegions,
+		IncludedRegions:    regions.IncludedRegions,
+		MaxExcludedOverlap: cfg.MaxExcludedOverlap,
+	}
+	mask, err := cameraCfg.regionMask()
+	if err != nil {
+		return nil, errors.Wrapf(err, "camera_regions of %q", name)
+	}
+	return mask, nil
+}
@@ -2,103 +2,241 @@ package oceanprefilter
 
 import (
 	"image"
+	"image/color"
 	"math"
 
-	"github.com/Elvenson/xgboost-go/mat"
 	"github.com/pkg/errors"
+	"go.viam.com/rdk/vision/classification"
+	objdet "go.viam.com/rdk/vision/objectdetection"
 )
 
-func flatten(matrix mat.SparseMatrix) mat.SparseMatrix {
-	flatVector := mat.SparseVector{}
-	offset := 0
-
-	for _, vector := range matrix.Vectors {
-		for idx, value := range vector {
-			flatIndex := offset + idx
-			flatVector[flatIndex] = value
-		}
-		offset += len(vector)
+// avgPool averages the brightness of the image over windows of poolWindow, as fractions of 256, into features.
+// The windows are stored row by row, and a window with only fully transparent pixels is a missing feature, a NaN.
+// Features past the last window are missing as well.
+func avgPool(img image.Image, poolWindow image.Point, features []float32) {
+	bounds := img.Bounds()
+	h := bounds.Dy() / poolWindow.Y
+	w := bounds.Dx() / poolWindow.X
+	sumWindow := windowSummer(img)
+	missing := float32(math.NaN())
+	for k := range features {
+		features[k] = missing
 	}
-
-	flatMatrix := mat.SparseMatrix{
-		Vectors: []mat.SparseVector{flatVector},
+	for i := 0; i < h; i++ {
+		for j := 0; j < w && i*w+j < len(features); j++ {
+			window := image.Rect(j*poolWindow.X, i*poolWindow.Y, (j+1)*poolWindow.X, (i+1)*poolWindow.Y).Add(bounds.Min)
+			sum, count := sumWindow(window)
+			if count > 0 {
+				features[i*w+j] = float32(float64(sum) / 3.0 / 256.0 / float64(count))
+			}
+		}
 	}
-
-	return flatMatrix
 }
 
-func avgPoolFull(img image.Image, patchSize image.Point) mat.SparseMatrix {
-	bounds := img.Bounds()
-	width, height := bounds.Dx(), bounds.Dy()
-	patchWidth, patchHeight := patchSize.X, patchSize.Y
-
-	h := height / patchHeight
-	w := width / patchWidth
-
-	downsize := make([]mat.SparseVector, h)
-
-	for i := 0; i < h; i++ {
-		row := make(mat.SparseVector)
-		for j := 0; j < w; j++ {
-			sum := 0.0
+// windowSummer returns a function that sums r+g+b, in the 16 bit range of color.RGBA, over the pixels of a window
+// of the image that aren't fully transparent, and counts those pixels. The common image types are read straight from
+// their pixel buffers. A YCbCr pixel is converted to 8 bit RGB first, the same as drawing it into an RGBA image does.
+func windowSummer(img image.Image) func(window image.Rectangle) (uint64, int) {
+	switch im := img.(type) {
+	case *image.RGBA:
+		return func(window image.Rectangle) (uint64, int) {
+			var sum uint64
 			count := 0
-			for x := 0; x < patchWidth; x++ {
-				for y := 0; y < patchHeight; y++ {
-					px := bounds.Min.X + j*patchWidth + x
-					py := bounds.Min.Y + i*patchHeight + y
-					r, g, b, a := img.At(px, py).RGBA()
-					avg := float64(r+g+b) / 3.0 / 256.0
+			for y := window.Min.Y; y < window.Max.Y; y++ {
+				pix := im.Pix[im.PixOffset(window.Min.X, y):im.PixOffset(window.Max.X, y)]
+				for k := 0; k < len(pix); k += 4 {
+					if pix[k+3] > 0 {
+						sum += uint64(pix[k]) + uint64(pix[k+1]) + uint64(pix[k+2])
+						count++
+					}
+				}
+			}
+			return sum * 0x101, count
+		}
+	case *image.NRGBA:
+		return func(window image.Rectangle) (uint64, int) {
+			var sum uint64
+			count := 0
+			for y := window.Min.Y; y < window.Max.Y; y++ {
+				pix := im.Pix[im.PixOffset(window.Min.X, y):im.PixOffset(window.Max.X, y)]
+				for k := 0; k < len(pix); k += 4 {
+					a := uint64(pix[k+3])
 					if a > 0 {
-						sum += avg
+						// premultiplied like color.NRGBA.RGBA
+						sum += (uint64(pix[k])*0x101*a)/0xff + (uint64(pix[k+1])*0x101*a)/0xff + (uint64(pix[k+2])*0x101*a)/0xff
 						count++
 					}
 				}
 			}
-			if count > 0 {
-				row[j] = float32(sum / float64(count))
+			return sum, count
+		}
+	case *image.Gray:
+		return func(window image.Rectangle) (uint64, int) {
+			var sum uint64
+			for y := window.Min.Y; y < window.Max.Y; y++ {
+				for _, v := range im.Pix[im.PixOffset(window.Min.X, y):im.PixOffset(window.Max.X, y)] {
+					sum += uint64(v)
+				}
+			}
+			return sum * 3 * 0x101, window.Dx() * window.Dy()
+		}
+	case *image.YCbCr:
+		return func(window image.Rectangle) (uint64, int) {
+			var sum uint64
+			for y := window.Min.Y; y < window.Max.Y; y++ {
+				for x := window.Min.X; x < window.Max.X; x++ {
+					ci := im.COffset(x, y)
+					r, g, b := color.YCbCrToRGB(im.Y[im.YOffset(x, y)], im.Cb[ci], im.Cr[ci])
+					sum += uint64(r) + uint64(g) + uint64(b)
+				}
+			}
+			return sum * 0x101, window.Dx() * window.Dy()
+		}
+	default:
+		return func(window image.Rectangle) (uint64, int) {
+			var sum uint64
+			count := 0
+			for y := window.Min.Y; y < window.Max.Y; y++ {
+				for x := window.Min.X; x < window.Max.X; x++ {
+					r, g, b, a := img.At(x, y).RGBA()
+					if a > 0 {
+						sum += uint64(r) + uint64(g) + uint64(b)
+						count++
+					}
+				}
 			}
+			return sum, count
 		}
-		downsize[i] = row
 	}
+}
 
-	return mat.SparseMatrix{Vectors: downsize}
-
+// Inference is the outcome of running the prefilter on a single image
+type Inference struct {
+	// Triggered is true if any patch of the image was found interesting
+	Triggered bool
+	// Confidence is the highest score of the patches that caused the trigger,
+	// or the highest probability of the "interesting" class seen over all patches if nothing triggered
+	Confidence float64
+	// Detections holds a box for every patch that triggered, in the coordinates of the input image
+	Detections []objdet.Detection
+	// Horizon is where the water was found to start
+	Horizon Horizon
 }
-func MakeInference(input image.Image, rc RunConfig) (bool, error) {
-	// find the horizon, take the average y value
-	linePoints, err := findHorizonLine(input)
-	if err != nil {
-		return false, err
-	}
-	if len(linePoints) < 2 {
-		return false, errors.New("function to find the horizon line returned less than 2 points")
+
+// classifications returns the TRIGGER classification of a triggered result. If the detections came from
+// a second stage detector, each of their labels is returned as well, with the best score seen for that label.
+func (r Inference) classifications() classification.Classifications {
+	cls := classification.Classifications{}
+	if !r.Triggered {
+		return cls
 	}
-	cropY := int(math.Max(float64(linePoints[0].Y), float64(linePoints[1].Y)))
-	if rc.debug {
-		rc.logger.Debugf("found horizon at y = %v", cropY)
+	cls = append(cls, classification.NewClassification(r.Confidence, triggerClassName))
+	best := map[string]float64{}
+	labels := []string{}
+	for _, d := range r.Detections {
+		if d.Label() == triggerClassName {
+			continue
+		}
+		score, ok := best[d.Label()]
+		if !ok {
+			labels = append(labels, d.Label())
+		}
+		if !ok || d.Score() > score {
+			best[d.Label()] = d.Score()
+		}
 	}
-	if cropY >= (input.Bounds().Max.Y-1) || cropY <= 1 {
-		return false, errors.Errorf("could not find horizon in image. Got a horizon value of y = %v", cropY)
+	for _, label := range labels {
+		cls = append(cls, classification.NewClassification(best[label], label))
 	}
-	imgs, err := splitUpImageConst(input, rc.ExcludedZone, cropY, 80, 200)
+	return cls
+}
+
+// MakeInference splits the water below the horizon, found with rc.HorizonStrategy, into patches and scores each patch with the XGBoost model.
+// The image triggers if any patch has an "interesting" probability of at least rc.Threshold.
+// If motion is turned on, patches that moved are either a trigger of their own, or the only patches the model may trigger on.
+// The patches are scored on rc.Workers goroutines, and with rc.StopAtFirstTrigger only the first triggering patch is reported.
+func MakeInference(input image.Image, rc RunConfig) (Inference, error) {
+	horizon, imgs, err := rc.patches(input)
 	if err != nil {
-		return false, err
+		return Inference{}, err
 	}
 
-	// new code -> checks if any square is interesting
-	for _, img := range imgs {
-		in_mat := avgPoolFull(img, image.Point{10, 2})
-		in_mat = flatten(in_mat)
-
-		result, err := rc.Model.Predict(in_mat)
-		if err != nil {
-			panic(err)
+	var motion []float64
+	if rc.motionTrigger && rc.motion != nil {
+		boxes := make([]image.Rectangle, 0, len(imgs))
+		for _, p := range imgs {
+			boxes = append(boxes, p.box)
 		}
+		motion = rc.motion.score(input, boxes)
+	}
 
-		if (*result.Vectors[0])[0] == 1 {
-			return true, nil
+	// checks if any square is interesting
+	result := Inference{Horizon: horizon}
+	maxProb := 0.0
+	scores, scored := rc.scorePatches(imgs, motion)
+	for i, p := range imgs[:scored] {
+		s := scores[i]
+		if s.err != nil {
+			return Inference{}, s.err
 		}
+		if !s.scored {
+			continue
+		}
+		if s.prob > maxProb {
+			maxProb = s.prob
+		}
+		moving := motion != nil && motion[i] >= rc.motionThreshold
+		switch {
+		case s.prob >= rc.Threshold:
+			result.addDetection(objdet.NewDetection(p.box, s.prob, triggerClassName))
+		case moving && rc.motionMode == MotionModeTrigger:
+			result.addDetection(objdet.NewDetection(p.box, math.Min(motion[i], 1.0), motionClassName))
+		}
+	}
+	if !result.Triggered {
+		result.Confidence = maxProb
 	}
 
-	return false, nil
+	return result, nil
+}
+
+// patches finds the horizon of the image and splits the water below it into the patches the model scores
+func (rc RunConfig) patches(input image.Image) (Horizon, []imagePatch, error) {
+	horizon, err := rc.findHorizon(input)
+	if rc.horizonTracker != nil {
+		horizon, err = rc.horizonTracker.track(input.Bounds(), horizon, err)
+	}
+	if err != nil {
+		return Horizon{}, nil, err
+	}
+	if rc.debug {
+		rc.logger.Debugf("found horizon from y = %.1f to y = %.1f, tilted %.1f degrees, confidence %.2f",
+			horizon.Y0, horizon.Y1, horizon.Angle(), horizon.Confidence)
+	}
+	patchSize := rc.patchSize()
+	imgs, err := splitUpImageBelow(input, rc.Mask, horizon, patchSize.Y, patchSize.X)
+	if err != nil {
+		return Horizon{}, nil, err
+	}
+	return horizon, imgs, nil
+}
+
+// addDetection adds a triggering patch to the result
+func (r *Inference) addDetection(d objdet.Detection) {
+	r.Triggered = true
+	r.Detections = append(r.Detections, d)
+	if d.Score() > r.Confidence {
+		r.Confidence = d.Score()
+	}
+}
+
+// interestingProbability returns the softmax probability the model gives to the "interesting" class of a patch
+func interestingProbability(model *XGBoostModel, features []float32) (float64, error) {
+	if model == nil {
+		return 0, errors.New("no XGBoost model loaded")
+	}
+	if model.NumClasses() != modelNumClasses {
+		return 0, errors.Errorf("expected %v class probabilities from the model", modelNumClasses)
+	}
+	return model.Probability(features, interestingClass)
 }
@@ -0,0 +1,152 @@
+package oceanprefilter
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"testing"
+
+	"go.viam.com/test"
+)
+
+// opaqueImage hides the type of an image, so only the generic code paths can be used on it
+type opaqueImage struct{ image.Image }
+
+// frameAs returns the frame as an image of the given type, the way cameras commonly hand them over
+func frameAs(frame image.Image, kind string) image.Image {
+	bounds := frame.Bounds()
+	switch kind {
+	case "ycbcr":
+		img := image.NewYCbCr(bounds, image.YCbCrSubsampleRatio420)
+		for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+			for x := bounds.Min.X; x < bounds.Max.X; x++ {
+				r, g, b, _ := frame.At(x, y).RGBA()
+				yy, cb, cr := color.RGBToYCbCr(uint8(r>>8), uint8(g>>8), uint8(b>>8))
+				img.Y[img.YOffset(x, y)] = yy
+				img.Cb[img.COffset(x, y)] = cb
+				img.Cr[img.COffset(x, y)] = cr
+			}
+		}
+		return img
+	case "gray":
+		return toGray(frame)
+	case "nrgba":
+		// with some see through and fully transparent pixels
+		img := image.NewNRGBA(bounds)
+		draw.Draw(img, bounds, frame, bounds.Min, draw.Src)
+		for k := 3; k < len(img.Pix); k += 4 * 7 {
+			img.Pix[k] = uint8(k % 256)
+		}
+		return img
+	default:
+		img := image.NewRGBA(bounds)
+		draw.Draw(img, bounds, frame, bounds.Min, draw.Src)
+		return img
+	}
+}
+
+// pooled returns the features of the whole image
+func pooled(img image.Image, poolWindow image.Point) []float32 {
+	features := make([]float32, numFeatures(img.Bounds().Size(), poolWindow))
+	avgPool(img, poolWindow, features)
+	return features
+}
+
+func TestAvgPoolPixelTypes(t *testing.T) {
+	frame := loadFrame(t, 640, 480)
+	window := image.Rect(100, 250, 300, 330)
+	for _, kind := range []string{"rgba", "nrgba", "gray", "ycbcr"} {
+		img := frameAs(frame, kind)
+		fast := pooled(img, defaultPoolWindow)
+		test.That(t, len(fast), test.ShouldEqual, 64*240)
+		if kind == "ycbcr" {
+			// read like the RGBA image drawing it gives
+			copied := image.NewRGBA(img.Bounds())
+			draw.Draw(copied, copied.Bounds(), img, image.Point{}, draw.Src)
+			test.That(t, fast, test.ShouldResemble, pooled(opaqueImage{copied}, defaultPoolWindow))
+		} else {
+			test.That(t, fast, test.ShouldResemble, pooled(opaqueImage{img}, defaultPoolWindow))
+		}
+
+		// views into the image are read at their own bounds
+		sub := img.(interface {
+			SubImage(r image.Rectangle) image.Image
+		}).SubImage(window)
+		copied := image.NewRGBA(window)
+		draw.Draw(copied, window, sub, window.Min, draw.Src)
+		features := pooled(sub, defaultPoolWindow)
+		test.That(t, len(features), test.ShouldEqual, 800)
+		if kind != "nrgba" {
+			// drawing see through pixels into an RGBA image rounds them
+			test.That(t, features, test.ShouldResemble, pooled(copied, defaultPoolWindow))
+		}
+	}
+}
+
+func TestSplitUpImageViews(t *testing.T) {
+	frame := loadFrame(t, 640, 480)
+	for _, kind := range []string{"rgba", "gray", "ycbcr"} {
+		img := frameAs(frame, kind)
+		views, err := splitUpImageConst(img, nil, 200, 80, 200)
+		test.That(t, err, test.ShouldBeNil)
+		copies, err := splitUpImageConst(opaqueImage{img}, nil, 200, 80, 200)
+		test.That(t, err, test.ShouldBeNil)
+		test.That(t, len(views), test.ShouldEqual, len(copies))
+		for i, p := range views {
+			test.That(t, p.box, test.ShouldResemble, copies[i].box)
+			test.That(t, p.img.Bounds().Size(), test.ShouldResemble, copies[i].img.Bounds().Size())
+			if p.img.Bounds() == p.box {
+				// a view, with the pixels of the copy
+				test.That(t, pooled(p.img, defaultPoolWindow), test.ShouldResemble, pooled(copies[i].img, defaultPoolWindow))
+			}
+		}
+	}
+}
+
+func BenchmarkAvgPool(b *testing.B) {
+	for _, size := range []image.Point{{640, 480}, {1280, 720}, {1920, 1080}} {
+		frame := loadFrame(b, size.X, size.Y)
+		for _, kind := range []string{"rgba", "ycbcr"} {
+			img := frameAs(frame, kind)
+			for _, typed := range []bool{false, true} {
+				var in image.Image = opaqueImage{img}
+				name := fmt.Sprintf("%vx%v/%v/generic", size.X, size.Y, kind)
+				if typed {
+					in = img
+					name = fmt.Sprintf("%vx%v/%v/typed", size.X, size.Y, kind)
+				}
+				features := make([]float32, numFeatures(size, defaultPoolWindow))
+				b.Run(name, func(b *testing.B) {
+					for i := 0; i < b.N; i++ {
+						avgPool(in, defaultPoolWindow, features)
+					}
+				})
+			}
+		}
+	}
+}
+
+func BenchmarkSplitUpImage(b *testing.B) {
+	for _, size := range []image.Point{{640, 480}, {1280, 720}, {1920, 1080}} {
+		frame := loadFrame(b, size.X, size.Y)
+		for _, kind := range []string{"rgba", "ycbcr"} {
+			img := frameAs(frame, kind)
+			for _, views := range []bool{false, true} {
+				var in image.Image = opaqueImage{img}
+				name := fmt.Sprintf("%vx%v/%v/copies", size.X, size.Y, kind)
+				if views {
+					in = img
+					name = fmt.Sprintf("%vx%v/%v/views", size.X, size.Y, kind)
+				}
+				b.Run(name, func(b *testing.B) {
+					for i := 0; i < b.N; i++ {
+						if _, err := splitUpImageConst(in, nil, size.Y/3, 80, 200); err != nil {
+							b.Fatal(err)
+						}
+					}
+				})
+			}
+		}
+	}
+}